@@ -10,6 +10,7 @@ import (
 	infraCache "rest_api_poc/internal/infra/cache"
 	"rest_api_poc/internal/infra/config"
 	"rest_api_poc/internal/infra/db"
+	"rest_api_poc/internal/infra/notification"
 	"rest_api_poc/internal/shared/logger"
 	"syscall"
 	"time"
@@ -30,9 +31,12 @@ func main() {
 	// Optional caches (Redis, etc). Best-effort: DB remains the source of truth.
 	cacheBundle := infraCache.NewBundle(&cfg.Cache)
 
+	// Outgoing emails (OTPs, security alerts). Delivered asynchronously with retries.
+	notifier := notification.New(&cfg.Notification)
+
 	// Create dependency container
 	// Simple, explicit dependency injection - no magic, easy to understand
-	container := di.NewContainer(database, cfg, cacheBundle)
+	container := di.NewContainer(database, cfg, cacheBundle, notifier)
 
 	// Start server (non-blocking) and wait for signal or server error
 	webDispose, serverErrCh := infra.StartServer(container)
@@ -53,10 +57,19 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	// Shutdown server first, then DB.
+	// Shutdown server first, then stop background jobs, flush session activity and pending notifications, then DB.
 	if err := webDispose(shutdownCtx); err != nil {
 		logger.Error("Server shutdown error: %v", err)
 	}
+	if err := container.ProductModule.Purger.Close(shutdownCtx); err != nil {
+		logger.Error("Product trash purger shutdown error: %v", err)
+	}
+	if err := container.AuthModule.Activity.Close(shutdownCtx); err != nil {
+		logger.Error("Session activity flush error: %v", err)
+	}
+	if err := notifier.Close(shutdownCtx); err != nil {
+		logger.Error("Notifier shutdown error: %v", err)
+	}
 	if err := cacheBundle.Close(shutdownCtx); err != nil {
 		logger.Error("Cache shutdown error: %v", err)
 	}
@@ -1,6 +1,7 @@
 package di
 
 import (
+	"rest_api_poc/internal/domain/audit"
 	"rest_api_poc/internal/domain/auth"
 	"rest_api_poc/internal/domain/health"
 	"rest_api_poc/internal/domain/product"
@@ -9,6 +10,8 @@ import (
 	"rest_api_poc/internal/infra/config"
 	"rest_api_poc/internal/infra/db"
 	"rest_api_poc/internal/infra/middleware"
+	"rest_api_poc/internal/infra/notification"
+	"rest_api_poc/internal/infra/ratelimit"
 )
 
 // Container holds all application dependencies
@@ -22,25 +25,37 @@ type Container struct {
 	AuthModule     *auth.Module
 	AuthMiddleware *middleware.AuthMiddleware
 	RoleMiddleware *middleware.RoleMiddleware
-	ProductHandler *product.Handler
+	RateLimiter    *middleware.RateLimiter
+	ProductModule  *product.Module
 	UserHandler    *user.Handler
+	AuditHandler   *audit.Handler
 	HealthHandler  *health.Handler
 }
 
 // NewContainer creates a new container with all dependencies
 // This manually wires up all services - simple and explicit
-func NewContainer(database db.DB, cfg *config.Config, cacheBundle *cache.Bundle) *Container {
+func NewContainer(database db.DB, cfg *config.Config, cacheBundle *cache.Bundle, notifier notification.Notifier) *Container {
 	var authCache auth.AuthCache
+	var loginAttempts auth.LoginAttemptStore
+	var webauthnChallenges auth.WebAuthnChallengeStore
+	var rateLimitStore ratelimit.Store
 	if cacheBundle != nil {
 		authCache = cacheBundle.Auth
+		loginAttempts = cacheBundle.LoginAttempts
+		webauthnChallenges = cacheBundle.WebAuthnChallenges
+		rateLimitStore = cacheBundle.RateLimit
 	}
 
+	// The audit log is shared by every domain that records changes
+	auditModule := audit.NewModule(database)
+
 	// Create auth module first
-	authModule := auth.NewModule(database.Pool(), cfg, authCache)
+	authModule := auth.NewModule(database.Pool(), cfg, authCache, loginAttempts, webauthnChallenges, notifier, auditModule.Service)
 
 	// Create middleware with auth dependencies
-	authMiddleware := middleware.NewAuthMiddleware(authModule.JWTService, authModule.Repository, authCache, cfg)
+	authMiddleware := middleware.NewAuthMiddleware(authModule.JWTService, authModule.Repository, authCache, authModule.Activity, cfg)
 	roleMiddleware := middleware.NewRoleMiddleware()
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, cfg)
 
 	return &Container{
 		DB:             database,
@@ -48,9 +63,11 @@ func NewContainer(database db.DB, cfg *config.Config, cacheBundle *cache.Bundle)
 		Cache:          cacheBundle,
 		AuthMiddleware: authMiddleware,
 		RoleMiddleware: roleMiddleware,
+		RateLimiter:    rateLimiter,
 		AuthModule:     authModule,
-		ProductHandler: product.NewModule(database),
-		UserHandler:    user.NewModule(database),
+		ProductModule:  product.NewModule(database, &cfg.Product, cfg.WebServer.RequireIfMatch, auditModule.Service),
+		UserHandler:    user.NewModule(database, authModule.Service, authModule.Service, auditModule.Service, cfg.WebServer.RequireIfMatch),
+		AuditHandler:   auditModule.Handler,
 		HealthHandler:  health.NewModule(database),
 	}
 }
@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"rest_api_poc/internal/shared/appError"
+	"rest_api_poc/internal/shared/httpUtils"
+	"strconv"
+	"time"
+)
+
+// exportFlushEvery controls how many NDJSON lines are buffered before flushing to the client
+const exportFlushEvery = 100
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(s Service) *Handler {
+	return &Handler{service: s}
+}
+
+// ListEvents returns a page of audit events
+// Query: actor_id, action, target_type, target_id, from, to (RFC 3339), cursor, limit
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context() // Extract context from request
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.service.ListEvents(ctx, filter)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return appError.Validation("Invalid cursor", err)
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.WriteJson(w, http.StatusOK, page)
+	return nil
+}
+
+// ExportEvents streams every matching audit event as newline-delimited JSON.
+// Accepts the same filters as ListEvents; limit is ignored.
+func (h *Handler) ExportEvents(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context() // Extract context from request
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	written := 0
+	writeHeader := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	err = h.service.ExportEvents(ctx, filter, func(e *Event) error {
+		if written == 0 {
+			writeHeader()
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if written == 0 {
+			if errors.Is(err, ErrInvalidCursor) {
+				return appError.Validation("Invalid cursor", err)
+			}
+			return appError.Internal(err)
+		}
+		// The status line is gone already; the client sees a truncated stream
+		httpUtils.LogOnly(r, appError.Internal(err))
+		return nil
+	}
+
+	if written == 0 {
+		writeHeader()
+	}
+	return nil
+}
+
+// parseFilter reads the audit filters from the query string
+func parseFilter(r *http.Request) (*Filter, error) {
+	q := r.URL.Query()
+	f := &Filter{
+		ActorID:    q.Get("actor_id"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		Cursor:     q.Get("cursor"),
+	}
+
+	if f.ActorID != "" && !uuidPattern.MatchString(f.ActorID) {
+		return nil, appError.Validation("actor_id must be a UUID", nil)
+	}
+	if f.TargetID != "" && !uuidPattern.MatchString(f.TargetID) {
+		return nil, appError.Validation("target_id must be a UUID", nil)
+	}
+
+	for name, dst := range map[string]**time.Time{"from": &f.From, "to": &f.To} {
+		raw := q.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, appError.Validation(name+" must be an RFC 3339 timestamp", err)
+		}
+		*dst = &t
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, appError.Validation("from must be before to", nil)
+	}
+
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, appError.Validation("limit must be a positive integer", err)
+		}
+		f.Limit = limit
+	}
+
+	return f, nil
+}
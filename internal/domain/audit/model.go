@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// PermissionRead grants access to the audit log.
+// Declared here because auth imports this package; auth.PermissionAuditRead refers to it.
+const PermissionRead = "audit:read"
+
+// Actions recorded in the audit log
+const (
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionPasswordChanged = "auth.password_changed"
+	ActionPasswordReset   = "auth.password_reset"
+
+	ActionUserBlocked   = "user.blocked"
+	ActionUserUnblocked = "user.unblocked"
+	ActionUserUnlocked  = "user.unlocked"
+	ActionUserCreated   = "user.created"
+	ActionUserUpdated   = "user.updated"
+	ActionUserDeleted   = "user.deleted"
+
+	ActionSessionRevoked     = "session.revoked"
+	ActionSessionsRevokedAll = "session.revoked_all"
+
+	ActionImpersonationStarted = "impersonation.started"
+	ActionImpersonationEnded   = "impersonation.ended"
+
+	ActionProductCreated  = "product.created"
+	ActionProductUpdated  = "product.updated"
+	ActionProductDeleted  = "product.deleted"
+	ActionProductRestored = "product.restored"
+	ActionProductPurged   = "product.purged"
+)
+
+// Target types of audited resources
+const (
+	TargetUser          = "user"
+	TargetSession       = "session"
+	TargetProduct       = "product"
+	TargetImpersonation = "impersonation"
+)
+
+// Event is one entry of the audit log.
+// ActorID is empty for anonymous actions (e.g. failed logins) and system actions.
+type Event struct {
+	ID             string            `json:"id"`
+	ActorID        string            `json:"actor_id,omitempty"`
+	ImpersonatorID string            `json:"impersonator_id,omitempty"`
+	Action         string            `json:"action"`
+	TargetType     string            `json:"target_type"`
+	TargetID       string            `json:"target_id,omitempty"`
+	Changes        map[string]Change `json:"changes,omitempty"`
+	Metadata       map[string]any    `json:"metadata,omitempty"`
+	IPAddress      string            `json:"ip_address,omitempty"`
+	UserAgent      string            `json:"user_agent,omitempty"`
+	RequestID      string            `json:"request_id,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// Change is the value of one field before and after an action
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Filter narrows the audit log; zero values match everything
+type Filter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Cursor     string
+	Limit      int
+}
+
+// EventPage is one page of audit events, newest first.
+// NextCursor is empty on the last page.
+type EventPage struct {
+	Data       []*Event `json:"data"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// Diff compares two values by their JSON representation and returns the fields that differ.
+// Either side may be nil (creation or deletion). Fields hidden from JSON never appear.
+func Diff(before, after any) map[string]Change {
+	b := toFields(before)
+	a := toFields(after)
+
+	changes := make(map[string]Change)
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(bv, av) {
+			changes[k] = Change{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{Before: nil, After: av}
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func toFields(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,20 @@
+package audit
+
+import "rest_api_poc/internal/infra/db"
+
+// Module encapsulates the audit log dependencies.
+// Service is shared with the other domains as their Recorder.
+type Module struct {
+	Handler *Handler
+	Service Service
+}
+
+// NewModule creates a new audit module with all dependencies
+func NewModule(database db.DB) *Module {
+	repo := NewRepository(database)
+	svc := NewService(repo)
+	return &Module{
+		Handler: NewHandler(svc),
+		Service: svc,
+	}
+}
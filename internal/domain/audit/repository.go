@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rest_api_poc/internal/infra/db"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+type Repository interface {
+	CreateEvent(ctx context.Context, e *Event) error
+	ListEvents(ctx context.Context, f *Filter) (*EventPage, error)
+	ExportEvents(ctx context.Context, f *Filter, fn func(*Event) error) error
+}
+
+type repository struct {
+	db db.DB
+}
+
+// NewRepository creates a new audit repository with database dependency
+func NewRepository(database db.DB) Repository {
+	return &repository{db: database}
+}
+
+const eventColumns = `id, COALESCE(actor_id::text, ''), COALESCE(impersonator_id::text, ''), action, target_type,
+	COALESCE(target_id::text, ''), changes, metadata, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+	COALESCE(request_id, ''), created_at`
+
+func (r *repository) CreateEvent(ctx context.Context, e *Event) error {
+	var changesJSON, metadataJSON []byte
+	var err error
+	if len(e.Changes) > 0 {
+		if changesJSON, err = json.Marshal(e.Changes); err != nil {
+			return fmt.Errorf("failed to marshal audit changes: %w", err)
+		}
+	}
+	if len(e.Metadata) > 0 {
+		if metadataJSON, err = json.Marshal(e.Metadata); err != nil {
+			return fmt.Errorf("failed to marshal audit metadata: %w", err)
+		}
+	}
+
+	err = r.db.Pool().QueryRow(ctx,
+		`INSERT INTO audit_events (actor_id, impersonator_id, action, target_type, target_id, changes, metadata, ip_address, user_agent, request_id)
+		 VALUES (NULLIF($1, '')::uuid, NULLIF($2, '')::uuid, $3, $4, NULLIF($5, '')::uuid, $6, $7, NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''))
+		 RETURNING id, created_at`,
+		e.ActorID, e.ImpersonatorID, e.Action, e.TargetType, e.TargetID,
+		changesJSON, metadataJSON, e.IPAddress, e.UserAgent, e.RequestID,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+
+	return nil
+}
+
+// ListEvents returns one page of events matching the filter, newest first.
+// Pages are keyset paginated on (created_at, id), so concurrent inserts never shift them.
+func (r *repository) ListEvents(ctx context.Context, f *Filter) (*EventPage, error) {
+	where, args, err := buildWhere(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to know whether another page follows
+	args = append(args, f.Limit+1)
+	query := fmt.Sprintf("SELECT %s FROM audit_events %s ORDER BY created_at DESC, id DESC LIMIT $%d",
+		eventColumns, where, len(args))
+
+	rows, err := r.db.Pool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	page := &EventPage{Data: []*Event{}}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Data = append(page.Data, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	if len(page.Data) > f.Limit {
+		page.Data = page.Data[:f.Limit]
+		last := page.Data[len(page.Data)-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// ExportEvents streams every event matching the filter to fn, newest first.
+// The cursor is honoured, the limit is not. Iteration stops at the first error fn returns.
+func (r *repository) ExportEvents(ctx context.Context, f *Filter, fn func(*Event) error) error {
+	where, args, err := buildWhere(f)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM audit_events %s ORDER BY created_at DESC, id DESC", eventColumns, where)
+
+	rows, err := r.db.Pool().Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export audit events: %w", err)
+	}
+
+	return nil
+}
+
+func buildWhere(f *Filter) (string, []any, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.ActorID != "" {
+		add("actor_id = $%d::uuid", f.ActorID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d::uuid", f.TargetID)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if f.Cursor != "" {
+		createdAt, id, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, createdAt, id)
+		conds = append(conds, fmt.Sprintf("(created_at, id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+func scanEvent(row pgx.Row) (*Event, error) {
+	e := &Event{}
+	var changesJSON, metadataJSON []byte
+	if err := row.Scan(
+		&e.ID, &e.ActorID, &e.ImpersonatorID, &e.Action, &e.TargetType,
+		&e.TargetID, &changesJSON, &metadataJSON, &e.IPAddress, &e.UserAgent,
+		&e.RequestID, &e.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan audit event: %w", err)
+	}
+
+	if len(changesJSON) > 0 {
+		if err := json.Unmarshal(changesJSON, &e.Changes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit changes: %w", err)
+		}
+	}
+	if len(metadataJSON) > 0 {
+		if err := json.Unmarshal(metadataJSON, &e.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit metadata: %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+// encodeCursor makes an opaque cursor pointing just past the given event
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	return createdAt, id, nil
+}
@@ -0,0 +1,31 @@
+package audit
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RoleMiddleware interface to avoid circular dependency
+type RoleMiddleware interface {
+	RequirePermission(permissions ...string) func(http.Handler) http.Handler
+}
+
+// RateLimiter interface to avoid circular dependency
+type RateLimiter interface {
+	User() func(http.Handler) http.Handler
+}
+
+// RegisterRoutes registers the audit log routes
+//
+//	GET /v1/audit        - List audit events, filterable and cursor paginated (audit:read)
+//	GET /v1/audit/export - Export matching audit events as NDJSON (audit:read)
+func RegisterRoutes(r chi.Router, h *Handler, roleMiddleware RoleMiddleware, rateLimiter RateLimiter, wrap func(func(http.ResponseWriter, *http.Request) error) http.HandlerFunc) {
+	r.Route("/v1/audit", func(rr chi.Router) {
+		rr.Use(rateLimiter.User())
+		rr.Use(roleMiddleware.RequirePermission(PermissionRead))
+
+		rr.Get("/", wrap(h.ListEvents))         // GET /v1/audit - List
+		rr.Get("/export", wrap(h.ExportEvents)) // GET /v1/audit/export - Export
+	})
+}
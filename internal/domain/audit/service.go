@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"rest_api_poc/internal/shared/httpUtils"
+	"rest_api_poc/internal/shared/logger"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Recorder records audit events.
+// Recording is best-effort: failures are logged and never fail the audited action.
+type Recorder interface {
+	Record(ctx context.Context, e *Event)
+}
+
+// Service defines the business logic interface for the audit log
+type Service interface {
+	Recorder
+	ListEvents(ctx context.Context, f *Filter) (*EventPage, error)
+	ExportEvents(ctx context.Context, f *Filter, fn func(*Event) error) error
+}
+
+type service struct {
+	repo Repository
+}
+
+// NewService creates a new audit service with repository dependency
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+// Record stores an event. Anything the caller left empty is taken from the request context:
+// the actor (and impersonator) set by the auth middleware, and IP, user agent and request ID.
+func (s *service) Record(ctx context.Context, e *Event) {
+	if userCtx := httpUtils.UserContextFrom(ctx); userCtx != nil {
+		if e.ActorID == "" {
+			e.ActorID = userCtx.ID
+		}
+		if e.ImpersonatorID == "" && e.ActorID == userCtx.ID {
+			e.ImpersonatorID = userCtx.ImpersonatorID
+		}
+	}
+	if info := httpUtils.RequestInfoFrom(ctx); info != nil {
+		if e.IPAddress == "" {
+			e.IPAddress = info.IPAddress
+		}
+		if e.UserAgent == "" {
+			e.UserAgent = info.UserAgent
+		}
+		if e.RequestID == "" {
+			e.RequestID = info.RequestID
+		}
+	}
+
+	// The action already happened; a client disconnecting must not lose its record
+	if err := s.repo.CreateEvent(context.WithoutCancel(ctx), e); err != nil {
+		logger.Error("failed to record audit event %s on %s %s: %v", e.Action, e.TargetType, e.TargetID, err)
+	}
+}
+
+// ListEvents returns one page of the audit log, newest first
+// Context flows from handler → service → repository for proper cancellation
+func (s *service) ListEvents(ctx context.Context, f *Filter) (*EventPage, error) {
+	switch {
+	case f.Limit <= 0:
+		f.Limit = defaultPageSize
+	case f.Limit > maxPageSize:
+		f.Limit = maxPageSize
+	}
+	return s.repo.ListEvents(ctx, f)
+}
+
+// ExportEvents streams every matching event to fn, newest first
+// Context flows from handler → service → repository for proper cancellation
+func (s *service) ExportEvents(ctx context.Context, f *Filter, fn func(*Event) error) error {
+	return s.repo.ExportEvents(ctx, f, fn)
+}
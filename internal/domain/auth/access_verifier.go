@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rest_api_poc/internal/shared/logger"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AccessVerifier performs the revocation checks behind a validly signed token: its session must
+// still be active and its user neither blocked nor inactive. AuthMiddleware and token introspection
+// share it so that other services see exactly the state this API enforces.
+type AccessVerifier struct {
+	repo     *Repository
+	cache    AuthCache
+	cacheTTL time.Duration
+	activity *SessionActivity
+}
+
+// NewAccessVerifier defaults a non-positive cacheTTL to one hour.
+// activity may be nil, in which case the idle timeout is not enforced.
+func NewAccessVerifier(repo *Repository, cache AuthCache, cacheTTL time.Duration, activity *SessionActivity) *AccessVerifier {
+	if cacheTTL <= 0 {
+		cacheTTL = time.Hour
+	}
+	return &AccessVerifier{
+		repo:     repo,
+		cache:    cache,
+		cacheTTL: cacheTTL,
+		activity: activity,
+	}
+}
+
+// IsAccessRevoked reports whether err is a verification refusal rather than an infrastructure failure
+func IsAccessRevoked(err error) bool {
+	return errors.Is(err, ErrInvalidToken) ||
+		errors.Is(err, ErrSessionNotFound) ||
+		errors.Is(err, ErrSessionInactive) ||
+		errors.Is(err, ErrSessionExpired) ||
+		errors.Is(err, ErrSessionIdle) ||
+		errors.Is(err, ErrUserBlocked) ||
+		errors.Is(err, ErrInvalidClient)
+}
+
+// VerifyAccessToken checks the state behind validated access token claims and returns the user.
+// Client credentials tokens have no session; their credential must still be active instead.
+// Impersonation tokens are bound to their impersonation record.
+func (v *AccessVerifier) VerifyAccessToken(ctx context.Context, claims *AccessTokenClaims) (*CachedUser, error) {
+	if claims.ClientID != "" {
+		credential, err := v.repo.GetActiveClientCredential(ctx, claims.ClientID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrInvalidClient
+			}
+			return nil, err
+		}
+		if credential.UserID != claims.UserID {
+			return nil, ErrInvalidToken
+		}
+	} else if claims.ImpersonationID != "" {
+		if err := v.verifyImpersonation(ctx, claims); err != nil {
+			return nil, err
+		}
+	} else if err := v.VerifySession(ctx, claims.SessionID, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	return v.LoadUser(ctx, claims.UserID)
+}
+
+// verifyImpersonation checks that an impersonation has not ended and that its actor could still
+// start it: the actor's session must be valid and the actor neither blocked nor stripped of the
+// permission. Impersonations are not cached, so ending one applies to the very next request.
+func (v *AccessVerifier) verifyImpersonation(ctx context.Context, claims *AccessTokenClaims) error {
+	imp, err := v.repo.GetActiveImpersonation(ctx, claims.ImpersonationID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSessionInactive
+		}
+		return err
+	}
+	if imp.TargetID != claims.UserID || imp.ActorID != claims.ImpersonatorID {
+		return ErrInvalidToken
+	}
+
+	if err := v.VerifySession(ctx, imp.ActorSessionID, imp.ActorID); err != nil {
+		return err
+	}
+	actor, err := v.LoadUser(ctx, imp.ActorID)
+	if err != nil {
+		if errors.Is(err, ErrUserBlocked) {
+			// The impersonated user is fine; only the actor lost access
+			return ErrSessionInactive
+		}
+		return err
+	}
+	for _, p := range actor.Permissions {
+		if p == PermissionUsersImpersonate {
+			return nil
+		}
+	}
+	return ErrSessionInactive
+}
+
+// VerifySession checks that a session is active, not expired, not idle and belongs to userID
+func (v *AccessVerifier) VerifySession(ctx context.Context, sessionID, userID string) error {
+	now := time.Now()
+
+	var sessionUserID string
+	if v.cache != nil {
+		if cs, ok, err := v.cache.GetSession(ctx, sessionID); err != nil {
+			logger.Warn("auth cache session get failed: %v", err)
+		} else if ok && cs != nil {
+			if !cs.IsActive || (!cs.ExpiresAt.IsZero() && now.After(cs.ExpiresAt)) {
+				// Best-effort cleanup
+				_ = v.cache.DelSession(ctx, sessionID)
+				return ErrSessionInactive
+			}
+			if v.isIdle(sessionID, cs.LastActivityAt, now) {
+				// The cached activity may be older than another instance's last write;
+				// drop the entry and let the database decide whether the session ended
+				_ = v.cache.DelSession(ctx, sessionID)
+			} else {
+				sessionUserID = cs.UserID
+			}
+		}
+	}
+	if sessionUserID == "" {
+		session, err := v.repo.GetSessionByID(ctx, sessionID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		if !session.IsActive {
+			return ErrSessionInactive
+		}
+		if now.After(session.ExpiresAt) {
+			return ErrSessionExpired
+		}
+		if v.isIdle(sessionID, session.LastActivityAt, now) {
+			v.endIdleSession(ctx, sessionID)
+			return ErrSessionIdle
+		}
+		sessionUserID = session.UserID
+
+		// Populate cache (best-effort)
+		if v.cache != nil {
+			ttl := v.cacheTTL
+			if until := time.Until(session.ExpiresAt); until > 0 && until < ttl {
+				ttl = until
+			}
+			_ = v.cache.SetSession(ctx, sessionID, &CachedSession{
+				UserID:         session.UserID,
+				IsActive:       session.IsActive,
+				ExpiresAt:      session.ExpiresAt,
+				LastActivityAt: session.LastActivityAt,
+			}, ttl)
+		}
+	}
+
+	// Session and token must agree on user id.
+	if sessionUserID != userID {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (v *AccessVerifier) isIdle(sessionID string, lastActivityAt, now time.Time) bool {
+	return v.activity != nil && v.activity.IsIdle(sessionID, lastActivityAt, now)
+}
+
+// endIdleSession deactivates a session that went idle so it drops out of session lists (best-effort)
+func (v *AccessVerifier) endIdleSession(ctx context.Context, sessionID string) {
+	if err := v.repo.InvalidateSession(ctx, sessionID); err != nil {
+		logger.Warn("failed to end idle session %s: %v", sessionID, err)
+	}
+	if v.cache != nil {
+		_ = v.cache.DelSession(ctx, sessionID)
+	}
+	logger.Info("Session %s ended after inactivity", sessionID)
+}
+
+// LoadUser returns the user's role, permissions and account state from cache or DB,
+// refusing blocked or inactive accounts.
+func (v *AccessVerifier) LoadUser(ctx context.Context, userID string) (*CachedUser, error) {
+	var cached *CachedUser
+	if v.cache != nil {
+		if cu, ok, err := v.cache.GetUser(ctx, userID); err != nil {
+			logger.Warn("auth cache user get failed: %v", err)
+		} else if ok && cu != nil && cu.Permissions != nil {
+			cached = cu
+		}
+	}
+	if cached == nil {
+		user, err := v.repo.GetUserByID(ctx, userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrInvalidToken
+			}
+			return nil, err
+		}
+		permissions, err := v.repo.GetUserPermissions(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get permissions: %w", err)
+		}
+		cached = &CachedUser{
+			Email:       user.Email,
+			Role:        user.Role,
+			Permissions: permissions,
+			IsActive:    user.IsActive,
+			IsBlocked:   user.IsBlocked,
+		}
+
+		// Populate cache (best-effort)
+		if v.cache != nil {
+			_ = v.cache.SetUser(ctx, userID, cached, v.cacheTTL)
+		}
+	}
+
+	if !cached.IsActive || cached.IsBlocked {
+		return nil, ErrUserBlocked
+	}
+
+	return cached, nil
+}
@@ -0,0 +1,38 @@
+package auth
+
+import "fmt"
+
+const (
+	// apiKeyPrefix makes keys recognisable in logs and secret scanners
+	apiKeyPrefix = "ak_"
+	// apiKeyDisplayLength is how much of a key is stored in clear to help users tell keys apart
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+)
+
+// GenerateAPIKey creates a new random API key and its displayable prefix.
+// Only HashToken(key) is stored, like refresh tokens.
+func GenerateAPIKey() (key, displayPrefix string, err error) {
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key = apiKeyPrefix + token
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// ScopedPermissions narrows the user's current permissions to the key's scopes.
+// Scopes that the user has lost since the key was created grant nothing.
+func ScopedPermissions(userPermissions, scopes []string) []string {
+	allowed := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		allowed[scope] = true
+	}
+
+	permissions := []string{}
+	for _, p := range userPermissions {
+		if allowed[p] {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
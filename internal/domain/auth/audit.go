@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"rest_api_poc/internal/domain/audit"
+	"rest_api_poc/internal/shared/httpUtils"
+)
+
+// recordAudit adds an event to the audit log.
+// Like notifications, this is best-effort and never fails the calling flow.
+func (s *Service) recordAudit(ctx context.Context, e *audit.Event) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Record(ctx, e)
+}
+
+// recordLoginFailure audits a rejected login factor. userID is empty when the account is unknown.
+func (s *Service) recordLoginFailure(ctx context.Context, userID, email, factor string, r *http.Request) {
+	s.recordAudit(ctx, &audit.Event{
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Metadata: map[string]any{
+			"email":  email,
+			"factor": factor,
+		},
+		IPAddress: httpUtils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+}
+
+// recordUserAction audits an action taken by actorID against another user's account
+func (s *Service) recordUserAction(ctx context.Context, action, actorID, userID string) {
+	s.recordAudit(ctx, &audit.Event{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+}
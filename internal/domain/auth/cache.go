@@ -18,14 +18,18 @@ type AuthCache interface {
 }
 
 type CachedSession struct {
-	UserID    string    `json:"user_id"`
-	IsActive  bool      `json:"is_active"`
-	ExpiresAt time.Time `json:"expires_at"`
+	UserID         string    `json:"user_id"`
+	IsActive       bool      `json:"is_active"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	LastActivityAt time.Time `json:"last_activity_at"` // as of caching; may be stale
 }
 
+// CachedUser holds the resolved permission set of the user's role.
+// Permissions is never nil once resolved; a nil set comes from an older cache entry and must be reloaded.
 type CachedUser struct {
-	Email     string `json:"email"`
-	Role      string `json:"role"`
-	IsActive  bool   `json:"is_active"`
-	IsBlocked bool   `json:"is_blocked"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	IsActive    bool     `json:"is_active"`
+	IsBlocked   bool     `json:"is_blocked"`
 }
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Minimal CBOR (RFC 8949) decoder for WebAuthn attestation objects and COSE keys.
+// Authenticators emit definite-length CTAP2 canonical CBOR, so indefinite lengths and tags
+// are rejected, as are floats. Integers decode to int64, byte strings to []byte, maps to map[any]any.
+
+var errInvalidCBOR = errors.New("invalid CBOR")
+
+const cborMaxDepth = 16
+
+// decodeCBOR decodes one data item and returns it together with the remaining bytes
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("%w: nesting too deep", errInvalidCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// Only false, true, null and undefined occur in WebAuthn data; floats are rejected
+	if major == 7 {
+		return decodeCBORSimple(info, data[1:])
+	}
+
+	arg, rest, err := decodeCBORArgument(info, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // unsigned integer
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errInvalidCBOR)
+		}
+		return int64(arg), rest, nil
+	case 1: // negative integer, -1 - arg
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errInvalidCBOR)
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3: // byte string, text string
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: string exceeds data", errInvalidCBOR)
+		}
+		value := rest[:arg]
+		if major == 3 {
+			return string(value), rest[arg:], nil
+		}
+		return append([]byte(nil), value...), rest[arg:], nil
+	case 4: // array
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: array exceeds data", errInvalidCBOR)
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item any
+			if item, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5: // map
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w: map exceeds data", errInvalidCBOR)
+		}
+		entries := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value any
+			if key, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key type", errInvalidCBOR)
+			}
+			if value, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+		}
+		return entries, rest, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: unsupported major type %d", errInvalidCBOR, major)
+}
+
+// decodeCBORArgument reads the length or value that follows the initial byte
+func decodeCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, nil, fmt.Errorf("%w: indefinite or reserved length", errInvalidCBOR)
+	}
+	if len(data) < size {
+		return 0, nil, fmt.Errorf("%w: unexpected end of data", errInvalidCBOR)
+	}
+
+	switch size {
+	case 1:
+		return uint64(data[0]), data[1:], nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	default:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+}
+
+func decodeCBORSimple(info byte, data []byte) (any, []byte, error) {
+	switch info {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23: // null, undefined
+		return nil, data, nil
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errInvalidCBOR, info)
+}
@@ -0,0 +1,39 @@
+package auth
+
+import "fmt"
+
+const (
+	// GrantTypeClientCredentials is the only OAuth2 grant served by the token endpoint
+	GrantTypeClientCredentials = "client_credentials"
+
+	clientIDPrefix      = "sa_"
+	clientSecretPrefix  = "cs_"
+	clientIDRandomChars = 24
+
+	// serviceAccountEmailDomain is reserved (RFC 2606), so service accounts never receive mail
+	serviceAccountEmailDomain = "service-accounts.invalid"
+	defaultServiceAccountRole = "system"
+)
+
+// GenerateClientCredentials creates a public client ID and its secret.
+// Only HashToken(secret) is stored, like refresh tokens.
+func GenerateClientCredentials() (clientID, clientSecret string, err error) {
+	idToken, err := GenerateSecureToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	secret, err := GenerateSecureToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate client secret: %w", err)
+	}
+	return clientIDPrefix + idToken[:clientIDRandomChars], clientSecretPrefix + secret, nil
+}
+
+// serviceAccountEmail builds the unique placeholder address required by the users table
+func serviceAccountEmail() (string, error) {
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	return "sa-" + token[:16] + "@" + serviceAccountEmailDomain, nil
+}
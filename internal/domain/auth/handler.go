@@ -1,29 +1,59 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"rest_api_poc/internal/infra/config"
 	"rest_api_poc/internal/shared/appError"
 	"rest_api_poc/internal/shared/httpUtils"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// oidcStateCookie carries the state of a pending external login or link to the callback
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/v1/auth/oidc"
+)
+
 type Handler struct {
 	service *Service
 	config  *config.Config
 }
 
 func mapLoginError(err error) error {
-	// Never leak account state. Treat all login denials as invalid credentials.
-	if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUserNotActive) || errors.Is(err, ErrUserBlocked) {
+	// Never leak account state. Treat all login denials (including lockouts) as invalid credentials.
+	if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrUserNotActive) || errors.Is(err, ErrUserBlocked) ||
+		errors.Is(err, ErrAccountLocked) {
 		return appError.Authentication("Invalid email or password", err)
 	}
+	// IP throttling says nothing about the account, so it can be explicit.
+	if errors.Is(err, ErrTooManyAttempts) {
+		return appError.RateLimited("Too many failed attempts, please try again later", err)
+	}
+	// Only reachable with the correct password, so the account state may be revealed.
+	if errors.Is(err, ErrEmailNotVerified) {
+		return appError.Authorization("Email address has not been verified", err)
+	}
 	return appError.Internal(err)
 }
 
+// mapPasswordPolicyError reports every failed password rule to the client
+func mapPasswordPolicyError(err error) (error, bool) {
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return nil, false
+	}
+	return appError.WithDetails(
+		appError.Validation("Password does not meet the password policy", err),
+		map[string]any{"violations": policyErr.Violations},
+	), true
+}
+
 func NewHandler(service *Service, cfg *config.Config) *Handler {
 	return &Handler{
 		service: service,
@@ -53,6 +83,12 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) error {
 		return mapLoginError(err)
 	}
 
+	// Second factor pending: no session yet, only the challenge token
+	if response.MFARequired {
+		httpUtils.RespondWithJSON(w, http.StatusOK, response)
+		return nil
+	}
+
 	// Set cookies
 	h.setAccessTokenCookie(w, accessToken)
 	h.setRefreshTokenCookie(w, refreshToken)
@@ -83,6 +119,9 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) error {
 		if errors.Is(err, ErrEmailAlreadyExists) {
 			return appError.Conflict("Email already exists", err)
 		}
+		if policyErr, ok := mapPasswordPolicyError(err); ok {
+			return policyErr
+		}
 		return appError.Internal(err)
 	}
 
@@ -127,6 +166,9 @@ func (h *Handler) VerifyPasswordReset(w http.ResponseWriter, r *http.Request) er
 		if errors.Is(err, ErrInvalidOTP) {
 			return appError.Validation("Invalid or expired OTP", err)
 		}
+		if policyErr, ok := mapPasswordPolicyError(err); ok {
+			return policyErr
+		}
 		return appError.Internal(err)
 	}
 
@@ -136,6 +178,436 @@ func (h *Handler) VerifyPasswordReset(w http.ResponseWriter, r *http.Request) er
 	return nil
 }
 
+// VerifyEmail confirms an email address with the token from the verification email
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	var req EmailVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Token == "" {
+		return appError.Validation("Token is required", nil)
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		if errors.Is(err, ErrInvalidVerifyToken) {
+			return appError.Validation("Invalid or expired verification token", err)
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Email verified successfully",
+	})
+	return nil
+}
+
+// ResendVerification sends a new verification email
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) error {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Email == "" {
+		return appError.Validation("Email is required", nil)
+	}
+
+	if err := h.service.ResendVerification(r.Context(), req.Email); err != nil {
+		// Intentionally do not error to avoid leaking system state; log internally.
+		httpUtils.LogOnly(r, appError.Internal(err))
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "If the email exists and is not verified yet, a verification email has been sent",
+	})
+	return nil
+}
+
+// StartPasswordless emails a sign-in code or link
+func (h *Handler) StartPasswordless(w http.ResponseWriter, r *http.Request) error {
+	var req PasswordlessStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Email == "" {
+		return appError.Validation("Email is required", nil)
+	}
+
+	if err := h.service.StartPasswordlessLogin(r.Context(), req.Email); err != nil {
+		// Intentionally do not error to avoid leaking system state; log internally.
+		httpUtils.LogOnly(r, appError.Internal(err))
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "If the email exists, a sign-in code has been sent",
+	})
+	return nil
+}
+
+// VerifyPasswordless completes a passwordless login with the emailed code or link token
+func (h *Handler) VerifyPasswordless(w http.ResponseWriter, r *http.Request) error {
+	var req PasswordlessVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Token == "" && (req.Email == "" || req.Code == "") {
+		return appError.Validation("Email and code, or token, are required", nil)
+	}
+
+	response, accessToken, refreshToken, err := h.service.VerifyPasswordlessLogin(r.Context(), &req, r)
+	if err != nil {
+		if errors.Is(err, ErrInvalidLoginCode) {
+			return appError.Authentication("Invalid or expired sign-in code", err)
+		}
+		return mapLoginError(err)
+	}
+
+	// Second factor pending: no session yet, only the challenge token
+	if response.MFARequired {
+		httpUtils.RespondWithJSON(w, http.StatusOK, response)
+		return nil
+	}
+
+	h.setAccessTokenCookie(w, accessToken)
+	h.setRefreshTokenCookie(w, refreshToken)
+
+	response.AccessToken = accessToken
+	response.RefreshToken = refreshToken
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// VerifyMFA completes a login that was answered with an MFA challenge
+func (h *Handler) VerifyMFA(w http.ResponseWriter, r *http.Request) error {
+	var req MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "" && req.Passkey == nil) {
+		return appError.Validation("MFA token and a code, recovery code or passkey are required", nil)
+	}
+
+	response, accessToken, refreshToken, err := h.service.VerifyMFALogin(r.Context(), &req, r)
+	if err != nil {
+		// Never leak which part of the challenge failed.
+		if errors.Is(err, ErrExpiredToken) ||
+			errors.Is(err, ErrInvalidToken) ||
+			errors.Is(err, ErrInvalidMFACode) ||
+			errors.Is(err, ErrMFANotEnrolled) {
+			return appError.Authentication("Invalid or expired MFA code", err)
+		}
+		return mapLoginError(err)
+	}
+
+	h.setAccessTokenCookie(w, accessToken)
+	h.setRefreshTokenCookie(w, refreshToken)
+
+	response.AccessToken = accessToken
+	response.RefreshToken = refreshToken
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// StartMFAPasskey returns passkey request options for answering an MFA challenge
+func (h *Handler) StartMFAPasskey(w http.ResponseWriter, r *http.Request) error {
+	var req MFAPasskeyOptionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.MFAToken == "" {
+		return appError.Validation("MFA token is required", nil)
+	}
+
+	options, err := h.service.StartMFAPasskey(r.Context(), req.MFAToken)
+	if err != nil {
+		if errors.Is(err, ErrExpiredToken) || errors.Is(err, ErrInvalidToken) {
+			return appError.Authentication("Invalid or expired MFA token", err)
+		}
+		return mapPasskeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, options)
+	return nil
+}
+
+// StartPasskeyLogin returns request options for signing in with a passkey
+func (h *Handler) StartPasskeyLogin(w http.ResponseWriter, r *http.Request) error {
+	var req PasskeyLoginStartRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return appError.Validation("Invalid request body", err)
+		}
+	}
+
+	options, err := h.service.StartPasskeyLogin(r.Context(), req.StaySignedIn)
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, options)
+	return nil
+}
+
+// FinishPasskeyLogin completes a passkey sign-in and creates a session
+func (h *Handler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) error {
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	response, accessToken, refreshToken, err := h.service.FinishPasskeyLogin(r.Context(), &req, r)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPasskey) {
+			return appError.Authentication("Passkey sign-in failed", err)
+		}
+		return mapLoginError(err)
+	}
+
+	h.setAccessTokenCookie(w, accessToken)
+	h.setRefreshTokenCookie(w, refreshToken)
+
+	response.AccessToken = accessToken
+	response.RefreshToken = refreshToken
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// JWKS publishes the public keys for verifying access tokens
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	httpUtils.RespondWithJSON(w, http.StatusOK, h.service.JWKS())
+	return nil
+}
+
+// ListOIDCProviders returns the external providers users can log in with
+func (h *Handler) ListOIDCProviders(w http.ResponseWriter, r *http.Request) error {
+	httpUtils.RespondWithJSON(w, http.StatusOK, h.service.ListOIDCProviders())
+	return nil
+}
+
+// StartOIDCLogin returns the provider URL that starts an external login
+func (h *Handler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) error {
+	var req OIDCAuthorizeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return appError.Validation("Invalid request body", err)
+		}
+	}
+
+	response, err := h.service.StartOIDCLogin(r.Context(), chi.URLParam(r, "provider"), req.StaySignedIn)
+	if err != nil {
+		return mapOIDCError(err)
+	}
+
+	h.setOIDCStateCookie(w, response.State)
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// OIDCCallback receives the provider redirect and completes a login or an account link
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		return appError.Authentication("Sign-in was cancelled or denied by the provider", fmt.Errorf("provider error: %s", query.Get("error")))
+	}
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		return appError.Validation("code and state are required", nil)
+	}
+
+	// The flow must finish in the browser that started it, otherwise a forged callback
+	// could sign the victim into the attacker's account or link the attacker's identity
+	cookie, err := r.Cookie(oidcStateCookie)
+	h.clearOIDCStateCookie(w)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return mapOIDCError(ErrInvalidOIDCState)
+	}
+
+	result, err := h.service.CompleteOIDC(r.Context(), chi.URLParam(r, "provider"), code, state, r)
+	if err != nil {
+		return mapOIDCError(err)
+	}
+
+	if result.Identity != nil {
+		httpUtils.RespondWithJSON(w, http.StatusOK, result.Identity)
+		return nil
+	}
+
+	// Second factor pending: no session yet, only the challenge token
+	response := result.Login
+	if response.MFARequired {
+		httpUtils.RespondWithJSON(w, http.StatusOK, response)
+		return nil
+	}
+
+	h.setAccessTokenCookie(w, result.AccessToken)
+	h.setRefreshTokenCookie(w, result.RefreshToken)
+
+	response.AccessToken = result.AccessToken
+	response.RefreshToken = result.RefreshToken
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// Token is the OAuth2 token endpoint (RFC 6749 section 4.4). Only the client credentials
+// grant is supported; service accounts authenticate with HTTP Basic or form parameters.
+// Errors use the OAuth2 format rather than the API error envelope so standard clients understand them.
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Request body must be form encoded")
+		return nil
+	}
+	if grantType := r.PostForm.Get("grant_type"); grantType != GrantTypeClientCredentials {
+		if grantType == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+			return nil
+		}
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+		return nil
+	}
+
+	clientID, clientSecret, ok := clientCredentials(w, r)
+	if !ok {
+		return nil
+	}
+
+	token, err := h.service.IssueClientToken(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidClient):
+			writeInvalidClient(w)
+			return nil
+		case errors.Is(err, ErrInvalidScope):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return nil
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, token)
+	return nil
+}
+
+// Introspect reports whether an access or refresh token is active (RFC 7662).
+// Callers are services whose client credential holds the tokens:introspect scope.
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Request body must be form encoded")
+		return nil
+	}
+	clientID, clientSecret, ok := clientCredentials(w, r)
+	if !ok {
+		return nil
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return nil
+	}
+
+	// token_type_hint is optional and not needed: both token types are tried
+	response, err := h.service.IntrospectToken(r.Context(), clientID, clientSecret, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidClient):
+			writeInvalidClient(w)
+			return nil
+		case errors.Is(err, ErrInsufficientScope):
+			writeInsufficientScope(w, PermissionTokensIntrospect)
+			return nil
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// Revoke ends the session behind an access or refresh token (RFC 7009).
+// Callers are services whose client credential holds the tokens:revoke scope.
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Request body must be form encoded")
+		return nil
+	}
+	clientID, clientSecret, ok := clientCredentials(w, r)
+	if !ok {
+		return nil
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return nil
+	}
+
+	if err := h.service.RevokeToken(r.Context(), clientID, clientSecret, token); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidClient):
+			writeInvalidClient(w)
+			return nil
+		case errors.Is(err, ErrInsufficientScope):
+			writeInsufficientScope(w, PermissionTokensRevoke)
+			return nil
+		case errors.Is(err, ErrUnsupportedTokenType):
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_token_type", "Client credentials tokens cannot be revoked; revoke the client credential instead")
+			return nil
+		}
+		return appError.Internal(err)
+	}
+
+	// RFC 7009: the response is the same whether or not the token was valid
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// clientCredentials reads the client ID and secret from HTTP Basic auth or the form body.
+// It writes an invalid_client response and returns false when they are missing.
+func clientCredentials(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication is required")
+		return "", "", false
+	}
+	return clientID, clientSecret, true
+}
+
+func writeInvalidClient(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+// writeInsufficientScope refuses an authenticated client whose credential lacks the scope (RFC 6750 section 3.1)
+func writeInsufficientScope(w http.ResponseWriter, scope string) {
+	writeOAuthError(w, http.StatusForbidden, "insufficient_scope", "Client credential requires the "+scope+" scope")
+}
+
+// writeOAuthError writes an OAuth2 error response (RFC 6749 section 5.2)
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	httpUtils.RespondWithJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
 // -------------------------
 // Protected Endpoints
 // -------------------------
@@ -162,15 +634,17 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// Refresh tokens
-	newAccessToken, newRefreshToken, err := h.service.Refresh(r.Context(), refreshToken)
+	newAccessToken, newRefreshToken, err := h.service.Refresh(r.Context(), refreshToken, r)
 	if err != nil {
 		// Never leak refresh failure reasons.
 		if errors.Is(err, ErrExpiredToken) ||
 			errors.Is(err, ErrInvalidToken) ||
 			errors.Is(err, ErrInvalidSignature) ||
 			errors.Is(err, ErrSessionNotFound) ||
+			errors.Is(err, ErrRefreshTokenReused) ||
 			errors.Is(err, ErrSessionInactive) ||
 			errors.Is(err, ErrSessionExpired) ||
+			errors.Is(err, ErrSessionIdle) ||
 			errors.Is(err, ErrUserBlocked) ||
 			errors.Is(err, ErrUserNotActive) {
 			return appError.Authentication("Invalid session", err)
@@ -242,6 +716,14 @@ func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) error {
 		return appError.Internal(err)
 	}
 
+	// Lets clients show who is really acting
+	if userCtx.ImpersonationID != "" {
+		user.Impersonation, err = h.service.GetImpersonationInfo(r.Context(), userCtx.ImpersonationID)
+		if err != nil {
+			return appError.Internal(err)
+		}
+	}
+
 	httpUtils.RespondWithJSON(w, http.StatusOK, user)
 	return nil
 }
@@ -266,6 +748,9 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) error {
 		if errors.Is(err, ErrInvalidCredentials) {
 			return appError.Authentication("Current password is incorrect", err)
 		}
+		if policyErr, ok := mapPasswordPolicyError(err); ok {
+			return policyErr
+		}
 		return appError.Internal(err)
 	}
 
@@ -319,8 +804,401 @@ func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-// -------------------------
-// Admin Endpoints
+// EnrollMFA starts TOTP enrollment for the current user
+func (h *Handler) EnrollMFA(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	enrollment, err := h.service.EnrollMFA(r.Context(), userCtx.ID)
+	if err != nil {
+		if errors.Is(err, ErrMFAAlreadyEnabled) {
+			return appError.Conflict("MFA is already enabled", err)
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, enrollment)
+	return nil
+}
+
+// ConfirmMFA confirms TOTP enrollment with a code from the authenticator app
+func (h *Handler) ConfirmMFA(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Code == "" {
+		return appError.Validation("Code is required", nil)
+	}
+
+	codes, err := h.service.ConfirmMFA(r.Context(), userCtx.ID, req.Code)
+	if err != nil {
+		return mapMFAError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, codes)
+	return nil
+}
+
+// RegenerateRecoveryCodes issues a new set of MFA recovery codes
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Code == "" {
+		return appError.Validation("Code is required", nil)
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), userCtx.ID, req.Code)
+	if err != nil {
+		return mapMFAError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, codes)
+	return nil
+}
+
+// DisableMFA removes the current user's second factor
+func (h *Handler) DisableMFA(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	var req MFADisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if req.Password == "" || req.Code == "" {
+		return appError.Validation("Password and code are required", nil)
+	}
+
+	if err := h.service.DisableMFA(r.Context(), userCtx.ID, &req); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return appError.Authentication("Current password is incorrect", err)
+		}
+		return mapMFAError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "MFA disabled successfully",
+	})
+	return nil
+}
+
+// CreateAPIKey issues a personal API key; the plain key is only returned here
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+	if err := validateAPIKeyName(req.Name); err != nil {
+		return err
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyLifetimeDays {
+		return appError.Validation(fmt.Sprintf("expires_in_days must be between 0 and %d", maxAPIKeyLifetimeDays), nil)
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), userCtx.ID, &req)
+	if err != nil {
+		return mapAPIKeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusCreated, key)
+	return nil
+}
+
+// ListAPIKeys returns the user's API keys without their secrets
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	keys, err := h.service.ListAPIKeys(r.Context(), userCtx.ID)
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, keys)
+	return nil
+}
+
+// UpdateAPIKey changes the label of an API key
+func (h *Handler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	keyID := chi.URLParam(r, "id")
+	if keyID == "" {
+		return appError.Validation("API key ID is required", nil)
+	}
+
+	var req UpdateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+	if err := validateAPIKeyName(req.Name); err != nil {
+		return err
+	}
+
+	if err := h.service.RenameAPIKey(r.Context(), userCtx.ID, keyID, req.Name); err != nil {
+		return mapAPIKeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "API key updated successfully",
+	})
+	return nil
+}
+
+// RevokeAPIKey permanently disables an API key
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	keyID := chi.URLParam(r, "id")
+	if keyID == "" {
+		return appError.Validation("API key ID is required", nil)
+	}
+
+	if err := h.service.RevokeAPIKey(r.Context(), userCtx.ID, keyID); err != nil {
+		return mapAPIKeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "API key revoked successfully",
+	})
+	return nil
+}
+
+// ListIdentities returns the external identities linked to the current user
+func (h *Handler) ListIdentities(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	identities, err := h.service.ListIdentities(r.Context(), userCtx.ID)
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, identities)
+	return nil
+}
+
+// LinkIdentity returns the provider URL that links an external identity to the current user
+func (h *Handler) LinkIdentity(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	response, err := h.service.StartOIDCLink(r.Context(), chi.URLParam(r, "provider"), userCtx.ID)
+	if err != nil {
+		return mapOIDCError(err)
+	}
+
+	h.setOIDCStateCookie(w, response.State)
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// UnlinkIdentity removes the current user's identity at a provider
+func (h *Handler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	if err := h.service.UnlinkIdentity(r.Context(), userCtx.ID, chi.URLParam(r, "provider")); err != nil {
+		return mapOIDCError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Identity unlinked successfully",
+	})
+	return nil
+}
+
+// ListPasskeys returns the current user's passkeys
+func (h *Handler) ListPasskeys(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	passkeys, err := h.service.ListPasskeys(r.Context(), userCtx.ID)
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, passkeys)
+	return nil
+}
+
+// StartPasskeyRegistration returns creation options for registering a new passkey
+func (h *Handler) StartPasskeyRegistration(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	options, err := h.service.StartPasskeyRegistration(r.Context(), userCtx.ID)
+	if err != nil {
+		return mapPasskeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, options)
+	return nil
+}
+
+// FinishPasskeyRegistration stores the passkey created by the authenticator
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	var req PasskeyRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+	if req.Name == "" || len(req.Name) > 100 {
+		return appError.Validation("Name is required and must be at most 100 characters", nil)
+	}
+
+	passkey, err := h.service.FinishPasskeyRegistration(r.Context(), userCtx.ID, &req)
+	if err != nil {
+		return mapPasskeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusCreated, passkey)
+	return nil
+}
+
+// DeletePasskey removes one of the current user's passkeys
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	passkeyID := chi.URLParam(r, "id")
+	if passkeyID == "" {
+		return appError.Validation("Passkey ID is required", nil)
+	}
+
+	if err := h.service.DeletePasskey(r.Context(), userCtx.ID, passkeyID); err != nil {
+		return mapPasskeyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Passkey deleted successfully",
+	})
+	return nil
+}
+
+// mapPasskeyError translates passkey management errors
+func mapPasskeyError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidPasskey):
+		return appError.Validation("Passkey response is invalid or has expired, please try again", err)
+	case errors.Is(err, ErrPasskeyNotFound):
+		return appError.NotFound("Passkey not found", err)
+	case errors.Is(err, ErrPasskeyAlreadyExists):
+		return appError.Conflict("This passkey is already registered", err)
+	case errors.Is(err, ErrLastLoginMethod):
+		return appError.Validation("Set a password before removing your only sign-in method", err)
+	}
+	return appError.Internal(err)
+}
+
+// mapOIDCError translates external login and identity linking errors
+func mapOIDCError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownOIDCProvider):
+		return appError.NotFound("Unknown identity provider", err)
+	case errors.Is(err, ErrInvalidOIDCState):
+		return appError.Authentication("Sign-in request is invalid or has expired, please start again", err)
+	case errors.Is(err, ErrInvalidIDToken), errors.Is(err, ErrOIDCExchangeFailed):
+		return appError.Authentication("Sign-in with the provider failed", err)
+	case errors.Is(err, ErrIdentityNotLinked):
+		return appError.Authentication("No account is linked to this identity", err)
+	case errors.Is(err, ErrIdentityEmailInUse):
+		return appError.Conflict("An account with this email already exists; sign in and link the provider from your profile", err)
+	case errors.Is(err, ErrIdentityAlreadyLinked):
+		return appError.Conflict("This identity or provider is already linked", err)
+	case errors.Is(err, ErrIdentityNotFound):
+		return appError.NotFound("Identity not found", err)
+	case errors.Is(err, ErrLastLoginMethod):
+		return appError.Validation("Set a password before removing your only sign-in method", err)
+	}
+	return mapLoginError(err)
+}
+
+// maxAPIKeyLifetimeDays caps how far into the future a key may expire
+const maxAPIKeyLifetimeDays = 3650
+
+func validateAPIKeyName(name string) error {
+	if name == "" || len(name) > 100 {
+		return appError.Validation("Name is required and must be at most 100 characters", nil)
+	}
+	return nil
+}
+
+// mapAPIKeyError translates API key management errors
+func mapAPIKeyError(err error) error {
+	switch {
+	case errors.Is(err, ErrAPIKeyNotFound):
+		return appError.NotFound("API key not found", err)
+	case errors.Is(err, ErrInvalidAPIKeyScope):
+		return appError.Validation("API keys can only be scoped to permissions you hold", err)
+	}
+	return appError.Internal(err)
+}
+
+// mapMFAError translates MFA management errors for authenticated endpoints
+func mapMFAError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidMFACode):
+		return appError.Validation("Invalid MFA code", err)
+	case errors.Is(err, ErrMFANotEnrolled):
+		return appError.Validation("MFA is not enrolled", err)
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		return appError.Conflict("MFA is already enabled", err)
+	}
+	return appError.Internal(err)
+}
+
+// -------------------------
+// Admin Endpoints
 // -------------------------
 
 // BlockUser handles user blocking
@@ -336,7 +1214,7 @@ func (h *Handler) BlockUser(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if err := h.service.BlockUser(r.Context(), targetUserID, userCtx.ID); err != nil {
-		return appError.Internal(err)
+		return mapUserPolicyError(err)
 	}
 
 	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
@@ -345,6 +1223,59 @@ func (h *Handler) BlockUser(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// StartImpersonation issues a short-lived access token acting as another user
+func (h *Handler) StartImpersonation(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	targetUserID := chi.URLParam(r, "id")
+	if targetUserID == "" {
+		return appError.Validation("User ID is required", nil)
+	}
+
+	var req StartImpersonationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return appError.Validation("A reason is required", nil)
+	}
+	if len(req.Reason) > 500 {
+		return appError.Validation("Reason must be at most 500 characters", nil)
+	}
+
+	response, err := h.service.StartImpersonation(r.Context(), userCtx.ID, userCtx.SessionID, targetUserID, req.Reason, r)
+	if err != nil {
+		return mapImpersonationError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, response)
+	return nil
+}
+
+// StopImpersonation ends the impersonation the request is made under
+func (h *Handler) StopImpersonation(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+	if userCtx.ImpersonationID == "" {
+		return appError.Validation("Not impersonating a user", ErrNotImpersonating)
+	}
+
+	if err := h.service.StopImpersonation(r.Context(), userCtx.ImpersonationID, r); err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Impersonation ended",
+	})
+	return nil
+}
+
 // UnblockUser handles user unblocking
 func (h *Handler) UnblockUser(w http.ResponseWriter, r *http.Request) error {
 	userCtx := getUserContext(r)
@@ -357,8 +1288,8 @@ func (h *Handler) UnblockUser(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("User ID is required", nil)
 	}
 
-	if err := h.service.UnblockUser(r.Context(), targetUserID); err != nil {
-		return appError.Internal(err)
+	if err := h.service.UnblockUser(r.Context(), targetUserID, userCtx.ID); err != nil {
+		return mapUserPolicyError(err)
 	}
 
 	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
@@ -379,8 +1310,8 @@ func (h *Handler) LogoutAllUserSessions(w http.ResponseWriter, r *http.Request)
 		return appError.Validation("User ID is required", nil)
 	}
 
-	if err := h.service.LogoutAll(r.Context(), targetUserID); err != nil {
-		return appError.Internal(err)
+	if err := h.service.LogoutAllUserSessions(r.Context(), targetUserID, userCtx.ID); err != nil {
+		return mapUserPolicyError(err)
 	}
 
 	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
@@ -389,6 +1320,276 @@ func (h *Handler) LogoutAllUserSessions(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
+// ResetUserMFA handles admin reset of a user's second factor
+func (h *Handler) ResetUserMFA(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	targetUserID := chi.URLParam(r, "id")
+	if targetUserID == "" {
+		return appError.Validation("User ID is required", nil)
+	}
+
+	if err := h.service.ResetMFA(r.Context(), targetUserID, userCtx.ID); err != nil {
+		return mapUserPolicyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "User MFA reset successfully",
+	})
+	return nil
+}
+
+// UnlockUser handles admin removal of a login lockout
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	targetUserID := chi.URLParam(r, "id")
+	if targetUserID == "" {
+		return appError.Validation("User ID is required", nil)
+	}
+
+	if err := h.service.UnlockUser(r.Context(), targetUserID, userCtx.ID); err != nil {
+		return mapUserPolicyError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "User unlocked successfully",
+	})
+	return nil
+}
+
+// ListRoles returns every role with its permissions
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) error {
+	roles, err := h.service.ListRoles(r.Context())
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, roles)
+	return nil
+}
+
+// ListPermissions returns every permission that can be granted
+func (h *Handler) ListPermissions(w http.ResponseWriter, r *http.Request) error {
+	permissions, err := h.service.ListPermissions(r.Context())
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, permissions)
+	return nil
+}
+
+// CreateRole handles custom role creation
+func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) error {
+	var req CreateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	role, err := h.service.CreateRole(r.Context(), &req)
+	if err != nil {
+		return mapRoleError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusCreated, role)
+	return nil
+}
+
+// SetRolePermissions replaces the permissions of a role
+func (h *Handler) SetRolePermissions(w http.ResponseWriter, r *http.Request) error {
+	roleID := chi.URLParam(r, "id")
+	if roleID == "" {
+		return appError.Validation("Role ID is required", nil)
+	}
+
+	var req SetRolePermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	role, err := h.service.SetRolePermissions(r.Context(), roleID, req.Permissions)
+	if err != nil {
+		return mapRoleError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, role)
+	return nil
+}
+
+// ListServiceAccounts returns every service account
+func (h *Handler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) error {
+	accounts, err := h.service.ListServiceAccounts(r.Context())
+	if err != nil {
+		return appError.Internal(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, accounts)
+	return nil
+}
+
+// CreateServiceAccount creates a non-human principal that cannot log in with a password
+func (h *Handler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) error {
+	userCtx := getUserContext(r)
+	if userCtx == nil {
+		return appError.Authentication("Unauthorized", nil)
+	}
+
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+	if req.Name == "" || len(req.Name) > 100 {
+		return appError.Validation("Name is required and must be at most 100 characters", nil)
+	}
+
+	account, err := h.service.CreateServiceAccount(r.Context(), &req, userCtx.ID)
+	if err != nil {
+		return mapServiceAccountError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusCreated, account)
+	return nil
+}
+
+// ListClientCredentials returns a service account's active credentials without their secrets
+func (h *Handler) ListClientCredentials(w http.ResponseWriter, r *http.Request) error {
+	accountID := chi.URLParam(r, "id")
+	if accountID == "" {
+		return appError.Validation("Service account ID is required", nil)
+	}
+
+	credentials, err := h.service.ListClientCredentials(r.Context(), accountID)
+	if err != nil {
+		return mapServiceAccountError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, credentials)
+	return nil
+}
+
+// CreateClientCredential issues a client ID and secret; the secret is only returned here
+func (h *Handler) CreateClientCredential(w http.ResponseWriter, r *http.Request) error {
+	accountID := chi.URLParam(r, "id")
+	if accountID == "" {
+		return appError.Validation("Service account ID is required", nil)
+	}
+
+	var req CreateClientCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+	if req.Name == "" || len(req.Name) > 100 {
+		return appError.Validation("Name is required and must be at most 100 characters", nil)
+	}
+
+	credential, err := h.service.CreateClientCredential(r.Context(), accountID, &req)
+	if err != nil {
+		return mapServiceAccountError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusCreated, credential)
+	return nil
+}
+
+// UpdateClientCredential replaces the scopes of a client credential
+func (h *Handler) UpdateClientCredential(w http.ResponseWriter, r *http.Request) error {
+	accountID := chi.URLParam(r, "id")
+	clientID := chi.URLParam(r, "clientId")
+	if accountID == "" || clientID == "" {
+		return appError.Validation("Service account ID and client ID are required", nil)
+	}
+
+	var req UpdateClientCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return appError.Validation("Invalid request body", err)
+	}
+
+	if err := h.service.UpdateClientCredentialScopes(r.Context(), accountID, clientID, req.Scopes); err != nil {
+		return mapServiceAccountError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Client credential updated successfully",
+	})
+	return nil
+}
+
+// RevokeClientCredential permanently disables a client credential
+func (h *Handler) RevokeClientCredential(w http.ResponseWriter, r *http.Request) error {
+	accountID := chi.URLParam(r, "id")
+	clientID := chi.URLParam(r, "clientId")
+	if accountID == "" || clientID == "" {
+		return appError.Validation("Service account ID and client ID are required", nil)
+	}
+
+	if err := h.service.RevokeClientCredential(r.Context(), accountID, clientID); err != nil {
+		return mapServiceAccountError(err)
+	}
+
+	httpUtils.RespondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Client credential revoked successfully",
+	})
+	return nil
+}
+
+// mapServiceAccountError translates service account management errors
+func mapServiceAccountError(err error) error {
+	switch {
+	case errors.Is(err, ErrServiceAccountNotFound):
+		return appError.NotFound("Service account not found", err)
+	case errors.Is(err, ErrClientNotFound):
+		return appError.NotFound("Client credential not found", err)
+	case errors.Is(err, ErrInvalidScope):
+		return appError.Validation("Scopes must be permissions held by the service account's role", err)
+	case errors.Is(err, ErrServiceAccountRole):
+		return appError.Validation("Service accounts cannot be given the owner or admin role", err)
+	case errors.Is(err, ErrRoleNotFound):
+		return appError.Validation("Role not found", err)
+	}
+	return appError.Internal(err)
+}
+
+// mapUserPolicyError turns hierarchy policy refusals into 403s
+func mapUserPolicyError(err error) error {
+	if msg := userPolicyMessage(err); msg != "" {
+		return appError.Authorization(msg, err)
+	}
+	return appError.Internal(err)
+}
+
+// mapImpersonationError translates impersonation refusals
+func mapImpersonationError(err error) error {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return appError.NotFound("User not found", err)
+	case errors.Is(err, ErrImpersonationForbidden):
+		return appError.Authorization("This user cannot be impersonated", err)
+	}
+	return mapUserPolicyError(err)
+}
+
+// mapRoleError translates role management errors
+func mapRoleError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidRoleName):
+		return appError.Validation("Role name must be 2-50 lowercase letters, digits, '-' or '_'", err)
+	case errors.Is(err, ErrUnknownPermission):
+		return appError.Validation(err.Error(), err)
+	case errors.Is(err, ErrRoleAlreadyExists):
+		return appError.Conflict("Role already exists", err)
+	case errors.Is(err, ErrRoleNotFound):
+		return appError.NotFound("Role not found", err)
+	}
+	return appError.Internal(err)
+}
+
 // -------------------------
 // Helper Methods
 // -------------------------
@@ -442,6 +1643,33 @@ func (h *Handler) clearAuthCookies(w http.ResponseWriter) {
 	})
 }
 
+// setOIDCStateCookie binds an external login or link flow to the browser that started it.
+// SameSite=Lax lets the cookie through on the provider's top-level redirect back to us.
+func (h *Handler) setOIDCStateCookie(w http.ResponseWriter, state string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		HttpOnly: true,
+		Secure:   h.config.WebServer.Env == "production",
+		SameSite: http.SameSiteLaxMode,
+		Path:     oidcStateCookiePath,
+		MaxAge:   int(h.config.Auth.OIDCStateLifetime.Seconds()),
+	})
+}
+
+// clearOIDCStateCookie drops the flow binding once the callback has been received
+func (h *Handler) clearOIDCStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		HttpOnly: true,
+		Secure:   h.config.WebServer.Env == "production",
+		SameSite: http.SameSiteLaxMode,
+		Path:     oidcStateCookiePath,
+		MaxAge:   -1,
+	})
+}
+
 // getUserContext extracts user context from request
 func getUserContext(r *http.Request) *UserContext {
 	ctx := r.Context().Value(UserContextKey)
@@ -2,7 +2,7 @@ package auth
 
 import (
 	"errors"
-	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,17 +14,21 @@ var (
 	ErrInvalidSignature = errors.New("invalid token signature")
 )
 
+// tokenTypeMFAChallenge marks short-lived tokens issued between password and second factor checks.
+// They must never be accepted where an access or refresh token is expected.
+const tokenTypeMFAChallenge = "mfa_challenge"
+
 type JWTService struct {
-	secret               []byte
+	keys                 *KeySet
 	issuer               string
 	audience             string
 	accessTokenLifetime  time.Duration
 	refreshTokenLifetime time.Duration
 }
 
-func NewJWTService(secret, issuer, audience string, accessLifetime, refreshLifetime time.Duration) *JWTService {
+func NewJWTService(keys *KeySet, issuer, audience string, accessLifetime, refreshLifetime time.Duration) *JWTService {
 	return &JWTService{
-		secret:               []byte(secret),
+		keys:                 keys,
 		issuer:               issuer,
 		audience:             audience,
 		accessTokenLifetime:  accessLifetime,
@@ -32,8 +36,9 @@ func NewJWTService(secret, issuer, audience string, accessLifetime, refreshLifet
 	}
 }
 
-// GenerateAccessToken creates a new access token with user claims
-func (s *JWTService) GenerateAccessToken(userID, email, role, sessionID string) (string, error) {
+// GenerateAccessToken creates a new access token with user claims.
+// permissions are embedded only when non-nil.
+func (s *JWTService) GenerateAccessToken(userID, email, role, sessionID string, permissions []string) (string, error) {
 	now := time.Now()
 	expiresAt := now.Add(s.accessTokenLifetime)
 
@@ -47,9 +52,56 @@ func (s *JWTService) GenerateAccessToken(userID, email, role, sessionID string)
 		"iss":        s.issuer,
 		"aud":        s.audience,
 	}
+	if permissions != nil {
+		claims["permissions"] = permissions
+	}
+
+	return s.sign(claims)
+}
+
+// GenerateClientAccessToken creates an access token for a service account (client credentials grant).
+// It is bound to the client instead of a session, so it stays valid until it expires.
+func (s *JWTService) GenerateClientAccessToken(userID, role, clientID string, scopes []string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(lifetime)
+
+	claims := jwt.MapClaims{
+		"user_id":   userID,
+		"role":      role,
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       expiresAt.Unix(),
+		"iss":       s.issuer,
+		"aud":       s.audience,
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+	return s.sign(claims)
+}
+
+// GenerateImpersonationToken creates an access token that acts as userID on behalf of actorID.
+// The actor is named in an RFC 8693 "act" claim; the token is bound to the impersonation record
+// instead of a session and cannot be refreshed.
+func (s *JWTService) GenerateImpersonationToken(userID, email, role, actorID, impersonationID string, permissions []string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(lifetime)
+
+	claims := jwt.MapClaims{
+		"user_id":          userID,
+		"email":            email,
+		"role":             role,
+		"act":              map[string]string{"sub": actorID},
+		"impersonation_id": impersonationID,
+		"iat":              now.Unix(),
+		"exp":              expiresAt.Unix(),
+		"iss":              s.issuer,
+		"aud":              s.audience,
+	}
+	if permissions != nil {
+		claims["permissions"] = permissions
+	}
+
+	return s.sign(claims)
 }
 
 // GenerateRefreshToken creates a new refresh token
@@ -66,49 +118,64 @@ func (s *JWTService) GenerateRefreshToken(userID, sessionID string, lifetime tim
 		"aud":        s.audience,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secret)
+	return s.sign(claims)
 }
 
 // ValidateAccessToken validates and parses an access token
 func (s *JWTService) ValidateAccessToken(tokenString string) (*AccessTokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secret, nil
-	})
-
+	claims, err := s.parse(tokenString)
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
-		}
+		return nil, err
+	}
+	if getStringClaim(claims, "typ") == tokenTypeMFAChallenge {
 		return nil, ErrInvalidToken
 	}
 
-	if !token.Valid {
-		return nil, ErrInvalidToken
+	// Extract claims
+	accessClaims := &AccessTokenClaims{
+		UserID:      getStringClaim(claims, "user_id"),
+		Email:       getStringClaim(claims, "email"),
+		Role:        getStringClaim(claims, "role"),
+		Permissions: getStringSliceClaim(claims, "permissions"),
+		SessionID:   getStringClaim(claims, "session_id"),
+		ClientID:    getStringClaim(claims, "client_id"),
+		Scopes:      strings.Fields(getStringClaim(claims, "scope")),
+		IssuedAt:    getInt64Claim(claims, "iat"),
+		ExpiresAt:   getInt64Claim(claims, "exp"),
+		Issuer:      getStringClaim(claims, "iss"),
+		Audience:    getStringClaim(claims, "aud"),
+
+		ImpersonationID: getStringClaim(claims, "impersonation_id"),
+	}
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		accessClaims.ImpersonatorID, _ = act["sub"].(string)
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	// Every access token names a role; refresh tokens never do and must not be accepted here
+	if accessClaims.Role == "" {
 		return nil, ErrInvalidToken
 	}
-
-	// Verify issuer and audience
-	if claims["iss"] != s.issuer {
+	// Impersonation tokens must name both the actor and the impersonation they belong to
+	if (accessClaims.ImpersonatorID == "") != (accessClaims.ImpersonationID == "") {
 		return nil, ErrInvalidToken
 	}
-	if claims["aud"] != s.audience {
+
+	return accessClaims, nil
+}
+
+// ValidateRefreshToken validates and parses a refresh token
+func (s *JWTService) ValidateRefreshToken(tokenString string) (*RefreshTokenClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if getStringClaim(claims, "typ") == tokenTypeMFAChallenge {
 		return nil, ErrInvalidToken
 	}
 
 	// Extract claims
-	accessClaims := &AccessTokenClaims{
+	refreshClaims := &RefreshTokenClaims{
 		UserID:    getStringClaim(claims, "user_id"),
-		Email:     getStringClaim(claims, "email"),
-		Role:      getStringClaim(claims, "role"),
 		SessionID: getStringClaim(claims, "session_id"),
 		IssuedAt:  getInt64Claim(claims, "iat"),
 		ExpiresAt: getInt64Claim(claims, "exp"),
@@ -116,19 +183,66 @@ func (s *JWTService) ValidateAccessToken(tokenString string) (*AccessTokenClaims
 		Audience:  getStringClaim(claims, "aud"),
 	}
 
-	return accessClaims, nil
+	return refreshClaims, nil
 }
 
-// ValidateRefreshToken validates and parses a refresh token
-func (s *JWTService) ValidateRefreshToken(tokenString string) (*RefreshTokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secret, nil
-	})
+// GenerateMFAChallengeToken creates a short-lived token proving the password step of login succeeded
+func (s *JWTService) GenerateMFAChallengeToken(userID string, staySignedIn bool, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(lifetime)
+
+	claims := jwt.MapClaims{
+		"user_id":        userID,
+		"stay_signed_in": staySignedIn,
+		"typ":            tokenTypeMFAChallenge,
+		"iat":            now.Unix(),
+		"exp":            expiresAt.Unix(),
+		"iss":            s.issuer,
+		"aud":            s.audience,
+	}
 
+	return s.sign(claims)
+}
+
+// ValidateMFAChallengeToken validates and parses an MFA challenge token
+func (s *JWTService) ValidateMFAChallengeToken(tokenString string) (*MFAChallengeClaims, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if getStringClaim(claims, "typ") != tokenTypeMFAChallenge {
+		return nil, ErrInvalidToken
+	}
+
+	staySignedIn, _ := claims["stay_signed_in"].(bool)
+
+	return &MFAChallengeClaims{
+		UserID:       getStringClaim(claims, "user_id"),
+		StaySignedIn: staySignedIn,
+		IssuedAt:     getInt64Claim(claims, "iat"),
+		ExpiresAt:    getInt64Claim(claims, "exp"),
+	}, nil
+}
+
+// JWKS returns the public verification keys for /.well-known/jwks.json
+func (s *JWTService) JWKS() *JWKSet {
+	return s.keys.JWKS()
+}
+
+// sign signs claims with the active key of the keyset
+func (s *JWTService) sign(claims jwt.MapClaims) (string, error) {
+	method, key, kid := s.keys.signingMaterial()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// parse verifies the signature (key picked by kid), expiry, issuer and audience of a token
+func (s *JWTService) parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, s.keys.keyFunc)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrExpiredToken
@@ -153,17 +267,7 @@ func (s *JWTService) ValidateRefreshToken(tokenString string) (*RefreshTokenClai
 		return nil, ErrInvalidToken
 	}
 
-	// Extract claims
-	refreshClaims := &RefreshTokenClaims{
-		UserID:    getStringClaim(claims, "user_id"),
-		SessionID: getStringClaim(claims, "session_id"),
-		IssuedAt:  getInt64Claim(claims, "iat"),
-		ExpiresAt: getInt64Claim(claims, "exp"),
-		Issuer:    getStringClaim(claims, "iss"),
-		Audience:  getStringClaim(claims, "aud"),
-	}
-
-	return refreshClaims, nil
+	return claims, nil
 }
 
 // Helper functions to extract claims safely
@@ -174,6 +278,20 @@ func getStringClaim(claims jwt.MapClaims, key string) string {
 	return ""
 }
 
+func getStringSliceClaim(claims jwt.MapClaims, key string) []string {
+	vals, ok := claims[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if str, ok := v.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
+
 func getInt64Claim(claims jwt.MapClaims, key string) int64 {
 	if val, ok := claims[key].(float64); ok {
 		return int64(val)
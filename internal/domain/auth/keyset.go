@@ -0,0 +1,417 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"rest_api_poc/internal/infra/config"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKey is a single entry of the JWT keyset.
+// Retired keys have no private part; they only verify tokens issued before the rotation.
+// The retired HS256 secret is kept with an empty ID (its tokens carry no kid) and the secret as PublicKey.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	RetiredAt  *time.Time
+}
+
+// KeySet holds the keys used to sign and verify JWTs.
+//
+// Without asymmetric keys configured it falls back to HS256 with JWT_SECRET (no kid header).
+// With keys configured, tokens are signed by the active key and carry its kid; any other
+// active or retired key in the set is still accepted for verification.
+type KeySet struct {
+	secret    []byte
+	active    *SigningKey
+	keys      map[string]*SigningKey
+	retention time.Duration
+}
+
+// NewHMACKeySet creates a keyset that signs and verifies with a shared HS256 secret
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret)}
+}
+
+// LoadKeySet builds the keyset from config.
+//
+// JWT_SIGNING_KEYS and JWT_RETIRED_KEYS are comma-separated "kid=path" entries pointing at PEM files.
+// A retired entry may carry "@<RFC3339 time>"; it is dropped once every token it could have
+// signed has expired (retired_at + retention).
+//
+// JWT_SECRET becomes a retired verify-only key at the same time, so tokens issued before the
+// switch to asymmetric keys stay valid until they expire (JWT_SECRET_RETIRED_AT + retention).
+func LoadKeySet(cfg *config.AuthConfig) (*KeySet, error) {
+	if len(cfg.JWTSigningKeys) == 0 {
+		return NewHMACKeySet(cfg.JWTSecret), nil
+	}
+
+	ks := &KeySet{
+		keys:      make(map[string]*SigningKey),
+		retention: cfg.RefreshTokenLifetime,
+	}
+	if cfg.StaySignedInLifetime > ks.retention {
+		ks.retention = cfg.StaySignedInLifetime
+	}
+
+	for _, entry := range cfg.JWTSigningKeys {
+		kid, path, _, err := parseKeyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		key, err := loadPrivateKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.add(key); err != nil {
+			return nil, err
+		}
+		if ks.active == nil || kid == cfg.JWTActiveKeyID {
+			ks.active = key
+		}
+	}
+
+	if cfg.JWTActiveKeyID != "" && ks.active.ID != cfg.JWTActiveKeyID {
+		return nil, fmt.Errorf("active key %q is not one of the signing keys", cfg.JWTActiveKeyID)
+	}
+
+	for _, entry := range cfg.JWTRetiredKeys {
+		kid, path, retiredAt, err := parseKeyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		key, err := loadPublicKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		key.RetiredAt = retiredAt
+		if err := ks.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.JWTSecret != "" {
+		retiredAt := cfg.JWTSecretRetiredAt
+		if retiredAt.IsZero() {
+			retiredAt = time.Now()
+		}
+		if err := ks.add(&SigningKey{
+			Method:    jwt.SigningMethodHS256,
+			PublicKey: []byte(cfg.JWTSecret),
+			RetiredAt: &retiredAt,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// signingMaterial returns the method, key and kid used to sign new tokens
+func (ks *KeySet) signingMaterial() (jwt.SigningMethod, interface{}, string) {
+	if ks.active == nil {
+		return jwt.SigningMethodHS256, ks.secret, ""
+	}
+	return ks.active.Method, ks.active.PrivateKey, ks.active.ID
+}
+
+// keyFunc resolves the verification key for a parsed token by its kid header
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	if ks.active == nil {
+		// Verify signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ks.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok || ks.expired(key) {
+		return nil, ErrUnknownSigningKey
+	}
+
+	// The algorithm is pinned per key; never trust the header alone.
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.PublicKey, nil
+}
+
+// expired reports whether a retired key has outlived every token it could have signed
+func (ks *KeySet) expired(key *SigningKey) bool {
+	return key.RetiredAt != nil && time.Now().After(key.RetiredAt.Add(ks.retention))
+}
+
+func (ks *KeySet) add(key *SigningKey) error {
+	if _, exists := ks.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	ks.keys[key.ID] = key
+	return nil
+}
+
+// -------------------------
+// JWKS
+// -------------------------
+
+// JWK is the public part of a signing key in RFC 7517 format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that can currently verify tokens.
+// A symmetric keyset publishes nothing since its secret must never leave the service.
+func (ks *KeySet) JWKS() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	if ks.active == nil {
+		return set
+	}
+
+	// Active signer first so clients that only look at the first key still work
+	set.Keys = append(set.Keys, toJWK(ks.active))
+	for _, key := range ks.keys {
+		// The retired HS256 secret must never be published
+		if _, symmetric := key.Method.(*jwt.SigningMethodHMAC); symmetric || key == ks.active || ks.expired(key) {
+			continue
+		}
+		set.Keys = append(set.Keys, toJWK(key))
+	}
+
+	return set
+}
+
+func toJWK(key *SigningKey) JWK {
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64URL(pub.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = base64URL(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64URL(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64URL(pub)
+	}
+
+	return jwk
+}
+
+// parseJWK is the inverse of toJWK, used to verify tokens issued by external providers.
+// The key's alg, when present, is pinned; otherwise it is derived from the key type.
+func parseJWK(jwk JWK) (*SigningKey, error) {
+	var pub crypto.PublicKey
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", jwk.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent for key %q", jwk.KeyID)
+		}
+		pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q for key %q", jwk.Curve, jwk.KeyID)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid coordinates for key %q", jwk.KeyID)
+		}
+		pub = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", jwk.KeyID)
+		}
+		pub = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q for key %q", jwk.KeyType, jwk.KeyID)
+	}
+
+	key, err := newSigningKey(jwk.KeyID, pub)
+	if err != nil {
+		return nil, err
+	}
+	if jwk.Algorithm != "" {
+		method := jwt.GetSigningMethod(jwk.Algorithm)
+		// Public keys never verify symmetric or unsigned tokens
+		if _, symmetric := method.(*jwt.SigningMethodHMAC); method == nil || symmetric || method.Alg() == "none" {
+			return nil, fmt.Errorf("unsupported algorithm %q for key %q", jwk.Algorithm, jwk.KeyID)
+		}
+		key.Method = method
+	}
+	return key, nil
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// -------------------------
+// PEM Loading
+// -------------------------
+
+// parseKeyEntry splits "kid=path[@retired_at]"
+func parseKeyEntry(entry string) (string, string, *time.Time, error) {
+	kid, rest, ok := strings.Cut(strings.TrimSpace(entry), "=")
+	if !ok || kid == "" || rest == "" {
+		return "", "", nil, fmt.Errorf("invalid key entry %q, expected kid=path", entry)
+	}
+
+	path, retired, hasRetired := strings.Cut(rest, "@")
+	if !hasRetired {
+		return kid, path, nil, nil
+	}
+
+	retiredAt, err := time.Parse(time.RFC3339, retired)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid retired_at for key %q: %w", kid, err)
+	}
+	return kid, path, &retiredAt, nil
+}
+
+func loadPrivateKey(kid, path string) (*SigningKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %q: %w", kid, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type for %q", kid)
+	}
+
+	key, err := newSigningKey(kid, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.PrivateKey = signer
+	return key, nil
+}
+
+// loadPublicKey accepts either a public key or a private key PEM (only the public part is kept)
+func loadPublicKey(kid, path string) (*SigningKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(block.Type, "PRIVATE KEY") {
+		key, err := loadPrivateKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		key.PrivateKey = nil
+		return key, nil
+	}
+
+	var pub interface{}
+	if block.Type == "RSA PUBLIC KEY" {
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %q: %w", kid, err)
+	}
+
+	return newSigningKey(kid, pub)
+}
+
+// newSigningKey derives the JWS algorithm from the key type
+func newSigningKey(kid string, pub crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{ID: kid, PublicKey: pub}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		default:
+			return nil, fmt.Errorf("unsupported EC curve for key %q", kid)
+		}
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type for %q", kid)
+	}
+
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
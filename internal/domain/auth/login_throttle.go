@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"rest_api_poc/internal/shared/logger"
+	"strings"
+	"time"
+)
+
+// LoginAttemptStore tracks failed authentication attempts and temporary lockouts per key.
+// Keys are namespaced, e.g. "account:<email>" or "ip:<address>".
+// Redis backs it when caching is enabled; otherwise the login_attempts table is used.
+type LoginAttemptStore interface {
+	// RegisterFailure increments the failure counter of key and returns the new count.
+	// A new counting window of the given length starts with the first failure.
+	RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Get(ctx context.Context, key string) (*LoginAttempts, error)
+	Lock(ctx context.Context, key string, duration time.Duration) error
+	Clear(ctx context.Context, key string) error
+}
+
+type LoginAttempts struct {
+	Failures int
+	Locked   bool
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// passwordResetAttemptKey counts wrong reset OTPs
+func passwordResetAttemptKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// passwordResetSendKey counts reset emails sent; kept apart from wrong OTPs so that
+// requesting resets for someone else's address cannot lock out their verification
+func passwordResetSendKey(email string) string {
+	return "reset-send:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// passwordlessAttemptKey counts wrong sign-in codes
+func passwordlessAttemptKey(email string) string {
+	return "passwordless:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// passwordlessSendKey counts sign-in emails sent, apart from wrong codes for the same reason
+// as passwordResetSendKey
+func passwordlessSendKey(email string) string {
+	return "passwordless-send:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func emailVerificationAttemptKey(email string) string {
+	return "verify:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// userAttemptKeys lists every counter kept for an address, so an unlock clears them all
+func userAttemptKeys(email string) []string {
+	return []string{
+		accountAttemptKey(email),
+		passwordResetAttemptKey(email),
+		passwordResetSendKey(email),
+		passwordlessAttemptKey(email),
+		passwordlessSendKey(email),
+		emailVerificationAttemptKey(email),
+	}
+}
+
+// -------------------------
+// Database-backed store
+// -------------------------
+
+type dbLoginAttemptStore struct {
+	repo *Repository
+}
+
+// NewDBLoginAttemptStore creates a LoginAttemptStore backed by the login_attempts table
+func NewDBLoginAttemptStore(repo *Repository) LoginAttemptStore {
+	return &dbLoginAttemptStore{repo: repo}
+}
+
+func (s *dbLoginAttemptStore) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	return s.repo.RegisterLoginFailure(ctx, key, window)
+}
+
+func (s *dbLoginAttemptStore) Get(ctx context.Context, key string) (*LoginAttempts, error) {
+	return s.repo.GetLoginAttempts(ctx, key)
+}
+
+func (s *dbLoginAttemptStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	return s.repo.LockLoginAttempts(ctx, key, duration)
+}
+
+func (s *dbLoginAttemptStore) Clear(ctx context.Context, key string) error {
+	return s.repo.ClearLoginAttempts(ctx, key)
+}
+
+// -------------------------
+// Throttling policy
+// -------------------------
+
+// checkLoginAllowed rejects attempts from locked IPs or against locked accounts.
+// Store failures are logged and treated as allowed; DB/Redis hiccups must not lock everyone out.
+func (s *Service) checkLoginAllowed(ctx context.Context, accountKey, ip string) error {
+	if ip != "" {
+		if attempts := s.getAttempts(ctx, ipAttemptKey(ip)); attempts.Locked {
+			return ErrTooManyAttempts
+		}
+	}
+	if attempts := s.getAttempts(ctx, accountKey); attempts.Locked {
+		return ErrAccountLocked
+	}
+	return nil
+}
+
+// registerLoginFailure counts a failure for the account and IP, locks whichever crossed its
+// threshold and then slows the caller down progressively.
+func (s *Service) registerLoginFailure(ctx context.Context, accountKey, ip string) {
+	cfg := s.config.Auth
+
+	failures := s.registerFailure(ctx, accountKey, cfg.LoginMaxFailures)
+	if ip != "" {
+		s.registerFailure(ctx, ipAttemptKey(ip), cfg.LoginIPMaxFailures)
+	}
+
+	s.failureDelay(ctx, failures)
+}
+
+// registerFailure increments key and locks it once maxFailures is reached; returns the new count
+func (s *Service) registerFailure(ctx context.Context, key string, maxFailures int) int {
+	cfg := s.config.Auth
+
+	failures, err := s.attempts.RegisterFailure(ctx, key, cfg.LoginFailureWindow)
+	if err != nil {
+		logger.Warn("failed to register login failure for %s: %v", key, err)
+		return 0
+	}
+
+	if maxFailures > 0 && failures >= maxFailures {
+		if err := s.attempts.Lock(ctx, key, cfg.LoginLockoutDuration); err != nil {
+			logger.Warn("failed to lock %s: %v", key, err)
+		} else if failures == maxFailures {
+			logger.Warn("Locked %s for %v after %d failed attempts", key, cfg.LoginLockoutDuration, failures)
+		}
+	}
+
+	return failures
+}
+
+// clearLoginFailures resets the account counter after a successful login.
+// The IP counter is left alone so one valid account cannot launder an IP's failures.
+func (s *Service) clearLoginFailures(ctx context.Context, accountKey string) {
+	if err := s.attempts.Clear(ctx, accountKey); err != nil {
+		logger.Warn("failed to clear login failures for %s: %v", accountKey, err)
+	}
+}
+
+func (s *Service) getAttempts(ctx context.Context, key string) *LoginAttempts {
+	attempts, err := s.attempts.Get(ctx, key)
+	if err != nil {
+		logger.Warn("failed to get login attempts for %s: %v", key, err)
+		return &LoginAttempts{}
+	}
+	return attempts
+}
+
+// failureDelay sleeps base * 2^(failures-2) (capped) starting with the second failure
+func (s *Service) failureDelay(ctx context.Context, failures int) {
+	base := s.config.Auth.LoginFailureDelay
+	maxDelay := s.config.Auth.LoginMaxFailureDelay
+	if base <= 0 || failures < 2 {
+		return
+	}
+
+	delay := base
+	for i := 2; i < failures && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -34,30 +34,279 @@ type ChangePasswordRequest struct {
 	NewPassword     string `json:"new_password"`
 }
 
+type EmailVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type SetRolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 never expires
+}
+
+type UpdateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role,omitempty"` // defaults to "system"
+}
+
+type CreateClientCredentialRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type UpdateClientCredentialRequest struct {
+	Scopes []string `json:"scopes"`
+}
+
+type PasswordlessStartRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordlessVerifyRequest takes either the emailed code with its address or the magic link token
+type PasswordlessVerifyRequest struct {
+	Email        string `json:"email,omitempty"`
+	Code         string `json:"code,omitempty"`
+	Token        string `json:"token,omitempty"`
+	StaySignedIn bool   `json:"stay_signed_in"`
+}
+
+type PasskeyRegisterRequest struct {
+	Name       string             `json:"name"`
+	Credential PasskeyAttestation `json:"credential"`
+}
+
+type PasskeyLoginStartRequest struct {
+	StaySignedIn bool `json:"stay_signed_in"`
+}
+
+type PasskeyLoginRequest struct {
+	Credential PasskeyAssertion `json:"credential"`
+}
+
+type MFAPasskeyOptionsRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type OIDCAuthorizeRequest struct {
+	StaySignedIn bool `json:"stay_signed_in"`
+}
+
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+type StartImpersonationRequest struct {
+	Reason string `json:"reason"` // recorded in the audit trail
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string            `json:"mfa_token"`
+	Code         string            `json:"code,omitempty"`
+	RecoveryCode string            `json:"recovery_code,omitempty"`
+	Passkey      *PasskeyAssertion `json:"passkey,omitempty"` // answers /v1/auth/mfa/passkey/options
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFADisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
 // -------------------------
 // Response DTOs
 // -------------------------
 
 type LoginResponse struct {
-	User         *UserResponse `json:"user"`
+	User         *UserResponse `json:"user,omitempty"`
 	AccessToken  string        `json:"access_token,omitempty"`  // Optional: for Bearer token support
 	RefreshToken string        `json:"refresh_token,omitempty"` // Optional: for Bearer token support
+	MFARequired  bool          `json:"mfa_required,omitempty"`  // Set when a second factor must be verified
+	MFAToken     string        `json:"mfa_token,omitempty"`     // Challenge token for /v1/auth/mfa/verify
+}
+
+type MFAEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type UserResponse struct {
-	ID        string     `json:"id"`
-	FirstName string     `json:"first_name"`
-	LastName  string     `json:"last_name"`
-	Email     string     `json:"email"`
-	Role      string     `json:"role"`
-	IsActive  bool       `json:"is_active"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	ID              string     `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	IsActive        bool       `json:"is_active"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+
+	// Set on /me while a support user is impersonating this account
+	Impersonation *ImpersonationInfo `json:"impersonation,omitempty"`
+}
+
+// ImpersonationInfo tells clients to show who is really acting and until when
+type ImpersonationInfo struct {
+	ID                string    `json:"id"`
+	ImpersonatorID    string    `json:"impersonator_id"`
+	ImpersonatorEmail string    `json:"impersonator_email"`
+	Reason            string    `json:"reason"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// ImpersonationResponse carries the access token for acting as the target user.
+// It is only returned in the body and must be sent as a Bearer token.
+type ImpersonationResponse struct {
+	AccessToken   string             `json:"access_token"`
+	TokenType     string             `json:"token_type"`
+	ExpiresIn     int64              `json:"expires_in"` // seconds
+	Impersonation *ImpersonationInfo `json:"impersonation"`
+	User          *UserResponse      `json:"user"`
+}
+
+type RoleResponse struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type PermissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyResponse is the only time the plain key is ever returned
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type ServiceAccountResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	IsBlocked bool      `json:"is_blocked"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ClientCredentialResponse struct {
+	ClientID   string     `json:"client_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateClientCredentialResponse is the only time the client secret is ever returned
+type CreateClientCredentialResponse struct {
+	ClientCredentialResponse
+	ClientSecret string `json:"client_secret"`
+}
+
+// TokenResponse is the OAuth2 token endpoint response (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// IntrospectionResponse is the RFC 7662 introspection response; inactive tokens only carry Active
+type IntrospectionResponse struct {
+	Active      bool     `json:"active"`
+	TokenType   string   `json:"token_type,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	Subject     string   `json:"sub,omitempty"`
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	IssuedAt    int64    `json:"iat,omitempty"`
+	ExpiresAt   int64    `json:"exp,omitempty"`
+	Issuer      string   `json:"iss,omitempty"`
+	Audience    string   `json:"aud,omitempty"`
+
+	Actor *IntrospectionActor `json:"act,omitempty"` // set for impersonation tokens
+}
+
+// IntrospectionActor names who is really acting behind an impersonation token (RFC 8693 "act")
+type IntrospectionActor struct {
+	Subject string `json:"sub"`
+}
+
+type OIDCProviderResponse struct {
+	Name string `json:"name"`
+}
+
+// OIDCAuthorizeResponse carries the provider URL the browser must be sent to
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+
+	// State is bound to the browser through a cookie, never sent in the body
+	State string `json:"-"`
+}
+
+type IdentityResponse struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       *string    `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OIDCCallbackResult holds either a login (Login, tokens) or a newly linked identity
+type OIDCCallbackResult struct {
+	Login        *LoginResponse
+	AccessToken  string
+	RefreshToken string
+	Identity     *IdentityResponse
+}
+
+type PasskeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 type SessionResponse struct {
@@ -98,27 +347,150 @@ type PasswordResetToken struct {
 	CreatedAt time.Time
 }
 
+type SecurityEvent struct {
+	ID        string
+	UserID    string
+	SessionID string
+	EventType string
+	IPAddress string
+	UserAgent string
+	Details   map[string]interface{}
+	CreatedAt time.Time
+}
+
+const (
+	SecurityEventRefreshTokenReuse  = "refresh_token_reuse"
+	SecurityEventImpersonationStart = "impersonation_started"
+	SecurityEventImpersonationEnd   = "impersonation_ended"
+)
+
+type UserMFA struct {
+	UserID       string
+	TOTPSecret   string
+	EnabledAt    *time.Time
+	LastUsedStep *int64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type APIKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+type ServiceAccount struct {
+	ID        string
+	Name      string
+	Role      string
+	IsBlocked bool
+	CreatedAt time.Time
+}
+
+type ClientCredential struct {
+	ID         string
+	UserID     string
+	ClientID   string
+	Name       string
+	SecretHash string
+	Scopes     []string
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+type Identity struct {
+	ID          string
+	UserID      string
+	Provider    string
+	Subject     string
+	Email       *string
+	LastLoginAt *time.Time
+	CreatedAt   time.Time
+}
+
+// Passkey is a WebAuthn credential. PublicKey is the COSE_Key the authenticator registered.
+type Passkey struct {
+	ID           string
+	UserID       string
+	Name         string
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	Transports   []string
+	LastUsedAt   *time.Time
+	CreatedAt    time.Time
+}
+
+// Impersonation is a support user acting as another user, bound to the actor's session
+type Impersonation struct {
+	ID             string
+	ActorID        string
+	ActorSessionID string
+	TargetID       string
+	Reason         string
+	IPAddress      string
+	UserAgent      string
+	ExpiresAt      time.Time
+	EndedAt        *time.Time
+	CreatedAt      time.Time
+}
+
+// OIDCAuthState is a pending authorization code flow.
+// UserID is set when a signed-in user is linking a provider rather than logging in.
+type OIDCAuthState struct {
+	ID           string
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	UserID       *string
+	StaySignedIn bool
+}
+
 type Role struct {
 	ID          string
 	Name        string
 	Description string
+	Permissions []string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+type Permission struct {
+	ID          string
+	Name        string
+	Description string
+	CreatedAt   time.Time
+}
+
 // -------------------------
 // JWT Claims
 // -------------------------
 
 type AccessTokenClaims struct {
-	UserID    string `json:"user_id"`
-	Email     string `json:"email"`
-	Role      string `json:"role"`
-	SessionID string `json:"session_id"`
-	IssuedAt  int64  `json:"iat"`
-	ExpiresAt int64  `json:"exp"`
-	Issuer    string `json:"iss"`
-	Audience  string `json:"aud"`
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"` // only present when embedding is enabled
+	SessionID   string   `json:"session_id"`            // empty for client credentials tokens
+	ClientID    string   `json:"client_id,omitempty"`   // set for client credentials tokens
+	Scopes      []string `json:"scope,omitempty"`       // granted scopes of client credentials tokens
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+	Issuer      string   `json:"iss"`
+	Audience    string   `json:"aud"`
+
+	// Set for impersonation tokens: UserID is the impersonated user, ImpersonatorID (act.sub) the real actor
+	ImpersonatorID  string `json:"-"`
+	ImpersonationID string `json:"impersonation_id,omitempty"`
 }
 
 type RefreshTokenClaims struct {
@@ -130,6 +502,13 @@ type RefreshTokenClaims struct {
 	Audience  string `json:"aud"`
 }
 
+type MFAChallengeClaims struct {
+	UserID       string `json:"user_id"`
+	StaySignedIn bool   `json:"stay_signed_in"`
+	IssuedAt     int64  `json:"iat"`
+	ExpiresAt    int64  `json:"exp"`
+}
+
 // -------------------------
 // Context Keys
 // -------------------------
@@ -145,9 +524,18 @@ const (
 // User Context (for middleware)
 // -------------------------
 
+// UserContext describes the caller. Requests authenticated with an API key or a client
+// credentials token carry APIKeyID or ClientID instead of SessionID, and Permissions
+// narrowed to the granted scopes. Impersonated requests carry no SessionID either; ID is
+// the impersonated user and ImpersonatorID the staff member acting as them.
 type UserContext struct {
-	ID        string
-	Email     string
-	Role      string
-	SessionID string
+	ID              string
+	Email           string
+	Role            string
+	Permissions     []string
+	SessionID       string
+	APIKeyID        string
+	ClientID        string
+	ImpersonatorID  string
+	ImpersonationID string
 }
@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"rest_api_poc/internal/domain/audit"
 	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/infra/notification"
+	"rest_api_poc/internal/shared/logger"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -12,24 +15,45 @@ type Module struct {
 	Service    *Service
 	Repository *Repository
 	JWTService *JWTService
+	Activity   *SessionActivity // closed by the caller on shutdown
 }
 
-// NewModule creates a new auth module with all dependencies
-func NewModule(db *pgxpool.Pool, cfg *config.Config, cache AuthCache) *Module {
+// NewModule creates a new auth module with all dependencies.
+// attempts may be nil, in which case failed logins are tracked in Postgres.
+// challenges may be nil, in which case WebAuthn challenges are kept in Postgres.
+// notifier may be nil, in which case no emails are sent.
+// auditor may be nil, in which case nothing is recorded in the audit log.
+func NewModule(db *pgxpool.Pool, cfg *config.Config, cache AuthCache, attempts LoginAttemptStore, challenges WebAuthnChallengeStore, notifier notification.Notifier, auditor audit.Recorder) *Module {
 	// Create repository
 	repo := NewRepository(db)
 
+	if attempts == nil {
+		attempts = NewDBLoginAttemptStore(repo)
+	}
+	if challenges == nil {
+		challenges = NewDBWebAuthnChallengeStore(repo)
+	}
+
+	// Load signing keys (HS256 secret or asymmetric keyset)
+	keys, err := LoadKeySet(&cfg.Auth)
+	if err != nil {
+		logger.Fatal("Failed to load JWT signing keys: %v", err)
+	}
+
 	// Create JWT service
 	jwtService := NewJWTService(
-		cfg.Auth.JWTSecret,
+		keys,
 		cfg.Auth.JWTIssuer,
 		cfg.Auth.Audience[0],
 		cfg.Auth.AccessTokenLifetime,
 		cfg.Auth.RefreshTokenLifetime,
 	)
 
+	// Session activity is buffered in memory and written in batches
+	activity := NewSessionActivity(repo, &cfg.Auth)
+
 	// Create service
-	service := NewService(repo, cfg, cache, cfg.Cache.TTL)
+	service := NewService(repo, jwtService, cfg, cache, cfg.Cache.TTL, attempts, challenges, activity, notifier, auditor)
 
 	// Create handler
 	handler := NewHandler(service, cfg)
@@ -39,5 +63,6 @@ func NewModule(db *pgxpool.Pool, cfg *config.Config, cache AuthCache) *Module {
 		Service:    service,
 		Repository: repo,
 		JWTService: jwtService,
+		Activity:   activity,
 	}
 }
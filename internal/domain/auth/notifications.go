@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"rest_api_poc/internal/infra/notification"
+	"rest_api_poc/internal/shared/httpUtils"
+	"rest_api_poc/internal/shared/logger"
+	"time"
+)
+
+// notify renders a template and queues it for the user.
+// Notifications are best-effort: failures are logged and never fail the calling flow.
+func (s *Service) notify(ctx context.Context, template, to string, data any) {
+	if s.notifier == nil {
+		return
+	}
+
+	msg, err := notification.Render(template, s.config.Notification.AppName, to, data)
+	if err != nil {
+		logger.Error("failed to render %s notification: %v", template, err)
+		return
+	}
+
+	if err := s.notifier.Send(ctx, msg); err != nil {
+		logger.Error("failed to queue %s notification for %s: %v", template, to, err)
+	}
+}
+
+// notifyIfNewDevice alerts the user when a login comes from a user agent never seen on their account.
+// The very first login of an account is not considered suspicious.
+func (s *Service) notifyIfNewDevice(ctx context.Context, user *UserWithAuth, r *http.Request) {
+	known, err := s.repo.IsKnownDevice(ctx, user.ID, r.UserAgent())
+	if err != nil {
+		logger.Warn("failed to check login device for user %s: %v", user.ID, err)
+		return
+	}
+	if known {
+		return
+	}
+
+	s.notify(ctx, notification.TemplateNewDeviceLogin, user.Email, notification.NewDeviceLoginData{
+		Name:      user.FirstName,
+		Device:    formatDeviceName(parseDeviceInfo(r), r.UserAgent()),
+		IPAddress: httpUtils.ClientIP(r),
+		Time:      formatNotificationTime(time.Now()),
+	})
+}
+
+func formatNotificationTime(t time.Time) string {
+	return t.UTC().Format("Jan 2, 2006 at 15:04 UTC")
+}
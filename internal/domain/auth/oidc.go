@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"rest_api_poc/internal/infra/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidIDToken     = errors.New("invalid ID token")
+	ErrOIDCExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	// oidcKeyRefreshInterval limits JWKS refetches triggered by tokens with an unknown kid
+	oidcKeyRefreshInterval = time.Minute
+	oidcHTTPTimeout        = 10 * time.Second
+	oidcMaxResponseBytes   = 1 << 20
+)
+
+// OIDCProvider talks to one external OpenID Connect provider.
+// Discovery and keys are fetched on first use so an unreachable provider never blocks startup.
+type OIDCProvider struct {
+	config config.OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*SigningKey
+	keysFetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// OIDCClaims are the verified ID token claims used to find or create the local user
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+// NewOIDCProviders creates a client for every configured provider, keyed by name
+func NewOIDCProviders(cfgs []config.OIDCProviderConfig) map[string]*OIDCProvider {
+	providers := make(map[string]*OIDCProvider, len(cfgs))
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = &OIDCProvider{
+			config: cfg,
+			client: &http.Client{Timeout: oidcHTTPTimeout},
+		}
+	}
+	return providers
+}
+
+// AuthCodeURL builds the authorization request for the code flow with PKCE (S256)
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCClaims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	useBasic := p.config.ClientSecret != "" && p.supportsBasicAuth(d)
+	if !useBasic {
+		form.Set("client_id", p.config.ClientID)
+		if p.config.ClientSecret != "" {
+			form.Set("client_secret", p.config.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before Basic encoding
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("%w: unreadable response (status %d)", ErrOIDCExchangeFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResp.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrOIDCExchangeFailed, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrOIDCExchangeFailed)
+	}
+
+	return p.verifyIDToken(ctx, d, tokenResp.IDToken, nonce)
+}
+
+// verifyIDToken checks signature, issuer, audience, expiry and nonce (OIDC Core section 3.1.3.7)
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, d *oidcDiscovery, raw, nonce string) (*OIDCClaims, error) {
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		return p.verificationKey(ctx, d, token)
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	if getStringClaim(claims, "iss") != d.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	}
+	audience := getAudienceClaim(claims)
+	if !containsString(audience, p.config.ClientID) {
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	}
+	if len(audience) > 1 && getStringClaim(claims, "azp") != p.config.ClientID {
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+	if getInt64Claim(claims, "exp") == 0 {
+		return nil, fmt.Errorf("%w: missing expiry", ErrInvalidIDToken)
+	}
+	if getStringClaim(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	result := &OIDCClaims{
+		Subject:    getStringClaim(claims, "sub"),
+		Email:      strings.ToLower(getStringClaim(claims, "email")),
+		GivenName:  getStringClaim(claims, "given_name"),
+		FamilyName: getStringClaim(claims, "family_name"),
+		Name:       getStringClaim(claims, "name"),
+	}
+	// Some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+	if result.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return result, nil
+}
+
+// verificationKey resolves the provider key for an ID token, refetching the JWKS once
+// per interval when the kid is unknown (the provider may have rotated its keys)
+func (p *OIDCProvider) verificationKey(ctx context.Context, d *oidcDiscovery, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := p.lookupKey(kid)
+	if key == nil && time.Since(p.keysFetchedAt) > oidcKeyRefreshInterval {
+		if err := p.fetchKeys(ctx, d.JWKSURI); err != nil {
+			return nil, err
+		}
+		key = p.lookupKey(kid)
+	}
+	if key == nil {
+		return nil, ErrUnknownSigningKey
+	}
+
+	// The algorithm is pinned per key; never trust the header alone.
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.PublicKey, nil
+}
+
+// lookupKey finds a key by kid; tokens without kid are accepted only when the set has a single key
+func (p *OIDCProvider) lookupKey(kid string) *SigningKey {
+	if kid != "" {
+		return p.keys[kid]
+	}
+	if len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// fetchKeys replaces the cached JWKS; must be called with p.mu held
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) error {
+	p.keysFetchedAt = time.Now()
+
+	var set JWKSet
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return fmt.Errorf("failed to fetch JWKS of %s: %w", p.config.Name, err)
+	}
+
+	keys := make(map[string]*SigningKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk)
+		if err != nil {
+			// Providers may publish key types we don't support next to ones we do
+			continue
+		}
+		keys[key.ID] = key
+	}
+	p.keys = keys
+	return nil
+}
+
+// getDiscovery loads the provider metadata once; the issuer must match the configuration exactly
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := p.getJSON(ctx, p.config.Issuer+oidcDiscoveryPath, &d); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.config.Name, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q of %s does not match configuration", d.Issuer, p.config.Name)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete discovery document for %s", p.config.Name)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// supportsBasicAuth reports whether client_secret_basic may be used; it is the default when unspecified
+func (p *OIDCProvider) supportsBasicAuth(d *oidcDiscovery) bool {
+	return len(d.TokenAuthMethods) == 0 || containsString(d.TokenAuthMethods, "client_secret_basic")
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(out)
+}
+
+// pkceChallenge derives the S256 code challenge (RFC 7636 section 4.2)
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// getAudienceClaim returns aud, which may be a single string or an array
+func getAudienceClaim(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		values := make([]string, 0, len(aud))
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -6,24 +6,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a password using bcrypt
-func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %w", err)
-	}
-	return string(hashedBytes), nil
-}
-
-// ComparePassword compares a plain password with a hashed password
-func ComparePassword(hashedPassword, plainPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-}
-
 // GenerateOTP generates a 6-digit one-time password
 func GenerateOTP() (string, error) {
 	// Generate a random number between 100000 and 999999
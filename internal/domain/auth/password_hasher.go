@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"rest_api_poc/internal/infra/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashAlgorithmArgon2id = "argon2id"
+	HashAlgorithmBcrypt   = "bcrypt"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	ErrPasswordMismatch   = errors.New("password does not match")
+	ErrUnknownHashFormat  = errors.New("unknown password hash format")
+	ErrInvalidArgon2Hash  = errors.New("invalid argon2id hash")
+	ErrUnsupportedVersion = errors.New("unsupported argon2 version")
+)
+
+// argon2Params are encoded into every hash so old hashes stay verifiable after a change
+type argon2Params struct {
+	memory      uint32 // KiB
+	iterations  uint32
+	parallelism uint8
+}
+
+// PasswordHasher creates hashes with the configured algorithm and parameters.
+//
+// Hashes are self-describing: bcrypt ($2a$/$2b$/$2y$) embeds its cost and argon2id uses the
+// PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$hash). ComparePassword therefore
+// verifies any stored hash, and NeedsRehash tells when one is weaker than the current policy.
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Params
+}
+
+func NewPasswordHasher(cfg *config.AuthConfig) *PasswordHasher {
+	return &PasswordHasher{
+		algorithm:  cfg.PasswordHashAlgorithm,
+		bcryptCost: cfg.BcryptCost,
+		argon2: argon2Params{
+			memory:      cfg.Argon2Memory,
+			iterations:  cfg.Argon2Iterations,
+			parallelism: cfg.Argon2Parallelism,
+		},
+	}
+}
+
+// Hash hashes a password with the configured algorithm
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.algorithm == HashAlgorithmBcrypt {
+		hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hashedBytes), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	p := h.argon2
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// NeedsRehash reports whether a stored hash uses another algorithm or weaker parameters
+// than the current configuration. Unknown formats are left alone.
+func (h *PasswordHasher) NeedsRehash(hashedPassword string) bool {
+	switch {
+	case isBcryptHash(hashedPassword):
+		if h.algorithm != HashAlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		return err == nil && cost < h.bcryptCost
+
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		if h.algorithm != HashAlgorithmArgon2id {
+			return true
+		}
+		p, _, _, err := decodeArgon2Hash(hashedPassword)
+		if err != nil {
+			return false
+		}
+		return p.memory < h.argon2.memory || p.iterations < h.argon2.iterations || p.parallelism != h.argon2.parallelism
+	}
+
+	return false
+}
+
+// ComparePassword compares a plain password with a hashed password of any supported format.
+// Returns ErrPasswordMismatch when the password is wrong.
+func ComparePassword(hashedPassword, plainPassword string) error {
+	switch {
+	case isBcryptHash(hashedPassword):
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		p, salt, key, err := decodeArgon2Hash(hashedPassword)
+		if err != nil {
+			return err
+		}
+		other := argon2.IDKey([]byte(plainPassword), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+
+	return ErrUnknownHashFormat
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// decodeArgon2Hash parses $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func decodeArgon2Hash(hash string) (*argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, ErrInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, ErrInvalidArgon2Hash
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, ErrUnsupportedVersion
+	}
+
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, nil, nil, ErrInvalidArgon2Hash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidArgon2Hash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidArgon2Hash
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/shared/logger"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Password policy rule identifiers returned to clients
+const (
+	PasswordRuleMinLength = "min_length"
+	PasswordRuleMaxLength = "max_length"
+	PasswordRuleUppercase = "uppercase"
+	PasswordRuleLowercase = "lowercase"
+	PasswordRuleDigit     = "digit"
+	PasswordRuleSymbol    = "symbol"
+	PasswordRuleNotEmail  = "not_email"
+	PasswordRuleHistory   = "history"
+	PasswordRuleBreached  = "breached"
+)
+
+// PasswordRuleViolation is a single failed policy rule
+type PasswordRuleViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a candidate password failed
+type PasswordPolicyError struct {
+	Violations []PasswordRuleViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password policy violated: " + strings.Join(rules, ", ")
+}
+
+// PasswordPolicy validates new passwords. It only applies when a password is set;
+// existing passwords keep working until they are changed.
+type PasswordPolicy struct {
+	minLength      int
+	maxBytes       int
+	requireUpper   bool
+	requireLower   bool
+	requireDigit   bool
+	requireSymbol  bool
+	historySize    int
+	breachedDir    string
+	breachMinCount int
+}
+
+func NewPasswordPolicy(cfg *config.AuthConfig) *PasswordPolicy {
+	return &PasswordPolicy{
+		minLength:      cfg.PasswordMinLength,
+		maxBytes:       cfg.PasswordMaxBytes,
+		requireUpper:   cfg.PasswordRequireUpper,
+		requireLower:   cfg.PasswordRequireLower,
+		requireDigit:   cfg.PasswordRequireDigit,
+		requireSymbol:  cfg.PasswordRequireSymbol,
+		historySize:    cfg.PasswordHistorySize,
+		breachedDir:    cfg.BreachedPasswordsDir,
+		breachMinCount: cfg.BreachedPasswordMinCount,
+	}
+}
+
+// Validate checks password against every rule and returns a *PasswordPolicyError listing all failures.
+// previousHashes are the user's current and recent password hashes (empty for new accounts).
+func (p *PasswordPolicy) Validate(password, email string, previousHashes []string) error {
+	var violations []PasswordRuleViolation
+	fail := func(rule, format string, args ...any) {
+		violations = append(violations, PasswordRuleViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len([]rune(password)) < p.minLength {
+		fail(PasswordRuleMinLength, "Password must be at least %d characters long", p.minLength)
+	}
+	// bcrypt silently ignores everything after 72 bytes
+	if p.maxBytes > 0 && len(password) > p.maxBytes {
+		fail(PasswordRuleMaxLength, "Password must not be longer than %d bytes", p.maxBytes)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			hasSymbol = true
+		}
+	}
+	if p.requireUpper && !hasUpper {
+		fail(PasswordRuleUppercase, "Password must contain an uppercase letter")
+	}
+	if p.requireLower && !hasLower {
+		fail(PasswordRuleLowercase, "Password must contain a lowercase letter")
+	}
+	if p.requireDigit && !hasDigit {
+		fail(PasswordRuleDigit, "Password must contain a digit")
+	}
+	if p.requireSymbol && !hasSymbol {
+		fail(PasswordRuleSymbol, "Password must contain a symbol")
+	}
+
+	if matchesEmail(password, email) {
+		fail(PasswordRuleNotEmail, "Password must not be your email address")
+	}
+
+	for _, hash := range previousHashes {
+		if ComparePassword(hash, password) == nil {
+			if p.historySize > 0 {
+				fail(PasswordRuleHistory, "Password must not match any of your last %d passwords", p.historySize)
+			} else {
+				fail(PasswordRuleHistory, "Password must differ from your current password")
+			}
+			break
+		}
+	}
+
+	breached, err := p.isBreached(password)
+	if err != nil {
+		// Fail open: a missing or unreadable corpus must not block password changes
+		logger.Warn("breached password check failed: %v", err)
+	}
+	if breached {
+		fail(PasswordRuleBreached, "Password has appeared in a data breach, please choose another one")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func matchesEmail(password, email string) bool {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false
+	}
+	if strings.EqualFold(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return local != "" && strings.EqualFold(password, local)
+}
+
+// isBreached looks the password up in a local copy of the Pwned Passwords range files.
+//
+// The directory holds one file per 5-character SHA-1 prefix (named "ABCDE" or "ABCDE.txt"),
+// each listing "SUFFIX:COUNT" lines exactly like the k-anonymity range API. Only the prefix
+// file is read, so the full corpus never has to be loaded or indexed.
+func (p *PasswordPolicy) isBreached(password string) (bool, error) {
+	if p.breachedDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(p.breachedDir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(p.breachedDir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open breached password range %s: %w", prefix, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, countStr, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			// Entries without a count are treated as breached
+			return true, nil
+		}
+		return count >= p.breachMinCount, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password range %s: %w", prefix, err)
+	}
+
+	return false, nil
+}
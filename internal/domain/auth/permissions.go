@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"regexp"
+	"rest_api_poc/internal/domain/audit"
+)
+
+// Permissions granted to roles through the role_permissions table.
+// Routes check permissions instead of role names, so custom roles work without code changes.
+const (
+	PermissionProductsWrite    = "products:write"
+	PermissionProductsDelete   = "products:delete"
+	PermissionProductsTrash    = "products:trash"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersWrite       = "users:write"
+	PermissionUsersBlock       = "users:block"
+	PermissionUsersSessions    = "users:sessions"
+	PermissionUsersMFA         = "users:mfa"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionRolesRead        = "roles:read"
+	PermissionRolesWrite       = "roles:write"
+	PermissionAuditRead        = audit.PermissionRead
+
+	PermissionServiceAccountsManage = "service_accounts:manage"
+	PermissionTokensIntrospect      = "tokens:introspect"
+	PermissionTokensRevoke          = "tokens:revoke"
+)
+
+// roleNamePattern keeps role names short, lowercase and URL friendly
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// HasPermission reports whether the authenticated user holds a permission
+func (u *UserContext) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
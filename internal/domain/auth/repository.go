@@ -3,9 +3,11 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -53,7 +55,7 @@ func (r *Repository) GetActiveSessionIDsByUserID(ctx context.Context, userID str
 func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*UserWithAuth, error) {
 	query := `
 		SELECT u.id, u.first_name, u.last_name, u.email, u.password, 
-		       u.is_active, u.is_blocked, u.created_at, u.updated_at, u.deleted_at,
+		       u.is_active, u.is_blocked, u.is_service_account, u.email_verified_at, u.created_at, u.updated_at, u.deleted_at,
 		       ro.name as role_name
 		FROM users u
 		JOIN roles ro ON u.role_id = ro.id
@@ -69,6 +71,8 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*UserWit
 		&user.Password,
 		&user.IsActive,
 		&user.IsBlocked,
+		&user.IsServiceAccount,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.DeletedAt,
@@ -86,7 +90,7 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*UserWit
 func (r *Repository) GetUserByID(ctx context.Context, userID string) (*UserWithAuth, error) {
 	query := `
 		SELECT u.id, u.first_name, u.last_name, u.email, u.password, 
-		       u.is_active, u.is_blocked, u.created_at, u.updated_at, u.deleted_at,
+		       u.is_active, u.is_blocked, u.is_service_account, u.email_verified_at, u.created_at, u.updated_at, u.deleted_at,
 		       ro.name as role_name
 		FROM users u
 		JOIN roles ro ON u.role_id = ro.id
@@ -102,6 +106,8 @@ func (r *Repository) GetUserByID(ctx context.Context, userID string) (*UserWithA
 		&user.Password,
 		&user.IsActive,
 		&user.IsBlocked,
+		&user.IsServiceAccount,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.DeletedAt,
@@ -132,15 +138,15 @@ func (r *Repository) CreateUser(ctx context.Context, firstName, lastName, email,
 	return userID, nil
 }
 
-// UpdateUserPassword updates a user's password
-func (r *Repository) UpdateUserPassword(ctx context.Context, userID, hashedPassword string) error {
+// UpdateUserPassword updates a user's password on behalf of updatedBy
+func (r *Repository) UpdateUserPassword(ctx context.Context, userID, hashedPassword, updatedBy string) error {
 	query := `
 		UPDATE users 
-		SET password = $1, updated_at = NOW()
+		SET password = $1, updated_by = NULLIF($3, '')::uuid, updated_at = NOW()
 		WHERE id = $2 AND deleted_at IS NULL
 	`
 
-	_, err := r.db.Exec(ctx, query, hashedPassword, userID)
+	_, err := r.db.Exec(ctx, query, hashedPassword, userID, updatedBy)
 	if err != nil {
 		return fmt.Errorf("failed to update user password: %w", err)
 	}
@@ -148,11 +154,88 @@ func (r *Repository) UpdateUserPassword(ctx context.Context, userID, hashedPassw
 	return nil
 }
 
+// ReplacePasswordHash swaps the stored hash for an equivalent one (same password, new algorithm
+// or cost). It only applies if the hash is still oldHash, so a concurrent password change wins.
+func (r *Repository) ReplacePasswordHash(ctx context.Context, userID, oldHash, newHash string) error {
+	query := `
+		UPDATE users
+		SET password = $1
+		WHERE id = $2 AND password = $3 AND deleted_at IS NULL
+	`
+
+	_, err := r.db.Exec(ctx, query, newHash, userID, oldHash)
+	if err != nil {
+		return fmt.Errorf("failed to replace password hash: %w", err)
+	}
+
+	return nil
+}
+
+// GetPasswordHistory returns the most recent password hashes of a user, newest first
+func (r *Repository) GetPasswordHistory(ctx context.Context, userID string, limit int) ([]string, error) {
+	query := `
+		SELECT password_hash
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password history: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan password history: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+// AddPasswordHistory records a password hash and prunes entries beyond the newest keep
+func (r *Repository) AddPasswordHistory(ctx context.Context, userID, passwordHash string, keep int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO password_history (user_id, password_hash, created_at) VALUES ($1, $2, NOW())`,
+		userID, passwordHash,
+	); err != nil {
+		return fmt.Errorf("failed to insert password history: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2
+		)
+	`, userID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 // BlockUser blocks a user and marks them as inactive
 func (r *Repository) BlockUser(ctx context.Context, userID, blockedBy string) error {
 	query := `
 		UPDATE users 
-		SET is_blocked = true, blocked_at = NOW(), blocked_by = $1, updated_at = NOW()
+		SET is_blocked = true, blocked_at = NOW(), blocked_by = $1, updated_by = $1, updated_at = NOW()
 		WHERE id = $2 AND deleted_at IS NULL
 	`
 
@@ -164,15 +247,15 @@ func (r *Repository) BlockUser(ctx context.Context, userID, blockedBy string) er
 	return nil
 }
 
-// UnblockUser unblocks a user
-func (r *Repository) UnblockUser(ctx context.Context, userID string) error {
+// UnblockUser unblocks a user on behalf of unblockedBy
+func (r *Repository) UnblockUser(ctx context.Context, userID, unblockedBy string) error {
 	query := `
 		UPDATE users 
-		SET is_blocked = false, blocked_at = NULL, blocked_by = NULL, updated_at = NOW()
+		SET is_blocked = false, blocked_at = NULL, blocked_by = NULL, updated_by = NULLIF($2, '')::uuid, updated_at = NOW()
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	_, err := r.db.Exec(ctx, query, userID)
+	_, err := r.db.Exec(ctx, query, userID, unblockedBy)
 	if err != nil {
 		return fmt.Errorf("failed to unblock user: %w", err)
 	}
@@ -216,6 +299,22 @@ func (r *Repository) CreateSession(ctx context.Context, session *Session) error
 	return nil
 }
 
+// IsKnownDevice reports whether the user has signed in with this user agent before.
+// Users without any session yet are treated as known so the first login raises no alert.
+func (r *Repository) IsKnownDevice(ctx context.Context, userID, userAgent string) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (SELECT 1 FROM user_sessions WHERE user_id = $1)
+		    OR EXISTS (SELECT 1 FROM user_sessions WHERE user_id = $1 AND user_agent = $2)
+	`
+
+	var known bool
+	if err := r.db.QueryRow(ctx, query, userID, userAgent).Scan(&known); err != nil {
+		return false, fmt.Errorf("failed to check known device: %w", err)
+	}
+
+	return known, nil
+}
+
 // GetSessionByRefreshTokenHash retrieves a session by refresh token hash
 func (r *Repository) GetSessionByRefreshTokenHash(ctx context.Context, tokenHash string) (*Session, error) {
 	query := `
@@ -336,6 +435,30 @@ func (r *Repository) GetUserSessions(ctx context.Context, userID string) ([]*Ses
 	return sessions, nil
 }
 
+// TouchSessions moves last_activity_at of active sessions forward to the given times in one statement
+func (r *Repository) TouchSessions(ctx context.Context, activity map[string]time.Time) error {
+	ids := make([]string, 0, len(activity))
+	times := make([]time.Time, 0, len(activity))
+	for id, at := range activity {
+		ids = append(ids, id)
+		times = append(times, at)
+	}
+
+	query := `
+		UPDATE user_sessions AS s
+		SET last_activity_at = GREATEST(s.last_activity_at, a.at)
+		FROM unnest($1::uuid[], $2::timestamp[]) AS a(id, at)
+		WHERE s.id = a.id AND s.is_active = true
+	`
+
+	_, err := r.db.Exec(ctx, query, ids, times)
+	if err != nil {
+		return fmt.Errorf("failed to update session activity: %w", err)
+	}
+
+	return nil
+}
+
 // UpdateSessionRefreshToken updates the refresh token hash for a session
 func (r *Repository) UpdateSessionRefreshToken(ctx context.Context, sessionID, newTokenHash string) error {
 	query := `
@@ -352,6 +475,63 @@ func (r *Repository) UpdateSessionRefreshToken(ctx context.Context, sessionID, n
 	return nil
 }
 
+// RotateSessionRefreshToken swaps the refresh token hash of a session and remembers the old hash.
+// The swap only happens if the session still holds oldTokenHash; it returns false when a concurrent
+// refresh won the race.
+func (r *Repository) RotateSessionRefreshToken(ctx context.Context, sessionID, oldTokenHash, newTokenHash string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `
+		UPDATE user_sessions
+		SET refresh_token_hash = $1, last_activity_at = NOW()
+		WHERE id = $2 AND refresh_token_hash = $3
+	`, newTokenHash, sessionID, oldTokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to update session refresh token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_session_rotated_tokens (token_hash, session_id, rotated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (token_hash) DO NOTHING
+	`, oldTokenHash, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record rotated refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetRotatedRefreshToken looks up a refresh token hash that was already rotated out.
+// It returns the owning session and whether the rotation happened within the grace window.
+func (r *Repository) GetRotatedRefreshToken(ctx context.Context, tokenHash string, grace time.Duration) (string, bool, error) {
+	query := `
+		SELECT session_id, rotated_at > NOW() - make_interval(secs => $2)
+		FROM user_session_rotated_tokens
+		WHERE token_hash = $1
+	`
+
+	var sessionID string
+	var withinGrace bool
+	err := r.db.QueryRow(ctx, query, tokenHash, grace.Seconds()).Scan(&sessionID, &withinGrace)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get rotated refresh token: %w", err)
+	}
+
+	return sessionID, withinGrace, nil
+}
+
 // InvalidateSession marks a session as inactive
 func (r *Repository) InvalidateSession(ctx context.Context, sessionID string) error {
 	query := `
@@ -456,20 +636,1427 @@ func (r *Repository) MarkPasswordResetTokenAsUsed(ctx context.Context, tokenID s
 	return nil
 }
 
+// -------------------------
+// Passwordless Login
+// -------------------------
+
+// ReplaceLoginToken stores a new sign-in token for the user's current address.
+// Unused earlier tokens are dropped so only the latest code and link work.
+func (r *Repository) ReplaceLoginToken(ctx context.Context, userID, email, tokenHash, otp string, lifetime time.Duration) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM login_tokens WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	); err != nil {
+		return fmt.Errorf("failed to delete login tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO login_tokens (user_id, email, token_hash, otp, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5), NOW())
+	`, userID, email, tokenHash, otp, lifetime.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to create login token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeLoginTokenByHash uses a magic link token once.
+// Returns the user ID, or pgx.ErrNoRows if the token is unknown, used, expired, exhausted or stale.
+func (r *Repository) ConsumeLoginTokenByHash(ctx context.Context, tokenHash string, maxAttempts int) (string, error) {
+	query := `
+		UPDATE login_tokens lt
+		SET used_at = NOW()
+		FROM users u
+		WHERE lt.token_hash = $1 AND lt.used_at IS NULL AND lt.expires_at > NOW() AND lt.attempts < $2
+		  AND u.id = lt.user_id AND u.email = lt.email AND u.deleted_at IS NULL
+		RETURNING lt.user_id
+	`
+
+	var userID string
+	if err := r.db.QueryRow(ctx, query, tokenHash, maxAttempts).Scan(&userID); err != nil {
+		return "", fmt.Errorf("failed to consume login token: %w", err)
+	}
+
+	return userID, nil
+}
+
+// ConsumeLoginTokenByOTP checks a code against the latest live token of an address.
+// A match uses the token; a mismatch counts an attempt. Returns the user ID and whether the
+// code matched, or pgx.ErrNoRows if the address has no live token.
+func (r *Repository) ConsumeLoginTokenByOTP(ctx context.Context, email, otp string, maxAttempts int) (string, bool, error) {
+	query := `
+		WITH token AS (
+			SELECT lt.id
+			FROM login_tokens lt
+			JOIN users u ON u.id = lt.user_id AND u.email = lt.email AND u.deleted_at IS NULL
+			WHERE lt.email = $1 AND lt.used_at IS NULL AND lt.expires_at > NOW() AND lt.attempts < $3
+			ORDER BY lt.created_at DESC
+			LIMIT 1
+			FOR UPDATE OF lt
+		)
+		UPDATE login_tokens lt
+		SET used_at = CASE WHEN lt.otp = $2 THEN NOW() END,
+		    attempts = lt.attempts + CASE WHEN lt.otp = $2 THEN 0 ELSE 1 END
+		FROM token
+		WHERE lt.id = token.id
+		RETURNING lt.user_id, lt.used_at IS NOT NULL
+	`
+
+	var userID string
+	var matched bool
+	if err := r.db.QueryRow(ctx, query, email, otp, maxAttempts).Scan(&userID, &matched); err != nil {
+		return "", false, fmt.Errorf("failed to check login code: %w", err)
+	}
+
+	return userID, matched, nil
+}
+
+// MarkEmailVerified records that the user proved ownership of their current address
+func (r *Repository) MarkEmailVerified(ctx context.Context, userID string) error {
+	if _, err := r.db.Exec(ctx,
+		`UPDATE users SET email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email_verified_at IS NULL`,
+		userID,
+	); err != nil {
+		return fmt.Errorf("failed to mark email as verified: %w", err)
+	}
+
+	return nil
+}
+
+// -------------------------
+// Email Verification
+// -------------------------
+
+// ReplaceEmailVerificationToken stores a new verification token for the given address and
+// discards any earlier unused ones, so only the most recent email works.
+func (r *Repository) ReplaceEmailVerificationToken(ctx context.Context, userID, email, tokenHash string, lifetime time.Duration) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM email_verification_tokens WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	); err != nil {
+		return fmt.Errorf("failed to delete email verification tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4), NOW())
+	`, userID, email, tokenHash, lifetime.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to create email verification token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail consumes a verification token and marks the address as verified.
+// The token only counts if the user still has the address it was issued for.
+// Returns the user ID, or pgx.ErrNoRows if the token is unknown, used, expired or stale.
+func (r *Repository) VerifyEmail(ctx context.Context, tokenHash string) (string, error) {
+	query := `
+		WITH token AS (
+			UPDATE email_verification_tokens
+			SET used_at = NOW()
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+			RETURNING user_id, email
+		)
+		UPDATE users u
+		SET email_verified_at = NOW(), updated_at = NOW()
+		FROM token
+		WHERE u.id = token.user_id AND u.email = token.email AND u.deleted_at IS NULL
+		RETURNING u.id
+	`
+
+	var userID string
+	if err := r.db.QueryRow(ctx, query, tokenHash).Scan(&userID); err != nil {
+		return "", fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return userID, nil
+}
+
+// -------------------------
+// Login Attempts
+// -------------------------
+
+// RegisterLoginFailure increments the failure counter of a key, starting a new window if the
+// previous one has expired, and returns the new count
+func (r *Repository) RegisterLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_attempts (attempt_key, failures, window_expires_at, updated_at)
+		VALUES ($1, 1, NOW() + make_interval(secs => $2), NOW())
+		ON CONFLICT (attempt_key) DO UPDATE
+		SET failures = CASE WHEN login_attempts.window_expires_at <= NOW() THEN 1 ELSE login_attempts.failures + 1 END,
+		    window_expires_at = CASE WHEN login_attempts.window_expires_at <= NOW() THEN EXCLUDED.window_expires_at ELSE login_attempts.window_expires_at END,
+		    updated_at = NOW()
+		RETURNING failures
+	`
+
+	var failures int
+	if err := r.db.QueryRow(ctx, query, key, window.Seconds()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to register login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// GetLoginAttempts returns the failures in the current window and whether the key is locked
+func (r *Repository) GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error) {
+	query := `
+		SELECT CASE WHEN window_expires_at > NOW() THEN failures ELSE 0 END,
+		       COALESCE(locked_until > NOW(), false)
+		FROM login_attempts
+		WHERE attempt_key = $1
+	`
+
+	var attempts LoginAttempts
+	err := r.db.QueryRow(ctx, query, key).Scan(&attempts.Failures, &attempts.Locked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &LoginAttempts{}, nil
+		}
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+
+	return &attempts, nil
+}
+
+// LockLoginAttempts locks a key for the given duration
+func (r *Repository) LockLoginAttempts(ctx context.Context, key string, duration time.Duration) error {
+	query := `
+		UPDATE login_attempts
+		SET locked_until = NOW() + make_interval(secs => $2), updated_at = NOW()
+		WHERE attempt_key = $1
+	`
+
+	_, err := r.db.Exec(ctx, query, key, duration.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to lock login attempts: %w", err)
+	}
+
+	return nil
+}
+
+// ClearLoginAttempts removes the counter and any lockout of a key
+func (r *Repository) ClearLoginAttempts(ctx context.Context, key string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM login_attempts WHERE attempt_key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("failed to clear login attempts: %w", err)
+	}
+
+	return nil
+}
+
+// -------------------------
+// Security Events
+// -------------------------
+
+// CreateSecurityEvent records a security relevant event (e.g. refresh token reuse)
+func (r *Repository) CreateSecurityEvent(ctx context.Context, event *SecurityEvent) error {
+	detailsJSON, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event details: %w", err)
+	}
+
+	query := `
+		INSERT INTO security_events (user_id, session_id, event_type, ip_address, user_agent, details, created_at)
+		VALUES (NULLIF($1, '')::uuid, NULLIF($2, '')::uuid, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`
+
+	err = r.db.QueryRow(ctx, query,
+		event.UserID,
+		event.SessionID,
+		event.EventType,
+		event.IPAddress,
+		event.UserAgent,
+		detailsJSON,
+	).Scan(&event.ID, &event.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create security event: %w", err)
+	}
+
+	return nil
+}
+
+// -------------------------
+// MFA (TOTP + Recovery Codes)
+// -------------------------
+
+// GetUserMFA retrieves the MFA enrollment for a user
+func (r *Repository) GetUserMFA(ctx context.Context, userID string) (*UserMFA, error) {
+	query := `
+		SELECT user_id, totp_secret, enabled_at, last_used_step, created_at, updated_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	var mfa UserMFA
+	err := r.db.QueryRow(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.TOTPSecret,
+		&mfa.EnabledAt,
+		&mfa.LastUsedStep,
+		&mfa.CreatedAt,
+		&mfa.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user mfa: %w", err)
+	}
+
+	return &mfa, nil
+}
+
+// UpsertPendingUserMFA stores a new, not yet confirmed TOTP secret.
+// An already enabled enrollment is never overwritten; it returns false in that case.
+func (r *Repository) UpsertPendingUserMFA(ctx context.Context, userID, secret string) (bool, error) {
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, last_used_step = NULL, updated_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return false, fmt.Errorf("failed to store pending user mfa: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// EnableUserMFA confirms a pending enrollment and records the step used to confirm it.
+// It returns false if the enrollment was already confirmed, e.g. by a concurrent request.
+func (r *Repository) EnableUserMFA(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_mfa
+		SET enabled_at = NOW(), last_used_step = $1, updated_at = NOW()
+		WHERE user_id = $2 AND enabled_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to enable user mfa: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// ConsumeTOTPStep records a used TOTP step. It returns false if the step (or a later one)
+// was already used, which means the code is being replayed.
+func (r *Repository) ConsumeTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_mfa
+		SET last_used_step = $1, updated_at = NOW()
+		WHERE user_id = $2 AND (last_used_step IS NULL OR last_used_step < $1)
+	`
+
+	result, err := r.db.Exec(ctx, query, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume totp step: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// DeleteUserMFA removes the MFA enrollment and all recovery codes of a user
+func (r *Repository) DeleteUserMFA(ctx context.Context, userID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete user mfa: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user with the given hashes
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, NOW())`,
+			userID, hash,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It returns false if no such code exists.
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// -------------------------
+// Roles & Permissions
+// -------------------------
+
+// roleSelect loads roles together with their permission names
+const roleSelect = `
+	SELECT ro.id, ro.name, COALESCE(ro.description, ''), ro.created_at, ro.updated_at,
+	       COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+	FROM roles ro
+	LEFT JOIN role_permissions rp ON rp.role_id = ro.id
+	LEFT JOIN permissions p ON p.id = rp.permission_id
+`
+
+func scanRole(row pgx.Row) (*Role, error) {
+	var role Role
+	err := row.Scan(
+		&role.ID,
+		&role.Name,
+		&role.Description,
+		&role.CreatedAt,
+		&role.UpdatedAt,
+		&role.Permissions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetUserPermissions returns the permission names granted to the user's role.
+// The result is never nil so it can be told apart from an unresolved set.
+func (r *Repository) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	query := `
+		SELECT p.name
+		FROM users u
+		JOIN role_permissions rp ON rp.role_id = u.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE u.id = $1
+		ORDER BY p.name
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions = append(permissions, name)
+	}
+
+	return permissions, rows.Err()
+}
+
+// ListRoles retrieves all roles with their permissions
+func (r *Repository) ListRoles(ctx context.Context) ([]*Role, error) {
+	query := roleSelect + `
+		GROUP BY ro.id
+		ORDER BY ro.name
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetRoleByID retrieves a role with its permissions
+func (r *Repository) GetRoleByID(ctx context.Context, roleID string) (*Role, error) {
+	query := roleSelect + `
+		WHERE ro.id = $1
+		GROUP BY ro.id
+	`
+
+	role, err := scanRole(r.db.QueryRow(ctx, query, roleID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role by ID: %w", err)
+	}
+
+	return role, nil
+}
+
+// GetRoleByName retrieves a role with its permissions
+func (r *Repository) GetRoleByName(ctx context.Context, name string) (*Role, error) {
+	query := roleSelect + `
+		WHERE ro.name = $1
+		GROUP BY ro.id
+	`
+
+	role, err := scanRole(r.db.QueryRow(ctx, query, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role by name: %w", err)
+	}
+
+	return role, nil
+}
+
+// ListPermissions retrieves every known permission
+func (r *Repository) ListPermissions(ctx context.Context) ([]*Permission, error) {
+	query := `
+		SELECT id, name, COALESCE(description, ''), created_at
+		FROM permissions
+		ORDER BY name
+	`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var permissions []*Permission
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions = append(permissions, &p)
+	}
+
+	return permissions, rows.Err()
+}
+
+// CreateRole creates a role and grants it the given permissions
+func (r *Repository) CreateRole(ctx context.Context, name, description string, permissions []string) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var roleID string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO roles (name, description, created_at, updated_at) VALUES ($1, NULLIF($2, ''), NOW(), NOW()) RETURNING id`,
+		name, description,
+	).Scan(&roleID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create role: %w", err)
+	}
+
+	if err := grantRolePermissions(ctx, tx, roleID, permissions); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return roleID, nil
+}
+
+// SetRolePermissions replaces the permissions of a role
+func (r *Repository) SetRolePermissions(ctx context.Context, roleID string, permissions []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return fmt.Errorf("failed to clear role permissions: %w", err)
+	}
+
+	if err := grantRolePermissions(ctx, tx, roleID, permissions); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE roles SET updated_at = NOW() WHERE id = $1`, roleID); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func grantRolePermissions(ctx context.Context, tx pgx.Tx, roleID string, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id, created_at)
+		SELECT $1, id, NOW() FROM permissions WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := tx.Exec(ctx, query, roleID, permissions); err != nil {
+		return fmt.Errorf("failed to grant role permissions: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserIDsByRoleID returns the users holding a role.
+// Used for cache invalidation and should be treated as best-effort.
+func (r *Repository) GetUserIDsByRoleID(ctx context.Context, roleID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT id FROM users WHERE role_id = $1 AND deleted_at IS NULL`, roleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users by role: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// -------------------------
+// API Keys
+// -------------------------
+
+// CreateAPIKey stores a new API key; expiresInDays <= 0 never expires
+func (r *Repository) CreateAPIKey(ctx context.Context, key *APIKey, expiresInDays int) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $6 > 0 THEN NOW() + make_interval(days => $6) END, NOW())
+		RETURNING id, expires_at, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		key.Scopes,
+		expiresInDays,
+	).Scan(&key.ID, &key.ExpiresAt, &key.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// ListAPIKeys retrieves the unrevoked API keys of a user, including expired ones
+func (r *Repository) ListAPIKeys(ctx context.Context, userID string) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetActiveAPIKeyByHash retrieves an unrevoked, unexpired API key by its hash
+func (r *Repository) GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, key_prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`
+
+	key, err := scanAPIKey(r.db.QueryRow(ctx, query, keyHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	var key APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RenameAPIKey changes the label of a user's API key. Returns pgx.ErrNoRows if not found.
+func (r *Repository) RenameAPIKey(ctx context.Context, userID, keyID, name string) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE api_keys SET name = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID, name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to rename API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// RevokeAPIKey revokes a user's API key. Returns pgx.ErrNoRows if not found.
+func (r *Repository) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// TouchAPIKey records that a key was used. Writes are limited to one per interval per key
+// so busy clients don't turn every request into an UPDATE.
+func (r *Repository) TouchAPIKey(ctx context.Context, keyID string, interval time.Duration) error {
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))
+	`
+
+	if _, err := r.db.Exec(ctx, query, keyID, interval.Seconds()); err != nil {
+		return fmt.Errorf("failed to update API key last use: %w", err)
+	}
+
+	return nil
+}
+
+// -------------------------
+// Service Accounts
+// -------------------------
+
+// CreateServiceAccount creates a non-human user with the given role and no usable password
+func (r *Repository) CreateServiceAccount(ctx context.Context, name, email, roleID string) (string, error) {
+	query := `
+		INSERT INTO users (first_name, last_name, email, password, role_id, is_active, is_service_account,
+		                   email_verified_at, created_at, updated_at)
+		VALUES ($1, 'Service Account', $2, '', $3, true, true, NOW(), NOW(), NOW())
+		RETURNING id
+	`
+
+	var userID string
+	if err := r.db.QueryRow(ctx, query, name, email, roleID).Scan(&userID); err != nil {
+		return "", fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	return userID, nil
+}
+
+// serviceAccountSelect loads service accounts with their role name
+const serviceAccountSelect = `
+	SELECT u.id, u.first_name, ro.name, u.is_blocked, u.created_at
+	FROM users u
+	JOIN roles ro ON u.role_id = ro.id
+	WHERE u.is_service_account AND u.deleted_at IS NULL
+`
+
+// ListServiceAccounts retrieves all service accounts
+func (r *Repository) ListServiceAccounts(ctx context.Context) ([]*ServiceAccount, error) {
+	rows, err := r.db.Query(ctx, serviceAccountSelect+` ORDER BY u.created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []*ServiceAccount
+	for rows.Next() {
+		var a ServiceAccount
+		if err := rows.Scan(&a.ID, &a.Name, &a.Role, &a.IsBlocked, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan service account: %w", err)
+		}
+		accounts = append(accounts, &a)
+	}
+
+	return accounts, rows.Err()
+}
+
+// GetServiceAccount retrieves a service account by ID
+func (r *Repository) GetServiceAccount(ctx context.Context, userID string) (*ServiceAccount, error) {
+	var a ServiceAccount
+	err := r.db.QueryRow(ctx, serviceAccountSelect+` AND u.id = $1`, userID).Scan(
+		&a.ID, &a.Name, &a.Role, &a.IsBlocked, &a.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+
+	return &a, nil
+}
+
+// CreateClientCredential stores a new client credential of a service account
+func (r *Repository) CreateClientCredential(ctx context.Context, c *ClientCredential) error {
+	query := `
+		INSERT INTO service_account_credentials (user_id, client_id, name, secret_hash, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query, c.UserID, c.ClientID, c.Name, c.SecretHash, c.Scopes).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create client credential: %w", err)
+	}
+
+	return nil
+}
+
+// ListClientCredentials retrieves the unrevoked client credentials of a service account
+func (r *Repository) ListClientCredentials(ctx context.Context, userID string) ([]*ClientCredential, error) {
+	query := `
+		SELECT id, user_id, client_id, name, secret_hash, scopes, last_used_at, revoked_at, created_at
+		FROM service_account_credentials
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list client credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []*ClientCredential
+	for rows.Next() {
+		c, err := scanClientCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan client credential: %w", err)
+		}
+		credentials = append(credentials, c)
+	}
+
+	return credentials, rows.Err()
+}
+
+// GetActiveClientCredential retrieves an unrevoked client credential by client ID
+func (r *Repository) GetActiveClientCredential(ctx context.Context, clientID string) (*ClientCredential, error) {
+	query := `
+		SELECT id, user_id, client_id, name, secret_hash, scopes, last_used_at, revoked_at, created_at
+		FROM service_account_credentials
+		WHERE client_id = $1 AND revoked_at IS NULL
+	`
+
+	c, err := scanClientCredential(r.db.QueryRow(ctx, query, clientID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client credential: %w", err)
+	}
+
+	return c, nil
+}
+
+func scanClientCredential(row pgx.Row) (*ClientCredential, error) {
+	var c ClientCredential
+	err := row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ClientID,
+		&c.Name,
+		&c.SecretHash,
+		&c.Scopes,
+		&c.LastUsedAt,
+		&c.RevokedAt,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateClientCredentialScopes replaces the scopes of a credential. Returns pgx.ErrNoRows if not found.
+func (r *Repository) UpdateClientCredentialScopes(ctx context.Context, userID, clientID string, scopes []string) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE service_account_credentials SET scopes = $3 WHERE client_id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		clientID, userID, scopes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update client credential: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// RevokeClientCredential revokes a credential. Returns pgx.ErrNoRows if not found.
+func (r *Repository) RevokeClientCredential(ctx context.Context, userID, clientID string) error {
+	result, err := r.db.Exec(ctx,
+		`UPDATE service_account_credentials SET revoked_at = NOW() WHERE client_id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		clientID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke client credential: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// TouchClientCredential records that a credential was used to obtain a token
+func (r *Repository) TouchClientCredential(ctx context.Context, credentialID string) error {
+	if _, err := r.db.Exec(ctx, `UPDATE service_account_credentials SET last_used_at = NOW() WHERE id = $1`, credentialID); err != nil {
+		return fmt.Errorf("failed to update client credential last use: %w", err)
+	}
+
+	return nil
+}
+
+// -------------------------
+// External Identities
+// -------------------------
+
+// CreateOIDCAuthState stores a pending authorization code flow and drops expired ones
+func (r *Repository) CreateOIDCAuthState(ctx context.Context, state *OIDCAuthState, lifetime time.Duration) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM oidc_auth_states WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to delete expired OIDC states: %w", err)
+	}
+
+	query := `
+		INSERT INTO oidc_auth_states (state_hash, provider, nonce, code_verifier, user_id, stay_signed_in, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW() + make_interval(secs => $7), NOW())
+		RETURNING id
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		state.StateHash,
+		state.Provider,
+		state.Nonce,
+		state.CodeVerifier,
+		state.UserID,
+		state.StaySignedIn,
+		lifetime.Seconds(),
+	).Scan(&state.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC state: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCAuthState deletes and returns an unexpired flow. Returns pgx.ErrNoRows if none matches.
+func (r *Repository) ConsumeOIDCAuthState(ctx context.Context, provider, stateHash string) (*OIDCAuthState, error) {
+	query := `
+		DELETE FROM oidc_auth_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING id, state_hash, provider, nonce, code_verifier, user_id, stay_signed_in
+	`
+
+	var state OIDCAuthState
+	err := r.db.QueryRow(ctx, query, stateHash, provider).Scan(
+		&state.ID,
+		&state.StateHash,
+		&state.Provider,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.UserID,
+		&state.StaySignedIn,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume OIDC state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// GetIdentity retrieves the identity of a provider subject
+func (r *Repository) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, last_login_at, created_at
+		FROM identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	identity, err := scanIdentity(r.db.QueryRow(ctx, query, provider, subject))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// ListIdentities retrieves the identities linked to a user
+func (r *Repository) ListIdentities(ctx context.Context, userID string) ([]*Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, last_login_at, created_at
+		FROM identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*Identity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func scanIdentity(row pgx.Row) (*Identity, error) {
+	var identity Identity
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.LastLoginAt,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity links an identity to a user.
+// Returns pgx.ErrNoRows if the subject or the user's link to this provider already exists.
+func (r *Repository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	return createIdentity(ctx, r.db, identity)
+}
+
+// queryRower is satisfied by both the pool and transactions
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func createIdentity(ctx context.Context, q queryRower, identity *Identity) error {
+	query := `
+		INSERT INTO identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := q.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity creates a user without a password, with an email verified by the
+// provider, and links the identity in the same transaction
+func (r *Repository) CreateUserWithIdentity(ctx context.Context, firstName, lastName, email string, identity *Identity) (string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (first_name, last_name, email, password, role_id, is_active, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, '', '00000000-0000-0000-0000-000000000004', true, NOW(), NOW(), NOW())
+		RETURNING id
+	`, firstName, lastName, email).Scan(&userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+
+	identity.UserID = userID
+	if err := createIdentity(ctx, tx, identity); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
+
+// TouchIdentity records a login through the identity and the email the provider reported
+func (r *Repository) TouchIdentity(ctx context.Context, identityID string, email *string) error {
+	if _, err := r.db.Exec(ctx,
+		`UPDATE identities SET last_login_at = NOW(), email = COALESCE($2, email) WHERE id = $1`,
+		identityID, email,
+	); err != nil {
+		return fmt.Errorf("failed to update identity last login: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteIdentity unlinks a user's identity at a provider. Returns pgx.ErrNoRows if not found.
+func (r *Repository) DeleteIdentity(ctx context.Context, userID, provider string) error {
+	result, err := r.db.Exec(ctx, `DELETE FROM identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// -------------------------
+// Passkeys
+// -------------------------
+
+// CreatePasskey stores a registered WebAuthn credential.
+// Returns pgx.ErrNoRows if the credential ID is already registered.
+func (r *Repository) CreatePasskey(ctx context.Context, passkey *Passkey) error {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, name, credential_id, public_key, sign_count, transports, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (credential_id) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		passkey.UserID,
+		passkey.Name,
+		passkey.CredentialID,
+		passkey.PublicKey,
+		passkey.SignCount,
+		passkey.Transports,
+	).Scan(&passkey.ID, &passkey.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create passkey: %w", err)
+	}
+
+	return nil
+}
+
+// ListPasskeys retrieves the passkeys of a user
+func (r *Repository) ListPasskeys(ctx context.Context, userID string) ([]*Passkey, error) {
+	query := `
+		SELECT id, user_id, name, credential_id, public_key, sign_count, transports, last_used_at, created_at
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys []*Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, rows.Err()
+}
+
+// GetPasskeyByCredentialID retrieves the passkey an assertion names
+func (r *Repository) GetPasskeyByCredentialID(ctx context.Context, credentialID []byte) (*Passkey, error) {
+	query := `
+		SELECT id, user_id, name, credential_id, public_key, sign_count, transports, last_used_at, created_at
+		FROM webauthn_credentials
+		WHERE credential_id = $1
+	`
+
+	passkey, err := scanPasskey(r.db.QueryRow(ctx, query, credentialID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	return passkey, nil
+}
+
+func scanPasskey(row pgx.Row) (*Passkey, error) {
+	var passkey Passkey
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.Name,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&passkey.SignCount,
+		&passkey.Transports,
+		&passkey.LastUsedAt,
+		&passkey.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// TouchPasskey records a use of the passkey and the signature counter it reported
+func (r *Repository) TouchPasskey(ctx context.Context, passkeyID string, signCount int64) error {
+	if _, err := r.db.Exec(ctx,
+		`UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW() WHERE id = $1`,
+		passkeyID, signCount,
+	); err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePasskey removes one of a user's passkeys. Returns pgx.ErrNoRows if not found.
+func (r *Repository) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	result, err := r.db.Exec(ctx, `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, passkeyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// CreateWebAuthnChallenge stores a pending WebAuthn ceremony and drops expired ones
+func (r *Repository) CreateWebAuthnChallenge(ctx context.Context, challengeHash string, challenge *WebAuthnChallenge, lifetime time.Duration) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to delete expired WebAuthn challenges: %w", err)
+	}
+
+	var userID *string
+	if challenge.UserID != "" {
+		userID = &challenge.UserID
+	}
+
+	query := `
+		INSERT INTO webauthn_challenges (challenge_hash, purpose, user_id, stay_signed_in, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW() + make_interval(secs => $5), NOW())
+	`
+
+	if _, err := r.db.Exec(ctx, query, challengeHash, challenge.Purpose, userID, challenge.StaySignedIn, lifetime.Seconds()); err != nil {
+		return fmt.Errorf("failed to create WebAuthn challenge: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnChallenge deletes and returns an unexpired challenge; found is false if none matches
+func (r *Repository) ConsumeWebAuthnChallenge(ctx context.Context, challengeHash string) (*WebAuthnChallenge, bool, error) {
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE challenge_hash = $1 AND expires_at > NOW()
+		RETURNING purpose, user_id, stay_signed_in
+	`
+
+	var challenge WebAuthnChallenge
+	var userID *string
+	err := r.db.QueryRow(ctx, query, challengeHash).Scan(&challenge.Purpose, &userID, &challenge.StaySignedIn)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to consume WebAuthn challenge: %w", err)
+	}
+	if userID != nil {
+		challenge.UserID = *userID
+	}
+
+	return &challenge, true, nil
+}
+
+// -------------------------
+// Impersonations
+// -------------------------
+
+// CreateImpersonation records the start of an impersonation
+func (r *Repository) CreateImpersonation(ctx context.Context, imp *Impersonation) error {
+	query := `
+		INSERT INTO impersonations (actor_id, actor_session_id, target_id, reason, ip_address, user_agent, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		imp.ActorID,
+		imp.ActorSessionID,
+		imp.TargetID,
+		imp.Reason,
+		imp.IPAddress,
+		imp.UserAgent,
+		imp.ExpiresAt,
+	).Scan(&imp.ID, &imp.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create impersonation: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveImpersonation returns an impersonation that has neither ended nor expired
+func (r *Repository) GetActiveImpersonation(ctx context.Context, id string) (*Impersonation, error) {
+	query := `
+		SELECT id, actor_id, actor_session_id, target_id, reason, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+		       expires_at, ended_at, created_at
+		FROM impersonations
+		WHERE id = $1 AND ended_at IS NULL AND expires_at > NOW()
+	`
+
+	var imp Impersonation
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&imp.ID,
+		&imp.ActorID,
+		&imp.ActorSessionID,
+		&imp.TargetID,
+		&imp.Reason,
+		&imp.IPAddress,
+		&imp.UserAgent,
+		&imp.ExpiresAt,
+		&imp.EndedAt,
+		&imp.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+
+	return &imp, nil
+}
+
+// EndImpersonation marks an impersonation as ended; it returns false if it had already ended
+func (r *Repository) EndImpersonation(ctx context.Context, id string) (bool, error) {
+	query := `
+		UPDATE impersonations
+		SET ended_at = NOW()
+		WHERE id = $1 AND ended_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to end impersonation: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
 // -------------------------
 // Helper Types
 // -------------------------
 
 type UserWithAuth struct {
-	ID        string
-	FirstName string
-	LastName  string
-	Email     string
-	Password  string
-	Role      string
-	IsActive  bool
-	IsBlocked bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt *time.Time
+	ID               string
+	FirstName        string
+	LastName         string
+	Email            string
+	Password         string
+	Role             string
+	IsActive         bool
+	IsBlocked        bool
+	IsServiceAccount bool // cannot log in with a password
+	EmailVerifiedAt  *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        *time.Time
 }
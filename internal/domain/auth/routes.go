@@ -9,12 +9,18 @@ import (
 // AuthMiddleware interface to avoid circular dependency
 type AuthMiddleware interface {
 	Authenticate(next http.Handler) http.Handler
+	RequireSession(next http.Handler) http.Handler
 }
 
 // RoleMiddleware interface to avoid circular dependency
 type RoleMiddleware interface {
-	RequireAdmin(next http.Handler) http.Handler
-	RequireRole(allowedRoles ...string) func(http.Handler) http.Handler
+	RequirePermission(permissions ...string) func(http.Handler) http.Handler
+}
+
+// RateLimiter interface to avoid circular dependency
+type RateLimiter interface {
+	Auth() func(http.Handler) http.Handler
+	User() func(http.Handler) http.Handler
 }
 
 // RegisterRoutes registers all auth routes
@@ -23,34 +29,110 @@ func RegisterRoutes(
 	handler *Handler,
 	authMiddleware AuthMiddleware,
 	roleMiddleware RoleMiddleware,
+	rateLimiter RateLimiter,
 	wrap func(func(http.ResponseWriter, *http.Request) error) http.HandlerFunc,
 ) {
+	// Public key discovery for services verifying our tokens
+	r.Get("/.well-known/jwks.json", wrap(handler.JWKS))
+
 	// Public routes (no authentication required)
 	r.Route("/v1/auth", func(r chi.Router) {
-		r.Post("/login", wrap(handler.Login))
-		r.Post("/register", wrap(handler.Register))
-		r.Post("/reset-password", wrap(handler.RequestPasswordReset))
-		r.Post("/reset-password/verify", wrap(handler.VerifyPasswordReset))
+		// Credential endpoints get a tight per-IP budget on top of the global one
+		r.Group(func(r chi.Router) {
+			r.Use(rateLimiter.Auth())
+
+			r.Post("/login", wrap(handler.Login))
+			r.Post("/register", wrap(handler.Register))
+			r.Post("/reset-password", wrap(handler.RequestPasswordReset))
+			r.Post("/reset-password/verify", wrap(handler.VerifyPasswordReset))
+			r.Post("/mfa/verify", wrap(handler.VerifyMFA))
+			r.Post("/mfa/passkey/options", wrap(handler.StartMFAPasskey))
+			r.Post("/passwordless/start", wrap(handler.StartPasswordless))
+			r.Post("/passwordless/verify", wrap(handler.VerifyPasswordless))
+			r.Post("/verify-email", wrap(handler.VerifyEmail))
+			r.Post("/resend-verification", wrap(handler.ResendVerification))
+			r.Post("/token", wrap(handler.Token))
+
+			// External OpenID Connect providers
+			r.Get("/oidc/providers", wrap(handler.ListOIDCProviders))
+			r.Post("/oidc/{provider}/authorize", wrap(handler.StartOIDCLogin))
+			r.Get("/oidc/{provider}/callback", wrap(handler.OIDCCallback))
+
+			// Passkeys (discoverable WebAuthn credentials)
+			r.Post("/passkeys/login/options", wrap(handler.StartPasskeyLogin))
+			r.Post("/passkeys/login", wrap(handler.FinishPasskeyLogin))
+		})
+
+		// Token checks by other services; client credentials are required, but resource
+		// servers may call these on every request, so only the global limit applies
+		r.Post("/introspect", wrap(handler.Introspect))
+		r.Post("/revoke", wrap(handler.Revoke))
 
 		// Protected routes (authentication required)
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware.Authenticate)
+			r.Use(rateLimiter.User())
 
-			r.Post("/refresh", wrap(handler.Refresh))
-			r.Post("/logout", wrap(handler.Logout))
-			r.Post("/logout-all", wrap(handler.LogoutAll))
 			r.Get("/me", wrap(handler.GetMe))
-			r.Post("/change-password", wrap(handler.ChangePassword))
-			r.Get("/sessions", wrap(handler.GetSessions))
-			r.Delete("/sessions/{id}", wrap(handler.DeleteSession))
+			r.Post("/impersonation/stop", wrap(handler.StopImpersonation))
+
+			// Account and credential management requires an interactive login, not an API key
+			r.Group(func(r chi.Router) {
+				r.Use(authMiddleware.RequireSession)
+
+				r.Post("/refresh", wrap(handler.Refresh))
+				r.Post("/logout", wrap(handler.Logout))
+				r.Post("/logout-all", wrap(handler.LogoutAll))
+				r.Post("/change-password", wrap(handler.ChangePassword))
+				r.Get("/sessions", wrap(handler.GetSessions))
+				r.Delete("/sessions/{id}", wrap(handler.DeleteSession))
+				r.Post("/mfa/enroll", wrap(handler.EnrollMFA))
+				r.Post("/mfa/enroll/confirm", wrap(handler.ConfirmMFA))
+				r.Post("/mfa/recovery-codes", wrap(handler.RegenerateRecoveryCodes))
+				r.Post("/mfa/disable", wrap(handler.DisableMFA))
+
+				r.Get("/api-keys", wrap(handler.ListAPIKeys))
+				r.Post("/api-keys", wrap(handler.CreateAPIKey))
+				r.Patch("/api-keys/{id}", wrap(handler.UpdateAPIKey))
+				r.Delete("/api-keys/{id}", wrap(handler.RevokeAPIKey))
+
+				r.Get("/me/identities", wrap(handler.ListIdentities))
+				r.Post("/me/identities/{provider}", wrap(handler.LinkIdentity))
+				r.Delete("/me/identities/{provider}", wrap(handler.UnlinkIdentity))
+
+				r.Get("/passkeys", wrap(handler.ListPasskeys))
+				r.Post("/passkeys/register/options", wrap(handler.StartPasskeyRegistration))
+				r.Post("/passkeys/register", wrap(handler.FinishPasskeyRegistration))
+				r.Delete("/passkeys/{id}", wrap(handler.DeletePasskey))
+			})
+
+			// Admin routes (each requires a dedicated permission)
+			r.With(roleMiddleware.RequirePermission(PermissionUsersBlock)).Post("/block-user/{id}", wrap(handler.BlockUser))
+			r.With(roleMiddleware.RequirePermission(PermissionUsersBlock)).Post("/unblock-user/{id}", wrap(handler.UnblockUser))
+			r.With(roleMiddleware.RequirePermission(PermissionUsersBlock)).Post("/unlock-user/{id}", wrap(handler.UnlockUser))
+			r.With(roleMiddleware.RequirePermission(PermissionUsersSessions)).Post("/logout-all-user-sessions/{id}", wrap(handler.LogoutAllUserSessions))
+			r.With(roleMiddleware.RequirePermission(PermissionUsersMFA)).Post("/mfa/reset/{id}", wrap(handler.ResetUserMFA))
+
+			// Impersonation must be started from an interactive login, never from another impersonation
+			r.With(authMiddleware.RequireSession, roleMiddleware.RequirePermission(PermissionUsersImpersonate)).Post("/impersonate/{id}", wrap(handler.StartImpersonation))
+
+			// Role management
+			r.With(roleMiddleware.RequirePermission(PermissionRolesRead)).Get("/roles", wrap(handler.ListRoles))
+			r.With(roleMiddleware.RequirePermission(PermissionRolesRead)).Get("/permissions", wrap(handler.ListPermissions))
+			r.With(roleMiddleware.RequirePermission(PermissionRolesWrite)).Post("/roles", wrap(handler.CreateRole))
+			r.With(roleMiddleware.RequirePermission(PermissionRolesWrite)).Put("/roles/{id}/permissions", wrap(handler.SetRolePermissions))
 
-			// Admin/Owner/System routes (requires admin, owner, or system role)
+			// Service account management; issuing secrets requires an interactive login
 			r.Group(func(r chi.Router) {
-				r.Use(roleMiddleware.RequireRole("owner", "admin", "system"))
+				r.Use(authMiddleware.RequireSession)
+				r.Use(roleMiddleware.RequirePermission(PermissionServiceAccountsManage))
 
-				r.Post("/block-user/{id}", wrap(handler.BlockUser))
-				r.Post("/unblock-user/{id}", wrap(handler.UnblockUser))
-				r.Post("/logout-all-user-sessions/{id}", wrap(handler.LogoutAllUserSessions))
+				r.Get("/service-accounts", wrap(handler.ListServiceAccounts))
+				r.Post("/service-accounts", wrap(handler.CreateServiceAccount))
+				r.Get("/service-accounts/{id}/credentials", wrap(handler.ListClientCredentials))
+				r.Post("/service-accounts/{id}/credentials", wrap(handler.CreateClientCredential))
+				r.Patch("/service-accounts/{id}/credentials/{clientId}", wrap(handler.UpdateClientCredential))
+				r.Delete("/service-accounts/{id}/credentials/{clientId}", wrap(handler.RevokeClientCredential))
 			})
 		})
 	})
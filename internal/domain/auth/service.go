@@ -2,10 +2,14 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"rest_api_poc/internal/domain/audit"
 	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/infra/notification"
 	"rest_api_poc/internal/shared/httpUtils"
 	"rest_api_poc/internal/shared/logger"
 	"strings"
@@ -15,14 +19,49 @@ import (
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrUserNotActive      = errors.New("user account is not active")
-	ErrUserBlocked        = errors.New("user account has been blocked")
-	ErrEmailAlreadyExists = errors.New("email already exists")
-	ErrInvalidOTP         = errors.New("invalid or expired OTP")
-	ErrSessionNotFound    = errors.New("session not found")
-	ErrSessionInactive    = errors.New("session is inactive")
-	ErrSessionExpired     = errors.New("session has expired")
+	ErrInvalidCredentials     = errors.New("invalid email or password")
+	ErrUserNotActive          = errors.New("user account is not active")
+	ErrUserBlocked            = errors.New("user account has been blocked")
+	ErrEmailAlreadyExists     = errors.New("email already exists")
+	ErrInvalidOTP             = errors.New("invalid or expired OTP")
+	ErrSessionNotFound        = errors.New("session not found")
+	ErrSessionInactive        = errors.New("session is inactive")
+	ErrSessionExpired         = errors.New("session has expired")
+	ErrSessionIdle            = errors.New("session has been idle for too long")
+	ErrRefreshTokenReused     = errors.New("refresh token reuse detected")
+	ErrAccountLocked          = errors.New("account is temporarily locked")
+	ErrTooManyAttempts        = errors.New("too many failed attempts")
+	ErrInvalidMFACode         = errors.New("invalid MFA code")
+	ErrMFANotEnrolled         = errors.New("MFA is not enrolled")
+	ErrMFAAlreadyEnabled      = errors.New("MFA is already enabled")
+	ErrEmailNotVerified       = errors.New("email address is not verified")
+	ErrInvalidVerifyToken     = errors.New("invalid or expired verification token")
+	ErrRoleNotFound           = errors.New("role not found")
+	ErrRoleAlreadyExists      = errors.New("role already exists")
+	ErrInvalidRoleName        = errors.New("invalid role name")
+	ErrUnknownPermission      = errors.New("unknown permission")
+	ErrAPIKeyNotFound         = errors.New("API key not found")
+	ErrInvalidAPIKeyScope     = errors.New("API key scope not granted to user")
+	ErrInvalidClient          = errors.New("invalid client credentials")
+	ErrInvalidScope           = errors.New("requested scope not granted to client")
+	ErrInsufficientScope      = errors.New("client credential lacks the required scope")
+	ErrServiceAccountRole     = errors.New("service accounts cannot hold privileged roles")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrClientNotFound         = errors.New("client credential not found")
+	ErrUnsupportedTokenType   = errors.New("token type cannot be revoked")
+	ErrInvalidLoginCode       = errors.New("invalid or expired sign-in code")
+	ErrUnknownOIDCProvider    = errors.New("unknown OIDC provider")
+	ErrInvalidOIDCState       = errors.New("invalid or expired OIDC state")
+	ErrIdentityNotLinked      = errors.New("identity is not linked to an account")
+	ErrIdentityEmailInUse     = errors.New("an account already uses the identity's email")
+	ErrIdentityAlreadyLinked  = errors.New("identity is already linked")
+	ErrIdentityNotFound       = errors.New("identity not found")
+	ErrLastLoginMethod        = errors.New("cannot remove the only way to sign in")
+	ErrPasskeyNotFound        = errors.New("passkey not found")
+	ErrPasskeyAlreadyExists   = errors.New("passkey is already registered")
+	ErrUserNotFound           = errors.New("user not found")
+	ErrImpersonationForbidden = errors.New("this user cannot be impersonated")
+	ErrNotImpersonating       = errors.New("request is not impersonating a user")
 )
 
 type Service struct {
@@ -31,23 +70,35 @@ type Service struct {
 	config     *config.Config
 	cache      AuthCache
 	cacheTTL   time.Duration
+	attempts   LoginAttemptStore
+	notifier   notification.Notifier
+	hasher     *PasswordHasher
+	policy     *PasswordPolicy
+	verifier   *AccessVerifier
+	oidc       map[string]*OIDCProvider
+	webauthn   *WebAuthnRelyingParty
+	challenges WebAuthnChallengeStore
+	activity   *SessionActivity
+	auditor    audit.Recorder
 }
 
-func NewService(repo *Repository, cfg *config.Config, cache AuthCache, cacheTTL time.Duration) *Service {
-	jwtService := NewJWTService(
-		cfg.Auth.JWTSecret,
-		cfg.Auth.JWTIssuer,
-		cfg.Auth.Audience[0],
-		cfg.Auth.AccessTokenLifetime,
-		cfg.Auth.RefreshTokenLifetime,
-	)
-
+func NewService(repo *Repository, jwtService *JWTService, cfg *config.Config, cache AuthCache, cacheTTL time.Duration, attempts LoginAttemptStore, challenges WebAuthnChallengeStore, activity *SessionActivity, notifier notification.Notifier, auditor audit.Recorder) *Service {
 	return &Service{
 		repo:       repo,
 		jwtService: jwtService,
 		config:     cfg,
 		cache:      cache,
 		cacheTTL:   cacheTTL,
+		attempts:   attempts,
+		notifier:   notifier,
+		hasher:     NewPasswordHasher(&cfg.Auth),
+		policy:     NewPasswordPolicy(&cfg.Auth),
+		verifier:   NewAccessVerifier(repo, cache, cacheTTL, activity),
+		oidc:       NewOIDCProviders(cfg.Auth.OIDCProviders),
+		webauthn:   NewWebAuthnRelyingParty(cfg.Auth.WebAuthnRPID, cfg.Auth.WebAuthnRPName, cfg.Auth.WebAuthnOrigins),
+		challenges: challenges,
+		activity:   activity,
+		auditor:    auditor,
 	}
 }
 
@@ -57,57 +108,149 @@ func NewService(repo *Repository, cfg *config.Config, cache AuthCache, cacheTTL
 
 // Login authenticates a user and creates a new session
 func (s *Service) Login(ctx context.Context, req *LoginRequest, r *http.Request) (*LoginResponse, string, string, error) {
+	accountKey := accountAttemptKey(req.Email)
+	ip := httpUtils.ClientIP(r)
+
+	// Refuse locked accounts and IPs before touching the password hash
+	if err := s.checkLoginAllowed(ctx, accountKey, ip); err != nil {
+		return nil, "", "", err
+	}
+
+	user, err := s.verifyCredentials(ctx, req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			s.registerLoginFailure(ctx, accountKey, ip)
+			s.recordLoginFailure(ctx, "", req.Email, "password", r)
+		}
+		return nil, "", "", err
+	}
+
+	// Checked only after the password matched so unverified addresses can't be probed
+	if s.config.Auth.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, "", "", ErrEmailNotVerified
+	}
+
+	return s.beginLogin(ctx, user, req.StaySignedIn, r)
+}
+
+// beginLogin runs once the first factor is verified, whatever it was.
+// Users with a confirmed second factor get a challenge instead of a session.
+func (s *Service) beginLogin(ctx context.Context, user *UserWithAuth, staySignedIn bool, r *http.Request) (*LoginResponse, string, string, error) {
+	mfaEnabled, err := s.isMFAEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if mfaEnabled {
+		mfaToken, err := s.jwtService.GenerateMFAChallengeToken(user.ID, staySignedIn, s.config.Auth.MFAChallengeLifetime)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to generate MFA challenge token: %w", err)
+		}
+		return &LoginResponse{MFARequired: true, MFAToken: mfaToken}, "", "", nil
+	}
+
+	return s.completeLogin(ctx, user, staySignedIn, r)
+}
+
+// verifyCredentials looks up the user and checks the password and account state
+func (s *Service) verifyCredentials(ctx context.Context, email, password string) (*UserWithAuth, error) {
 	// Get user by email
-	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		// Distinguish \"not found\" vs system failure.
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, "", "", ErrInvalidCredentials
+			return nil, ErrInvalidCredentials
 		}
-		return nil, "", "", fmt.Errorf("get user by email: %w", err)
+		return nil, fmt.Errorf("get user by email: %w", err)
+	}
+
+	// Service accounts only authenticate with client credentials
+	if user.IsServiceAccount {
+		return nil, ErrInvalidCredentials
 	}
 
 	// Check if user is active
 	if !user.IsActive {
 		// Never leak account state to callers; treat as invalid credentials.
-		return nil, "", "", ErrInvalidCredentials
+		return nil, ErrInvalidCredentials
 	}
 
 	// Check if user is blocked
 	if user.IsBlocked {
 		// Never leak account state to callers; treat as invalid credentials.
-		return nil, "", "", ErrInvalidCredentials
+		return nil, ErrInvalidCredentials
 	}
 
 	// Compare password
-	if err := ComparePassword(user.Password, req.Password); err != nil {
-		return nil, "", "", ErrInvalidCredentials
+	if err := ComparePassword(user.Password, password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// The plain password is only available here; upgrade outdated hashes while we have it
+	if s.hasher.NeedsRehash(user.Password) {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// rehashPassword stores the password under the current hashing policy (best-effort)
+func (s *Service) rehashPassword(ctx context.Context, user *UserWithAuth, password string) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		logger.Warn("failed to rehash password for user %s: %v", user.ID, err)
+		return
+	}
+
+	if err := s.repo.ReplacePasswordHash(ctx, user.ID, user.Password, hashedPassword); err != nil {
+		logger.Warn("failed to store rehashed password for user %s: %v", user.ID, err)
+		return
 	}
+	user.Password = hashedPassword
+
+	logger.Info("Password hash upgraded for user %s", user.ID)
+}
+
+// completeLogin creates the session once every required factor has been verified
+func (s *Service) completeLogin(ctx context.Context, user *UserWithAuth, staySignedIn bool, r *http.Request) (*LoginResponse, string, string, error) {
+	s.clearLoginFailures(ctx, accountAttemptKey(user.Email))
+
+	// Must run before the new session exists, otherwise every device looks known
+	s.notifyIfNewDevice(ctx, user, r)
 
 	// Determine refresh token lifetime based on "stay signed in" option
 	refreshLifetime := s.config.Auth.RefreshTokenLifetime
-	if req.StaySignedIn {
+	if staySignedIn {
 		refreshLifetime = s.config.Auth.StaySignedInLifetime
 	}
 
 	// Create session
-	_, accessToken, refreshToken, err := s.createSession(ctx, user, r, refreshLifetime)
+	session, accessToken, refreshToken, err := s.createSession(ctx, user, r, refreshLifetime)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("failed to create session: %w", err)
 	}
 
+	s.recordAudit(ctx, &audit.Event{
+		ActorID:    user.ID,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetSession,
+		TargetID:   session.ID,
+		IPAddress:  httpUtils.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+	})
+
 	// Build response
 	response := &LoginResponse{
 		User: &UserResponse{
-			ID:        user.ID,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
-			Email:     user.Email,
-			Role:      user.Role,
-			IsActive:  user.IsActive,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-			DeletedAt: user.DeletedAt,
+			ID:              user.ID,
+			FirstName:       user.FirstName,
+			LastName:        user.LastName,
+			Email:           user.Email,
+			Role:            user.Role,
+			IsActive:        user.IsActive,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+			DeletedAt:       user.DeletedAt,
 		},
 	}
 
@@ -122,8 +265,12 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*UserResp
 		return nil, ErrEmailAlreadyExists
 	}
 
+	if err := s.policy.Validate(req.Password, req.Email, nil); err != nil {
+		return nil, err
+	}
+
 	// Hash password
-	hashedPassword, err := HashPassword(req.Password)
+	hashedPassword, err := s.hasher.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -133,6 +280,7 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*UserResp
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	s.recordPasswordHistory(ctx, userID, hashedPassword)
 
 	// Get created user
 	user, err := s.repo.GetUserByID(ctx, userID)
@@ -140,6 +288,11 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*UserResp
 		return nil, fmt.Errorf("failed to get created user: %w", err)
 	}
 
+	// The account exists either way; a failed email can be retried via resend-verification
+	if err := s.sendEmailVerification(ctx, user); err != nil {
+		logger.Error("failed to send verification email to %s: %v", user.Email, err)
+	}
+
 	logger.Info("User registered successfully: %s", user.Email)
 
 	return &UserResponse{
@@ -155,7 +308,7 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*UserResp
 }
 
 // Refresh generates new access and refresh tokens
-func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, string, error) {
+func (s *Service) Refresh(ctx context.Context, refreshToken string, r *http.Request) (string, string, error) {
 	// Validate refresh token
 	claims, err := s.jwtService.ValidateRefreshToken(refreshToken)
 	if err != nil {
@@ -168,6 +321,10 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, str
 	// Get session
 	session, err := s.repo.GetSessionByRefreshTokenHash(ctx, tokenHash)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// A validly signed token that no session holds anymore may be a stolen, already rotated one
+			return "", "", s.handleRotatedRefreshToken(ctx, tokenHash, claims, r)
+		}
 		return "", "", ErrSessionNotFound
 	}
 
@@ -181,6 +338,13 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, str
 		return "", "", ErrSessionExpired
 	}
 
+	// An idle session cannot be revived by refreshing; rotation below records the activity otherwise
+	if s.activity.IsIdle(session.ID, session.LastActivityAt, time.Now()) {
+		_ = s.repo.InvalidateSession(ctx, session.ID)
+		s.cacheDelSession(ctx, session.ID)
+		return "", "", ErrSessionIdle
+	}
+
 	// Get user to verify they're still active
 	user, err := s.repo.GetUserByID(ctx, claims.UserID)
 	if err != nil {
@@ -194,7 +358,11 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, str
 	}
 
 	// Generate new tokens
-	newAccessToken, err := s.jwtService.GenerateAccessToken(user.ID, user.Email, user.Role, session.ID)
+	permissions, err := s.tokenPermissions(ctx, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	newAccessToken, err := s.jwtService.GenerateAccessToken(user.ID, user.Email, user.Role, session.ID, permissions)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -210,15 +378,84 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, str
 
 	// Update session with new refresh token hash (token rotation)
 	newTokenHash := HashToken(newRefreshToken)
-	if err := s.repo.UpdateSessionRefreshToken(ctx, session.ID, newTokenHash); err != nil {
+	rotated, err := s.repo.RotateSessionRefreshToken(ctx, session.ID, tokenHash, newTokenHash)
+	if err != nil {
 		return "", "", fmt.Errorf("failed to update session: %w", err)
 	}
+	if !rotated {
+		// A concurrent refresh with the same token won the race
+		return "", "", ErrSessionNotFound
+	}
 
 	logger.Info("Tokens refreshed for user %s (session: %s)", user.Email, session.ID)
 
 	return newAccessToken, newRefreshToken, nil
 }
 
+// handleRotatedRefreshToken decides what a replayed refresh token means.
+// Concurrent refreshes from the same client within the grace window are benign; anything else
+// is treated as token theft and revokes the whole session.
+func (s *Service) handleRotatedRefreshToken(ctx context.Context, tokenHash string, claims *RefreshTokenClaims, r *http.Request) error {
+	sessionID, withinGrace, err := s.repo.GetRotatedRefreshToken(ctx, tokenHash, s.config.Auth.RefreshReuseGracePeriod)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("failed to check rotated refresh token: %w", err)
+	}
+
+	session, err := s.repo.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	ipAddress := httpUtils.ClientIP(r)
+	userAgent := r.UserAgent()
+
+	// Compare hosts only: sessions stored before addresses were normalized may still carry a port
+	sameHost := httpUtils.StripPort(session.IPAddress) == httpUtils.StripPort(ipAddress)
+	if withinGrace && sameHost && session.UserAgent == userAgent {
+		logger.Warn("Concurrent refresh within grace window for session %s", sessionID)
+		return ErrSessionNotFound
+	}
+
+	if err := s.repo.InvalidateSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session after refresh token reuse: %w", err)
+	}
+	s.cacheDelSession(ctx, sessionID)
+
+	event := &SecurityEvent{
+		UserID:    session.UserID,
+		SessionID: sessionID,
+		EventType: SecurityEventRefreshTokenReuse,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Details: map[string]interface{}{
+			"token_issued_at":    claims.IssuedAt,
+			"session_ip_address": session.IPAddress,
+			"session_user_agent": session.UserAgent,
+			"within_grace":       withinGrace,
+		},
+	}
+	if err := s.repo.CreateSecurityEvent(ctx, event); err != nil {
+		// Revocation already happened; losing the event must not hide the rejection.
+		logger.Error("failed to record security event: %v", err)
+	}
+
+	s.recordAudit(ctx, &audit.Event{
+		Action:     audit.ActionSessionRevoked,
+		TargetType: audit.TargetSession,
+		TargetID:   sessionID,
+		Metadata:   map[string]any{"reason": "refresh_token_reuse", "user_id": session.UserID},
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+	})
+
+	logger.Warn("Refresh token reuse detected for user %s, session %s revoked", session.UserID, sessionID)
+
+	return ErrRefreshTokenReused
+}
+
 // Logout invalidates the current session
 func (s *Service) Logout(ctx context.Context, sessionID string) error {
 	if err := s.repo.InvalidateSession(ctx, sessionID); err != nil {
@@ -226,6 +463,13 @@ func (s *Service) Logout(ctx context.Context, sessionID string) error {
 	}
 	s.cacheDelSession(ctx, sessionID)
 
+	s.recordAudit(ctx, &audit.Event{
+		Action:     audit.ActionSessionRevoked,
+		TargetType: audit.TargetSession,
+		TargetID:   sessionID,
+		Metadata:   map[string]any{"reason": "logout"},
+	})
+
 	logger.Info("Session %s logged out", sessionID)
 	return nil
 }
@@ -245,212 +489,2046 @@ func (s *Service) LogoutAll(ctx context.Context, userID string) error {
 	}
 	s.cacheDelUser(ctx, userID)
 
+	s.recordAudit(ctx, &audit.Event{
+		Action:     audit.ActionSessionsRevokedAll,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
 	logger.Info("All sessions logged out for user %s", userID)
 	return nil
 }
 
+// LogoutAllUserSessions invalidates all sessions of another user on behalf of an admin
+func (s *Service) LogoutAllUserSessions(ctx context.Context, userID, loggedOutBy string) error {
+	if err := s.authorizeUserAction(ctx, loggedOutBy, userID, UserActionLogoutSessions, ""); err != nil {
+		return err
+	}
+
+	return s.LogoutAll(ctx, userID)
+}
+
 // -------------------------
-// Password Management
+// Multi-Factor Authentication
 // -------------------------
 
-// RequestPasswordReset generates an OTP for password reset
-func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
-	// Get user by email
-	user, err := s.repo.GetUserByEmail(ctx, email)
+// VerifyMFALogin completes a login that was answered with an MFA challenge
+func (s *Service) VerifyMFALogin(ctx context.Context, req *MFAVerifyRequest, r *http.Request) (*LoginResponse, string, string, error) {
+	claims, err := s.jwtService.ValidateMFAChallengeToken(req.MFAToken)
 	if err != nil {
-		// Don't reveal if email exists or not
-		return nil
+		return nil, "", "", err
 	}
 
-	// Generate OTP
-	otp, err := GenerateOTP()
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
 	if err != nil {
-		return fmt.Errorf("failed to generate OTP: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", "", ErrInvalidCredentials
+		}
+		return nil, "", "", fmt.Errorf("get user by id: %w", err)
 	}
 
-	// Generate secure token
-	token, err := GenerateSecureToken()
+	// Account state may have changed since the password step
+	if !user.IsActive || user.IsBlocked {
+		return nil, "", "", ErrInvalidCredentials
+	}
+
+	// Second factor guesses count towards the same lockout as passwords
+	accountKey := accountAttemptKey(user.Email)
+	ip := httpUtils.ClientIP(r)
+	if err := s.checkLoginAllowed(ctx, accountKey, ip); err != nil {
+		return nil, "", "", err
+	}
+
+	switch {
+	case req.Passkey != nil:
+		err = s.verifyMFAPasskey(ctx, user.ID, req.Passkey)
+	case req.RecoveryCode != "":
+		err = s.useRecoveryCode(ctx, user.ID, req.RecoveryCode)
+	default:
+		err = s.verifyTOTP(ctx, user.ID, req.Code)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to generate token: %w", err)
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.registerLoginFailure(ctx, accountKey, ip)
+			s.recordLoginFailure(ctx, user.ID, user.Email, "mfa", r)
+		}
+		return nil, "", "", err
+	}
+	if req.RecoveryCode != "" {
+		logger.Warn("MFA recovery code used for user %s", user.Email)
 	}
 
-	// Hash token
-	tokenHash := HashToken(token)
+	return s.completeLogin(ctx, user, claims.StaySignedIn, r)
+}
 
-	// Create password reset token
-	resetToken := &PasswordResetToken{
-		UserID:    user.ID,
-		TokenHash: tokenHash,
-		OTP:       otp,
-		ExpiresAt: time.Now().Add(s.config.Auth.PasswordResetOTPLifetime),
-		CreatedAt: time.Now(),
+// EnrollMFA starts TOTP enrollment by generating a new secret for the user.
+// The enrollment stays pending until confirmed with a valid code.
+func (s *Service) EnrollMFA(ctx context.Context, userID string) (*MFAEnrollResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if err := s.repo.CreatePasswordResetToken(ctx, resetToken); err != nil {
-		return fmt.Errorf("failed to create password reset token: %w", err)
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
 	}
 
-	// Log OTP to console (in production, send via email)
-	logger.Info("===========================================")
-	logger.Info("Password reset OTP for %s: %s", email, otp)
-	logger.Info("OTP expires in %v", s.config.Auth.PasswordResetOTPLifetime)
-	logger.Info("===========================================")
+	stored, err := s.repo.UpsertPendingUserMFA(ctx, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store MFA secret: %w", err)
+	}
+	if !stored {
+		return nil, ErrMFAAlreadyEnabled
+	}
 
-	return nil
+	return &MFAEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(s.config.Auth.MFAIssuer, user.Email, secret),
+	}, nil
 }
 
-// VerifyPasswordReset verifies OTP and resets password
-func (s *Service) VerifyPasswordReset(ctx context.Context, req *PasswordResetVerifyRequest) error {
-	// Get password reset token
-	token, err := s.repo.GetPasswordResetToken(ctx, req.Email, req.OTP)
+// ConfirmMFA enables a pending enrollment and returns a fresh set of recovery codes
+func (s *Service) ConfirmMFA(ctx context.Context, userID, code string) (*MFARecoveryCodesResponse, error) {
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
 	if err != nil {
-		return ErrInvalidOTP
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, fmt.Errorf("failed to get MFA enrollment: %w", err)
 	}
-	sessionIDs, err := s.repo.GetActiveSessionIDsByUserID(ctx, token.UserID)
-	if err != nil {
-		logger.Warn("failed to get active session ids for cache invalidation: %v", err)
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
 	}
 
-	// Hash new password
-	hashedPassword, err := HashPassword(req.NewPassword)
-	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+	step, ok := ValidateTOTP(mfa.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
 	}
 
-	// Update user password
-	if err := s.repo.UpdateUserPassword(ctx, token.UserID, hashedPassword); err != nil {
-		return fmt.Errorf("failed to update password: %w", err)
+	enabled, err := s.repo.EnableUserMFA(ctx, userID, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+	if !enabled {
+		// A concurrent confirmation won; it issued the recovery codes
+		return nil, ErrMFAAlreadyEnabled
 	}
 
-	// Mark token as used
-	if err := s.repo.MarkPasswordResetTokenAsUsed(ctx, token.ID); err != nil {
-		return fmt.Errorf("failed to mark token as used: %w", err)
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Invalidate all sessions for security
-	if err := s.repo.InvalidateAllUserSessions(ctx, token.UserID); err != nil {
-		// Best-effort cleanup; still worth surfacing upstream for centralized logging.
-		return fmt.Errorf("failed to invalidate sessions after password reset: %w", err)
+	logger.Info("MFA enabled for user %s", userID)
+
+	return &MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// RegenerateRecoveryCodes invalidates all existing recovery codes and issues new ones
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID, code string) (*MFARecoveryCodesResponse, error) {
+	if err := s.verifyTOTP(ctx, userID, code); err != nil {
+		return nil, err
 	}
-	for _, sid := range sessionIDs {
-		s.cacheDelSession(ctx, sid)
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-	s.cacheDelUser(ctx, token.UserID)
 
-	logger.Info("Password reset successfully for user %s", req.Email)
+	logger.Info("MFA recovery codes regenerated for user %s", userID)
 
-	return nil
+	return &MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
 }
 
-// ChangePassword changes a user's password (requires current password)
-func (s *Service) ChangePassword(ctx context.Context, userID string, req *ChangePasswordRequest) error {
-	// Get user
+// DisableMFA removes the user's second factor (requires password and a current code)
+func (s *Service) DisableMFA(ctx context.Context, userID string, req *MFADisableRequest) error {
 	user, err := s.repo.GetUserByID(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// Verify current password
-	if err := ComparePassword(user.Password, req.CurrentPassword); err != nil {
+	if err := ComparePassword(user.Password, req.Password); err != nil {
 		return ErrInvalidCredentials
 	}
 
-	// Hash new password
-	hashedPassword, err := HashPassword(req.NewPassword)
-	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
+	if err := s.verifyTOTP(ctx, userID, req.Code); err != nil {
+		return err
 	}
 
-	// Update password
-	if err := s.repo.UpdateUserPassword(ctx, userID, hashedPassword); err != nil {
-		return fmt.Errorf("failed to update password: %w", err)
+	if err := s.repo.DeleteUserMFA(ctx, userID); err != nil {
+		return fmt.Errorf("failed to disable MFA: %w", err)
 	}
 
-	logger.Info("Password changed for user %s", user.Email)
+	logger.Info("MFA disabled for user %s", user.Email)
 
 	return nil
 }
 
-// -------------------------
-// User Management
-// -------------------------
+// ResetMFA removes a user's second factor on behalf of an administrator (e.g. lost device)
+func (s *Service) ResetMFA(ctx context.Context, userID, resetBy string) error {
+	if err := s.authorizeUserAction(ctx, resetBy, userID, UserActionResetMFA, ""); err != nil {
+		return err
+	}
 
-// GetMe returns the current user's information
-func (s *Service) GetMe(ctx context.Context, userID string) (*UserResponse, error) {
-	user, err := s.repo.GetUserByID(ctx, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+	if err := s.repo.DeleteUserMFA(ctx, userID); err != nil {
+		return fmt.Errorf("failed to reset MFA: %w", err)
 	}
 
-	return &UserResponse{
-		ID:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Email:     user.Email,
-		Role:      user.Role,
-		IsActive:  user.IsActive,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		DeletedAt: user.DeletedAt,
-	}, nil
+	logger.Info("MFA for user %s reset by %s", userID, resetBy)
+
+	return nil
 }
 
-// BlockUser blocks a user and invalidates all their sessions
-func (s *Service) BlockUser(ctx context.Context, userID, blockedBy string) error {
-	sessionIDs, err := s.repo.GetActiveSessionIDsByUserID(ctx, userID)
+// isMFAEnabled reports whether the user has a confirmed second factor
+func (s *Service) isMFAEnabled(ctx context.Context, userID string) (bool, error) {
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
 	if err != nil {
-		logger.Warn("failed to get active session ids for cache invalidation: %v", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get user mfa: %w", err)
 	}
-	// Block user
-	if err := s.repo.BlockUser(ctx, userID, blockedBy); err != nil {
-		return fmt.Errorf("failed to block user: %w", err)
+	return mfa.EnabledAt != nil, nil
+}
+
+// verifyTOTP validates a code against the user's confirmed enrollment and consumes its time step
+func (s *Service) verifyTOTP(ctx context.Context, userID, code string) error {
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMFANotEnrolled
+		}
+		return fmt.Errorf("failed to get MFA enrollment: %w", err)
+	}
+	if mfa.EnabledAt == nil {
+		return ErrMFANotEnrolled
 	}
 
-	// Invalidate all sessions
-	if err := s.repo.InvalidateAllUserSessions(ctx, userID); err != nil {
-		return fmt.Errorf("failed to invalidate sessions: %w", err)
+	step, ok := ValidateTOTP(mfa.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
 	}
-	for _, sid := range sessionIDs {
-		s.cacheDelSession(ctx, sid)
+
+	// Each code is single-use, even within its validity window
+	consumed, err := s.repo.ConsumeTOTPStep(ctx, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to consume TOTP step: %w", err)
+	}
+	if !consumed {
+		return ErrInvalidMFACode
 	}
-	s.cacheDelUser(ctx, userID)
 
-	logger.Info("User %s blocked by %s", userID, blockedBy)
+	return nil
+}
 
+// useRecoveryCode consumes a single-use recovery code
+func (s *Service) useRecoveryCode(ctx context.Context, userID, code string) error {
+	used, err := s.repo.UseRecoveryCode(ctx, userID, HashToken(NormalizeRecoveryCode(code)))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
 	return nil
 }
 
-// UnblockUser unblocks a user
-func (s *Service) UnblockUser(ctx context.Context, userID string) error {
-	if err := s.repo.UnblockUser(ctx, userID); err != nil {
-		return fmt.Errorf("failed to unblock user: %w", err)
+// replaceRecoveryCodes generates new recovery codes and stores only their hashes
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
 	}
-	s.cacheDelUser(ctx, userID)
 
-	logger.Info("User %s unblocked", userID)
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, HashToken(NormalizeRecoveryCode(code)))
+	}
 
-	return nil
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// JWKS returns the public keys that verify tokens issued by this service
+func (s *Service) JWKS() *JWKSet {
+	return s.jwtService.JWKS()
 }
 
 // -------------------------
-// Session Management
+// Email Verification
 // -------------------------
 
-// GetUserSessions returns all active sessions for a user
-func (s *Service) GetUserSessions(ctx context.Context, userID, currentSessionID string) ([]*SessionResponse, error) {
-	sessions, err := s.repo.GetUserSessions(ctx, userID)
+// VerifyEmail consumes a verification token and marks the user's address as verified
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.repo.VerifyEmail(ctx, HashToken(token))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user sessions: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidVerifyToken
+		}
+		return err
 	}
+	s.cacheDelUser(ctx, userID)
 
-	var response []*SessionResponse
-	for _, session := range sessions {
-		response = append(response, &SessionResponse{
+	logger.Info("Email verified for user %s", userID)
+
+	return nil
+}
+
+// ResendVerification sends a fresh verification email.
+// Unknown and already verified addresses are silently ignored so callers learn nothing.
+func (s *Service) ResendVerification(ctx context.Context, email string) error {
+	verifyKey := emailVerificationAttemptKey(email)
+	if attempts := s.getAttempts(ctx, verifyKey); attempts.Locked {
+		logger.Warn("Verification emails for %s are temporarily locked", email)
+		return nil
+	}
+	s.registerFailure(ctx, verifyKey, s.config.Auth.LoginMaxFailures)
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendEmailVerification(ctx, user)
+}
+
+// RequestEmailVerification sends a verification email to the user's current address if it
+// is not verified yet. Used by the user module after an email change.
+func (s *Service) RequestEmailVerification(ctx context.Context, userID string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	s.cacheDelUser(ctx, userID)
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendEmailVerification(ctx, user)
+}
+
+// sendEmailVerification issues a new token for the user's current address and emails it
+func (s *Service) sendEmailVerification(ctx context.Context, user *UserWithAuth) error {
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	lifetime := s.config.Auth.EmailVerificationLifetime
+	if err := s.repo.ReplaceEmailVerificationToken(ctx, user.ID, user.Email, HashToken(token), lifetime); err != nil {
+		return err
+	}
+
+	s.notify(ctx, notification.TemplateEmailVerification, user.Email, notification.EmailVerificationData{
+		Name:      user.FirstName,
+		Token:     token,
+		Link:      s.emailVerificationLink(token),
+		ExpiresIn: lifetime.String(),
+	})
+
+	return nil
+}
+
+// emailVerificationLink appends the token to EMAIL_VERIFICATION_URL, if configured
+func (s *Service) emailVerificationLink(token string) string {
+	return tokenLink(s.config.Auth.EmailVerificationURL, token)
+}
+
+// tokenLink appends ?token= to a frontend URL; empty when no URL is configured
+func tokenLink(base, token string) string {
+	if base == "" {
+		return ""
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		logger.Warn("invalid link URL %q: %v", base, err)
+		return ""
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// -------------------------
+// Passwordless Login
+// -------------------------
+
+// StartPasswordlessLogin emails a single-use sign-in code and, if configured, a magic link.
+// Like password reset, it never reveals whether the address has an account.
+func (s *Service) StartPasswordlessLogin(ctx context.Context, email string) error {
+	// Limit emails per address; silently drop extra ones so callers learn nothing
+	key := passwordlessSendKey(email)
+	if attempts := s.getAttempts(ctx, key); attempts.Locked {
+		logger.Warn("Passwordless sign-in for %s is temporarily locked", email)
+		return nil
+	}
+	s.registerFailure(ctx, key, s.config.Auth.LoginMaxFailures)
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil || user.IsServiceAccount || !user.IsActive || user.IsBlocked {
+		return nil
+	}
+
+	otp, err := GenerateOTP()
+	if err != nil {
+		return fmt.Errorf("failed to generate OTP: %w", err)
+	}
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	lifetime := s.config.Auth.PasswordlessLoginLifetime
+	if err := s.repo.ReplaceLoginToken(ctx, user.ID, user.Email, HashToken(token), otp, lifetime); err != nil {
+		return err
+	}
+
+	s.notify(ctx, notification.TemplatePasswordlessLogin, user.Email, notification.PasswordlessLoginData{
+		Name:      user.FirstName,
+		OTP:       otp,
+		Link:      tokenLink(s.config.Auth.PasswordlessLoginURL, token),
+		ExpiresIn: lifetime.String(),
+	})
+	logger.Info("Passwordless sign-in code sent to %s", email)
+
+	return nil
+}
+
+// VerifyPasswordlessLogin signs the user in with an emailed code or magic link token.
+// Second factors still apply; the email only replaces the password.
+func (s *Service) VerifyPasswordlessLogin(ctx context.Context, req *PasswordlessVerifyRequest, r *http.Request) (*LoginResponse, string, string, error) {
+	maxAttempts := s.config.Auth.PasswordlessMaxAttempts
+
+	var userID string
+	if req.Token != "" {
+		id, err := s.repo.ConsumeLoginTokenByHash(ctx, HashToken(req.Token), maxAttempts)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, "", "", ErrInvalidLoginCode
+			}
+			return nil, "", "", err
+		}
+		userID = id
+	} else {
+		// A 6-digit code is only safe with a small number of guesses
+		key := passwordlessAttemptKey(req.Email)
+		if attempts := s.getAttempts(ctx, key); attempts.Locked {
+			return nil, "", "", ErrInvalidLoginCode
+		}
+
+		id, matched, err := s.repo.ConsumeLoginTokenByOTP(ctx, req.Email, req.Code, maxAttempts)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", "", err
+		}
+		if err != nil || !matched {
+			s.registerFailure(ctx, key, s.config.Auth.LoginMaxFailures)
+			return nil, "", "", ErrInvalidLoginCode
+		}
+		userID = id
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get user: %w", err)
+	}
+	// Never leak account state to callers; treat as invalid credentials.
+	if user.IsServiceAccount || !user.IsActive || user.IsBlocked {
+		return nil, "", "", ErrInvalidCredentials
+	}
+
+	// The token was pinned to the current address, so the user just proved they own it
+	if user.EmailVerifiedAt == nil {
+		if err := s.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, "", "", err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	s.clearLoginFailures(ctx, passwordlessAttemptKey(user.Email))
+	s.clearLoginFailures(ctx, accountAttemptKey(user.Email))
+
+	return s.beginLogin(ctx, user, req.StaySignedIn, r)
+}
+
+// -------------------------
+// Password Management
+// -------------------------
+
+// RequestPasswordReset generates an OTP for password reset
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	// Limit reset requests per address; silently drop extra ones so callers learn nothing
+	sendKey := passwordResetSendKey(email)
+	if attempts := s.getAttempts(ctx, sendKey); attempts.Locked {
+		logger.Warn("Password reset requests for %s are temporarily locked", email)
+		return nil
+	}
+	s.registerFailure(ctx, sendKey, s.config.Auth.LoginMaxFailures)
+
+	// Get user by email
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil || user.IsServiceAccount {
+		// Don't reveal if email exists or not
+		return nil
+	}
+
+	// Generate OTP
+	otp, err := GenerateOTP()
+	if err != nil {
+		return fmt.Errorf("failed to generate OTP: %w", err)
+	}
+
+	// Generate secure token
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	// Hash token
+	tokenHash := HashToken(token)
+
+	// Create password reset token
+	resetToken := &PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		OTP:       otp,
+		ExpiresAt: time.Now().Add(s.config.Auth.PasswordResetOTPLifetime),
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.repo.CreatePasswordResetToken(ctx, resetToken); err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	s.notify(ctx, notification.TemplatePasswordReset, user.Email, notification.PasswordResetData{
+		Name:      user.FirstName,
+		OTP:       otp,
+		ExpiresIn: s.config.Auth.PasswordResetOTPLifetime.String(),
+	})
+	logger.Info("Password reset OTP sent to %s", email)
+
+	return nil
+}
+
+// VerifyPasswordReset verifies OTP and resets password
+func (s *Service) VerifyPasswordReset(ctx context.Context, req *PasswordResetVerifyRequest) error {
+	// A 6-digit OTP is only safe with a small number of guesses
+	resetKey := passwordResetAttemptKey(req.Email)
+	if attempts := s.getAttempts(ctx, resetKey); attempts.Locked {
+		return ErrInvalidOTP
+	}
+
+	// Get password reset token
+	token, err := s.repo.GetPasswordResetToken(ctx, req.Email, req.OTP)
+	if err != nil {
+		s.registerFailure(ctx, resetKey, s.config.Auth.LoginMaxFailures)
+		return ErrInvalidOTP
+	}
+
+	// The OTP stays valid on policy failures so the user can retry with a better password
+	user, err := s.repo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := s.validateNewPassword(ctx, user, req.NewPassword); err != nil {
+		return err
+	}
+
+	sessionIDs, err := s.repo.GetActiveSessionIDsByUserID(ctx, token.UserID)
+	if err != nil {
+		logger.Warn("failed to get active session ids for cache invalidation: %v", err)
+	}
+
+	// Hash new password
+	hashedPassword, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Update user password
+	if err := s.repo.UpdateUserPassword(ctx, token.UserID, hashedPassword, token.UserID); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	s.recordPasswordHistory(ctx, token.UserID, hashedPassword)
+
+	// Mark token as used
+	if err := s.repo.MarkPasswordResetTokenAsUsed(ctx, token.ID); err != nil {
+		return fmt.Errorf("failed to mark token as used: %w", err)
+	}
+
+	// Invalidate all sessions for security
+	if err := s.repo.InvalidateAllUserSessions(ctx, token.UserID); err != nil {
+		// Best-effort cleanup; still worth surfacing upstream for centralized logging.
+		return fmt.Errorf("failed to invalidate sessions after password reset: %w", err)
+	}
+	for _, sid := range sessionIDs {
+		s.cacheDelSession(ctx, sid)
+	}
+	s.cacheDelUser(ctx, token.UserID)
+	s.clearLoginFailures(ctx, resetKey)
+	s.clearLoginFailures(ctx, accountAttemptKey(req.Email))
+
+	s.notify(ctx, notification.TemplatePasswordChanged, user.Email, notification.PasswordChangedData{
+		Name: user.FirstName,
+		Time: formatNotificationTime(time.Now()),
+	})
+
+	s.recordUserAction(ctx, audit.ActionPasswordReset, token.UserID, token.UserID)
+
+	logger.Info("Password reset successfully for user %s", req.Email)
+
+	return nil
+}
+
+// ChangePassword changes a user's password (requires current password)
+func (s *Service) ChangePassword(ctx context.Context, userID string, req *ChangePasswordRequest) error {
+	// Get user
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Verify current password
+	if err := ComparePassword(user.Password, req.CurrentPassword); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.validateNewPassword(ctx, user, req.NewPassword); err != nil {
+		return err
+	}
+
+	// Hash new password
+	hashedPassword, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Update password
+	if err := s.repo.UpdateUserPassword(ctx, userID, hashedPassword, userID); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	s.recordPasswordHistory(ctx, userID, hashedPassword)
+
+	s.notify(ctx, notification.TemplatePasswordChanged, user.Email, notification.PasswordChangedData{
+		Name: user.FirstName,
+		Time: formatNotificationTime(time.Now()),
+	})
+
+	s.recordUserAction(ctx, audit.ActionPasswordChanged, userID, userID)
+
+	logger.Info("Password changed for user %s", user.Email)
+
+	return nil
+}
+
+// validateNewPassword applies the password policy, including the user's password history
+func (s *Service) validateNewPassword(ctx context.Context, user *UserWithAuth, password string) error {
+	previous := []string{user.Password}
+	if size := s.config.Auth.PasswordHistorySize; size > 0 {
+		history, err := s.repo.GetPasswordHistory(ctx, user.ID, size)
+		if err != nil {
+			return err
+		}
+		previous = append(previous, history...)
+	}
+
+	return s.policy.Validate(password, user.Email, previous)
+}
+
+// recordPasswordHistory remembers a newly set password hash (best-effort)
+func (s *Service) recordPasswordHistory(ctx context.Context, userID, hashedPassword string) {
+	size := s.config.Auth.PasswordHistorySize
+	if size <= 0 {
+		return
+	}
+	if err := s.repo.AddPasswordHistory(ctx, userID, hashedPassword, size); err != nil {
+		logger.Warn("failed to record password history for user %s: %v", userID, err)
+	}
+}
+
+// -------------------------
+// API Keys
+// -------------------------
+
+// CreateAPIKey issues a new API key. Keys can only be scoped to permissions the user holds.
+func (s *Service) CreateAPIKey(ctx context.Context, userID string, req *CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
+	permissions, err := s.repo.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		held[p] = true
+	}
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !held[scope] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAPIKeyScope, scope)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	plainKey, prefix, err := GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		KeyHash: HashToken(plainKey),
+		Scopes:  scopes,
+	}
+	if err := s.repo.CreateAPIKey(ctx, key, req.ExpiresInDays); err != nil {
+		return nil, err
+	}
+
+	logger.Info("API key %s created for user %s", key.ID, userID)
+
+	return &CreateAPIKeyResponse{
+		APIKeyResponse: *toAPIKeyResponse(key),
+		Key:            plainKey,
+	}, nil
+}
+
+// ListAPIKeys returns the user's active and expired API keys
+func (s *Service) ListAPIKeys(ctx context.Context, userID string) ([]*APIKeyResponse, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, toAPIKeyResponse(key))
+	}
+	return response, nil
+}
+
+// RenameAPIKey changes the label of one of the user's API keys
+func (s *Service) RenameAPIKey(ctx context.Context, userID, keyID, name string) error {
+	if err := s.repo.RenameAPIKey(ctx, userID, keyID, name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeAPIKey permanently disables one of the user's API keys
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, keyID string) error {
+	if err := s.repo.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+
+	logger.Info("API key %s revoked by user %s", keyID, userID)
+	return nil
+}
+
+func toAPIKeyResponse(key *APIKey) *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// -------------------------
+// Service Accounts
+// -------------------------
+
+// IssueClientToken implements the OAuth2 client credentials grant for service accounts.
+// scope is the space-delimited request parameter; empty grants every scope of the credential.
+func (s *Service) IssueClientToken(ctx context.Context, clientID, clientSecret, scope string) (*TokenResponse, error) {
+	credential, account, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := credential.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		granted := make(map[string]bool, len(credential.Scopes))
+		for _, sc := range credential.Scopes {
+			granted[sc] = true
+		}
+		for _, sc := range requested {
+			if !granted[sc] {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidScope, sc)
+			}
+		}
+		scopes = requested
+	}
+
+	lifetime := s.config.Auth.ClientTokenLifetime
+	accessToken, err := s.jwtService.GenerateClientAccessToken(account.ID, account.Role, credential.ClientID, scopes, lifetime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	if err := s.repo.TouchClientCredential(ctx, credential.ID); err != nil {
+		logger.Warn("failed to record client credential use: %v", err)
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(lifetime.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// authenticateClient verifies client credentials and that their service account may still use them
+func (s *Service) authenticateClient(ctx context.Context, clientID, clientSecret string) (*ClientCredential, *UserWithAuth, error) {
+	credential, err := s.repo.GetActiveClientCredential(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrInvalidClient
+		}
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(HashToken(clientSecret)), []byte(credential.SecretHash)) != 1 {
+		return nil, nil, ErrInvalidClient
+	}
+
+	account, err := s.repo.GetUserByID(ctx, credential.UserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrInvalidClient
+		}
+		return nil, nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+	if !account.IsServiceAccount || !account.IsActive || account.IsBlocked {
+		return nil, nil, ErrInvalidClient
+	}
+
+	return credential, account, nil
+}
+
+// authorizeClient authenticates a client and requires the permission both among the
+// credential's scopes and still granted to its service account
+func (s *Service) authorizeClient(ctx context.Context, clientID, clientSecret, permission string) (*UserWithAuth, error) {
+	credential, account, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.repo.GetUserPermissions(ctx, account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client permissions: %w", err)
+	}
+	for _, p := range ScopedPermissions(permissions, credential.Scopes) {
+		if p == permission {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrInsufficientScope, permission)
+}
+
+// CreateServiceAccount creates a non-human principal. Privileged roles are refused so
+// automation can never outrank the people managing it.
+func (s *Service) CreateServiceAccount(ctx context.Context, req *CreateServiceAccountRequest, createdBy string) (*ServiceAccountResponse, error) {
+	roleName := req.Role
+	if roleName == "" {
+		roleName = defaultServiceAccountRole
+	}
+	if roleRank(roleName) > 0 {
+		return nil, ErrServiceAccountRole
+	}
+
+	role, err := s.repo.GetRoleByName(ctx, roleName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	email, err := serviceAccountEmail()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate service account email: %w", err)
+	}
+
+	accountID, err := s.repo.CreateServiceAccount(ctx, req.Name, email, role.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.repo.GetServiceAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Service account %s created by %s", accountID, createdBy)
+	return toServiceAccountResponse(account), nil
+}
+
+// ListServiceAccounts returns every service account
+func (s *Service) ListServiceAccounts(ctx context.Context) ([]*ServiceAccountResponse, error) {
+	accounts, err := s.repo.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*ServiceAccountResponse, 0, len(accounts))
+	for _, a := range accounts {
+		response = append(response, toServiceAccountResponse(a))
+	}
+	return response, nil
+}
+
+// CreateClientCredential issues a client ID and secret for a service account.
+// Scopes are limited to the permissions of the account's role.
+func (s *Service) CreateClientCredential(ctx context.Context, accountID string, req *CreateClientCredentialRequest) (*CreateClientCredentialResponse, error) {
+	if err := s.checkServiceAccountScopes(ctx, accountID, req.Scopes); err != nil {
+		return nil, err
+	}
+
+	clientID, clientSecret, err := GenerateClientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := req.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	credential := &ClientCredential{
+		UserID:     accountID,
+		ClientID:   clientID,
+		Name:       req.Name,
+		SecretHash: HashToken(clientSecret),
+		Scopes:     scopes,
+	}
+	if err := s.repo.CreateClientCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Client credential %s created for service account %s", clientID, accountID)
+
+	return &CreateClientCredentialResponse{
+		ClientCredentialResponse: *toClientCredentialResponse(credential),
+		ClientSecret:             clientSecret,
+	}, nil
+}
+
+// ListClientCredentials returns the active credentials of a service account
+func (s *Service) ListClientCredentials(ctx context.Context, accountID string) ([]*ClientCredentialResponse, error) {
+	if _, err := s.getServiceAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.repo.ListClientCredentials(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*ClientCredentialResponse, 0, len(credentials))
+	for _, c := range credentials {
+		response = append(response, toClientCredentialResponse(c))
+	}
+	return response, nil
+}
+
+// UpdateClientCredentialScopes replaces the scopes of a credential.
+// Tokens already issued keep their scopes until they expire.
+func (s *Service) UpdateClientCredentialScopes(ctx context.Context, accountID, clientID string, scopes []string) error {
+	if err := s.checkServiceAccountScopes(ctx, accountID, scopes); err != nil {
+		return err
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	if err := s.repo.UpdateClientCredentialScopes(ctx, accountID, clientID, scopes); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrClientNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RevokeClientCredential disables a credential; it can no longer obtain tokens
+func (s *Service) RevokeClientCredential(ctx context.Context, accountID, clientID string) error {
+	if err := s.repo.RevokeClientCredential(ctx, accountID, clientID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrClientNotFound
+		}
+		return err
+	}
+
+	logger.Info("Client credential %s of service account %s revoked", clientID, accountID)
+	return nil
+}
+
+func (s *Service) getServiceAccount(ctx context.Context, accountID string) (*ServiceAccount, error) {
+	account, err := s.repo.GetServiceAccount(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrServiceAccountNotFound
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *Service) checkServiceAccountScopes(ctx context.Context, accountID string, scopes []string) error {
+	if _, err := s.getServiceAccount(ctx, accountID); err != nil {
+		return err
+	}
+
+	permissions, err := s.repo.GetUserPermissions(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	held := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		held[p] = true
+	}
+	for _, scope := range scopes {
+		if !held[scope] {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
+
+func toServiceAccountResponse(a *ServiceAccount) *ServiceAccountResponse {
+	return &ServiceAccountResponse{
+		ID:        a.ID,
+		Name:      a.Name,
+		Role:      a.Role,
+		IsBlocked: a.IsBlocked,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+func toClientCredentialResponse(c *ClientCredential) *ClientCredentialResponse {
+	return &ClientCredentialResponse{
+		ClientID:   c.ClientID,
+		Name:       c.Name,
+		Scopes:     c.Scopes,
+		LastUsedAt: c.LastUsedAt,
+		CreatedAt:  c.CreatedAt,
+	}
+}
+
+// -------------------------
+// Token Introspection & Revocation
+// -------------------------
+
+// IntrospectToken tells a service account whether an access or refresh token is still usable
+// (RFC 7662). It applies the same session and user checks as AuthMiddleware; any refusal
+// yields an inactive response, only infrastructure failures are returned as errors.
+func (s *Service) IntrospectToken(ctx context.Context, clientID, clientSecret, token string) (*IntrospectionResponse, error) {
+	if _, err := s.authorizeClient(ctx, clientID, clientSecret, PermissionTokensIntrospect); err != nil {
+		return nil, err
+	}
+
+	response, err := s.introspectAccessToken(ctx, token)
+	if err == nil || !errors.Is(err, ErrInvalidToken) {
+		return inactiveOnRevocation(response, err)
+	}
+
+	// Not an access token; it may still be a refresh token
+	return inactiveOnRevocation(s.introspectRefreshToken(ctx, token))
+}
+
+func (s *Service) introspectAccessToken(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	claims, err := s.jwtService.ValidateAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.verifier.VerifyAccessToken(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &IntrospectionResponse{
+		Active:      true,
+		TokenType:   "access_token",
+		ClientID:    claims.ClientID,
+		Username:    user.Email,
+		Subject:     claims.UserID,
+		Role:        user.Role,
+		Permissions: user.Permissions,
+		SessionID:   claims.SessionID,
+		IssuedAt:    claims.IssuedAt,
+		ExpiresAt:   claims.ExpiresAt,
+		Issuer:      claims.Issuer,
+		Audience:    claims.Audience,
+	}
+	if claims.ClientID != "" {
+		response.Scope = strings.Join(claims.Scopes, " ")
+		response.Permissions = ScopedPermissions(user.Permissions, claims.Scopes)
+	}
+	if claims.ImpersonatorID != "" {
+		response.Actor = &IntrospectionActor{Subject: claims.ImpersonatorID}
+	}
+	return response, nil
+}
+
+func (s *Service) introspectRefreshToken(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	claims, err := s.jwtService.ValidateRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the latest token of a rotation is usable
+	session, err := s.repo.GetSessionByRefreshTokenHash(ctx, HashToken(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	if err := s.verifier.VerifySession(ctx, session.ID, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.verifier.LoadUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Username:  user.Email,
+		Subject:   claims.UserID,
+		Role:      user.Role,
+		SessionID: session.ID,
+		IssuedAt:  claims.IssuedAt,
+		ExpiresAt: claims.ExpiresAt,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+	}, nil
+}
+
+// inactiveOnRevocation reports refused tokens as inactive and passes other errors through
+func inactiveOnRevocation(response *IntrospectionResponse, err error) (*IntrospectionResponse, error) {
+	if err != nil {
+		if errors.Is(err, ErrExpiredToken) || IsAccessRevoked(err) {
+			return &IntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// RevokeToken lets a service account end the session behind an access or refresh token (RFC 7009).
+// Unknown, expired and already revoked tokens succeed silently. Client credentials tokens have no
+// session and cannot be revoked one by one; revoking their credential disables them instead.
+func (s *Service) RevokeToken(ctx context.Context, clientID, clientSecret, token string) error {
+	clientUser, err := s.authorizeClient(ctx, clientID, clientSecret, PermissionTokensRevoke)
+	if err != nil {
+		return err
+	}
+
+	var sessionID, userID string
+	if claims, err := s.jwtService.ValidateAccessToken(token); err == nil {
+		if claims.ClientID != "" {
+			return ErrUnsupportedTokenType
+		}
+		sessionID, userID = claims.SessionID, claims.UserID
+	} else if _, err := s.jwtService.ValidateRefreshToken(token); err == nil {
+		session, err := s.repo.GetSessionByRefreshTokenHash(ctx, HashToken(token))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+		sessionID, userID = session.ID, session.UserID
+	}
+	if sessionID == "" {
+		return nil
+	}
+
+	if err := s.repo.InvalidateSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	s.cacheDelSession(ctx, sessionID)
+
+	s.recordAudit(ctx, &audit.Event{
+		ActorID:    clientUser.ID,
+		Action:     audit.ActionSessionRevoked,
+		TargetType: audit.TargetSession,
+		TargetID:   sessionID,
+		Metadata:   map[string]any{"reason": "token_revocation", "client_id": clientID, "user_id": userID},
+	})
+
+	logger.Info("Session %s revoked by client %s", sessionID, clientID)
+	return nil
+}
+
+// -------------------------
+// External Identity Providers
+// -------------------------
+
+// ListOIDCProviders returns the providers users can log in with, in configuration order
+func (s *Service) ListOIDCProviders() []*OIDCProviderResponse {
+	providers := make([]*OIDCProviderResponse, 0, len(s.config.Auth.OIDCProviders))
+	for _, p := range s.config.Auth.OIDCProviders {
+		providers = append(providers, &OIDCProviderResponse{Name: p.Name})
+	}
+	return providers
+}
+
+// StartOIDCLogin begins an authorization code flow that logs the user in
+func (s *Service) StartOIDCLogin(ctx context.Context, providerName string, staySignedIn bool) (*OIDCAuthorizeResponse, error) {
+	return s.startOIDC(ctx, providerName, nil, staySignedIn)
+}
+
+// StartOIDCLink begins an authorization code flow that links the provider to a signed-in user
+func (s *Service) StartOIDCLink(ctx context.Context, providerName, userID string) (*OIDCAuthorizeResponse, error) {
+	return s.startOIDC(ctx, providerName, &userID, false)
+}
+
+func (s *Service) startOIDC(ctx context.Context, providerName string, userID *string, staySignedIn bool) (*OIDCAuthorizeResponse, error) {
+	provider, ok := s.oidc[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	state, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	codeVerifier, err := GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the hash of state is stored; it is the value returned to us in the callback
+	err = s.repo.CreateOIDCAuthState(ctx, &OIDCAuthState{
+		StateHash:    HashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		UserID:       userID,
+		StaySignedIn: staySignedIn,
+	}, s.config.Auth.OIDCStateLifetime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCAuthorizeResponse{AuthorizationURL: authURL, State: state}, nil
+}
+
+// CompleteOIDC handles the provider callback: it redeems the code, verifies the ID token and
+// either logs the user in or, for a flow started by StartOIDCLink, links the identity.
+func (s *Service) CompleteOIDC(ctx context.Context, providerName, code, state string, r *http.Request) (*OIDCCallbackResult, error) {
+	provider, ok := s.oidc[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	authState, err := s.repo.ConsumeOIDCAuthState(ctx, providerName, HashToken(state))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(ctx, code, authState.CodeVerifier, authState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if authState.UserID != nil {
+		identity, err := s.linkIdentity(ctx, *authState.UserID, providerName, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &OIDCCallbackResult{Identity: toIdentityResponse(identity)}, nil
+	}
+
+	response, accessToken, refreshToken, err := s.loginWithIdentity(ctx, providerName, claims, authState.StaySignedIn, r)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCCallbackResult{Login: response, AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// loginWithIdentity logs in the user linked to the identity. Unknown identities get a new account
+// when the provider allows signup; they are never attached to an existing account by email.
+func (s *Service) loginWithIdentity(ctx context.Context, providerName string, claims *OIDCClaims, staySignedIn bool, r *http.Request) (*LoginResponse, string, string, error) {
+	var email *string
+	if claims.Email != "" && claims.EmailVerified {
+		email = &claims.Email
+	}
+
+	identity, err := s.repo.GetIdentity(ctx, providerName, claims.Subject)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", "", err
+		}
+		identity, err = s.signupWithIdentity(ctx, providerName, claims, email)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	user, err := s.repo.GetUserByID(ctx, identity.UserID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get user: %w", err)
+	}
+	// Never leak account state to callers; treat as invalid credentials.
+	if user.IsServiceAccount || !user.IsActive || user.IsBlocked {
+		return nil, "", "", ErrInvalidCredentials
+	}
+	if s.config.Auth.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, "", "", ErrEmailNotVerified
+	}
+
+	if err := s.repo.TouchIdentity(ctx, identity.ID, email); err != nil {
+		logger.Warn("failed to record identity login: %v", err)
+	}
+
+	return s.beginLogin(ctx, user, staySignedIn, r)
+}
+
+func (s *Service) signupWithIdentity(ctx context.Context, providerName string, claims *OIDCClaims, email *string) (*Identity, error) {
+	if !s.oidc[providerName].config.AllowSignup || email == nil {
+		return nil, ErrIdentityNotLinked
+	}
+
+	if _, err := s.repo.GetUserByEmail(ctx, *email); err == nil {
+		return nil, ErrIdentityEmailInUse
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		firstName = claims.Name
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(*email, "@")
+	}
+
+	identity := &Identity{Provider: providerName, Subject: claims.Subject, Email: email}
+	if _, err := s.repo.CreateUserWithIdentity(ctx, firstName, lastName, *email, identity); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// A concurrent callback for the same subject won
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return nil, err
+	}
+
+	logger.Info("User %s registered through %s", identity.UserID, providerName)
+	return identity, nil
+}
+
+// linkIdentity attaches a provider identity to a signed-in user; one identity per provider
+func (s *Service) linkIdentity(ctx context.Context, userID, providerName string, claims *OIDCClaims) (*Identity, error) {
+	existing, err := s.repo.GetIdentity(ctx, providerName, claims.Subject)
+	if err == nil {
+		if existing.UserID == userID {
+			return existing, nil
+		}
+		return nil, ErrIdentityAlreadyLinked
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	identity := &Identity{UserID: userID, Provider: providerName, Subject: claims.Subject}
+	if claims.Email != "" && claims.EmailVerified {
+		identity.Email = &claims.Email
+	}
+	if err := s.repo.CreateIdentity(ctx, identity); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return nil, err
+	}
+
+	logger.Info("Identity %s linked to user %s", providerName, userID)
+	return identity, nil
+}
+
+// ListIdentities returns the provider identities linked to a user
+func (s *Service) ListIdentities(ctx context.Context, userID string) ([]*IdentityResponse, error) {
+	identities, err := s.repo.ListIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, toIdentityResponse(identity))
+	}
+	return response, nil
+}
+
+// UnlinkIdentity removes the user's identity at a provider, unless it is their only way to sign in
+func (s *Service) UnlinkIdentity(ctx context.Context, userID, providerName string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Accounts created through a provider have no password until they reset it
+	if user.Password == "" {
+		identities, err := s.repo.ListIdentities(ctx, userID)
+		if err != nil {
+			return err
+		}
+		passkeys, err := s.repo.ListPasskeys(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(passkeys) == 0 && len(identities) == 1 && identities[0].Provider == providerName {
+			return ErrLastLoginMethod
+		}
+	}
+
+	if err := s.repo.DeleteIdentity(ctx, userID, providerName); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrIdentityNotFound
+		}
+		return err
+	}
+
+	logger.Info("Identity %s unlinked from user %s", providerName, userID)
+	return nil
+}
+
+func toIdentityResponse(identity *Identity) *IdentityResponse {
+	return &IdentityResponse{
+		ID:          identity.ID,
+		Provider:    identity.Provider,
+		Email:       identity.Email,
+		LastLoginAt: identity.LastLoginAt,
+		CreatedAt:   identity.CreatedAt,
+	}
+}
+
+// -------------------------
+// Passkeys (WebAuthn)
+// -------------------------
+
+// StartPasskeyRegistration returns creation options for a new discoverable passkey.
+// Existing passkeys are excluded so the same authenticator is not registered twice.
+func (s *Service) StartPasskeyRegistration(ctx context.Context, userID string) (*PasskeyCreationOptions, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	passkeys, err := s.repo.ListPasskeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.issueWebAuthnChallenge(ctx, &WebAuthnChallenge{Purpose: webauthnPurposeRegister, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]PasskeyCredentialParameter, 0, len(supportedCOSEAlgorithms))
+	for _, alg := range supportedCOSEAlgorithms {
+		params = append(params, PasskeyCredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &PasskeyCreationOptions{
+		Challenge: challenge,
+		RP:        PasskeyRelyingParty{ID: s.webauthn.ID, Name: s.webauthn.Name},
+		User: PasskeyUser{
+			// The user handle comes back with every discoverable login
+			ID:          webauthnEncoding.EncodeToString([]byte(user.ID)),
+			Name:        user.Email,
+			DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		},
+		PubKeyCredParams:   params,
+		Timeout:            s.config.Auth.WebAuthnChallengeLifetime.Milliseconds(),
+		ExcludeCredentials: passkeyDescriptors(passkeys),
+		AuthenticatorSelection: PasskeyAuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores the passkey
+func (s *Service) FinishPasskeyRegistration(ctx context.Context, userID string, req *PasskeyRegisterRequest) (*PasskeyResponse, error) {
+	challenge, pending, err := s.consumeWebAuthnChallenge(ctx, req.Credential.Response.ClientDataJSON, webauthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	if pending.UserID != userID {
+		return nil, fmt.Errorf("%w: challenge was issued to another user", ErrInvalidPasskey)
+	}
+
+	registered, err := s.webauthn.VerifyRegistration(&req.Credential, challenge, true)
+	if err != nil {
+		return nil, err
+	}
+
+	transports := registered.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	passkey := &Passkey{
+		UserID:       userID,
+		Name:         req.Name,
+		CredentialID: registered.CredentialID,
+		PublicKey:    registered.PublicKey,
+		SignCount:    int64(registered.SignCount),
+		Transports:   transports,
+	}
+	if err := s.repo.CreatePasskey(ctx, passkey); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPasskeyAlreadyExists
+		}
+		return nil, err
+	}
+
+	logger.Info("Passkey %s registered for user %s", passkey.ID, userID)
+
+	return toPasskeyResponse(passkey), nil
+}
+
+// ListPasskeys returns the user's passkeys
+func (s *Service) ListPasskeys(ctx context.Context, userID string) ([]*PasskeyResponse, error) {
+	passkeys, err := s.repo.ListPasskeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*PasskeyResponse, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		response = append(response, toPasskeyResponse(passkey))
+	}
+	return response, nil
+}
+
+// DeletePasskey removes one of the user's passkeys, unless it is their only way to sign in
+func (s *Service) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.Password == "" {
+		identities, err := s.repo.ListIdentities(ctx, userID)
+		if err != nil {
+			return err
+		}
+		passkeys, err := s.repo.ListPasskeys(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(identities) == 0 && len(passkeys) == 1 && passkeys[0].ID == passkeyID {
+			return ErrLastLoginMethod
+		}
+	}
+
+	if err := s.repo.DeletePasskey(ctx, userID, passkeyID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrPasskeyNotFound
+		}
+		return err
+	}
+
+	logger.Info("Passkey %s deleted by user %s", passkeyID, userID)
+	return nil
+}
+
+// StartPasskeyLogin returns request options for a discoverable-credential login;
+// the authenticator lets the user pick the account
+func (s *Service) StartPasskeyLogin(ctx context.Context, staySignedIn bool) (*PasskeyRequestOptions, error) {
+	challenge, err := s.issueWebAuthnChallenge(ctx, &WebAuthnChallenge{Purpose: webauthnPurposeLogin, StaySignedIn: staySignedIn})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyRequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.config.Auth.WebAuthnChallengeLifetime.Milliseconds(),
+		RPID:             s.webauthn.ID,
+		AllowCredentials: []PasskeyCredentialDescriptor{},
+		UserVerification: "required",
+	}, nil
+}
+
+// FinishPasskeyLogin verifies the assertion and creates a session like Login does.
+// A user-verified passkey is already two factors, so no MFA challenge follows.
+func (s *Service) FinishPasskeyLogin(ctx context.Context, req *PasskeyLoginRequest, r *http.Request) (*LoginResponse, string, string, error) {
+	// The account is unknown until the assertion is checked, so only the IP can be throttled
+	ip := httpUtils.ClientIP(r)
+	if ip != "" {
+		if attempts := s.getAttempts(ctx, ipAttemptKey(ip)); attempts.Locked {
+			return nil, "", "", ErrTooManyAttempts
+		}
+	}
+
+	challenge, pending, err := s.consumeWebAuthnChallenge(ctx, req.Credential.Response.ClientDataJSON, webauthnPurposeLogin)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	passkey, err := s.verifyPasskey(ctx, &req.Credential, challenge, "", true)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPasskey) && ip != "" {
+			s.registerFailure(ctx, ipAttemptKey(ip), s.config.Auth.LoginIPMaxFailures)
+		}
+		return nil, "", "", err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, passkey.UserID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get user: %w", err)
+	}
+	// Never leak account state to callers; treat as invalid credentials.
+	if user.IsServiceAccount || !user.IsActive || user.IsBlocked {
+		return nil, "", "", ErrInvalidCredentials
+	}
+	if s.config.Auth.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, "", "", ErrEmailNotVerified
+	}
+
+	return s.completeLogin(ctx, user, pending.StaySignedIn, r)
+}
+
+// StartMFAPasskey returns request options for answering an MFA challenge with one of the
+// user's passkeys. User presence is enough here; the password was the first factor.
+func (s *Service) StartMFAPasskey(ctx context.Context, mfaToken string) (*PasskeyRequestOptions, error) {
+	claims, err := s.jwtService.ValidateMFAChallengeToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.repo.ListPasskeys(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) == 0 {
+		return nil, ErrPasskeyNotFound
+	}
+
+	challenge, err := s.issueWebAuthnChallenge(ctx, &WebAuthnChallenge{Purpose: webauthnPurposeMFA, UserID: claims.UserID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyRequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.config.Auth.WebAuthnChallengeLifetime.Milliseconds(),
+		RPID:             s.webauthn.ID,
+		AllowCredentials: passkeyDescriptors(passkeys),
+		UserVerification: "discouraged",
+	}, nil
+}
+
+// verifyMFAPasskey checks a passkey assertion answering StartMFAPasskey for the user
+func (s *Service) verifyMFAPasskey(ctx context.Context, userID string, assertion *PasskeyAssertion) error {
+	challenge, pending, err := s.consumeWebAuthnChallenge(ctx, assertion.Response.ClientDataJSON, webauthnPurposeMFA)
+	if err == nil && pending.UserID != userID {
+		err = fmt.Errorf("%w: challenge was issued to another user", ErrInvalidPasskey)
+	}
+	if err == nil {
+		_, err = s.verifyPasskey(ctx, assertion, challenge, userID, false)
+	}
+
+	// Count failed passkeys like wrong codes
+	if errors.Is(err, ErrInvalidPasskey) {
+		return fmt.Errorf("%w: %v", ErrInvalidMFACode, err)
+	}
+	return err
+}
+
+// verifyPasskey checks an assertion against the stored passkey it names and records the new
+// signature counter. A non-empty userID restricts the passkey to that user.
+func (s *Service) verifyPasskey(ctx context.Context, assertion *PasskeyAssertion, challenge, userID string, requireUV bool) (*Passkey, error) {
+	credentialID, err := decodeWebAuthnField(assertion.RawID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey, err := s.repo.GetPasskeyByCredentialID(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: unknown credential", ErrInvalidPasskey)
+		}
+		return nil, err
+	}
+	if userID != "" && passkey.UserID != userID {
+		return nil, fmt.Errorf("%w: credential belongs to another user", ErrInvalidPasskey)
+	}
+	// Discoverable credentials return the user handle set at registration
+	if assertion.Response.UserHandle != "" {
+		handle, err := decodeWebAuthnField(assertion.Response.UserHandle)
+		if err != nil || string(handle) != passkey.UserID {
+			return nil, fmt.Errorf("%w: user handle mismatch", ErrInvalidPasskey)
+		}
+	}
+
+	verified, err := s.webauthn.VerifyAssertion(assertion, challenge, passkey.PublicKey, requireUV)
+	if err != nil {
+		return nil, err
+	}
+
+	// A counter that stops increasing suggests a cloned authenticator.
+	// Synced passkeys usually have no counter and always report 0.
+	signCount := int64(verified.SignCount)
+	if (signCount != 0 || passkey.SignCount != 0) && signCount <= passkey.SignCount {
+		logger.Warn("Passkey %s of user %s reported a stale signature counter (%d <= %d)", passkey.ID, passkey.UserID, signCount, passkey.SignCount)
+		return nil, fmt.Errorf("%w: signature counter did not increase", ErrInvalidPasskey)
+	}
+
+	if err := s.repo.TouchPasskey(ctx, passkey.ID, signCount); err != nil {
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+// issueWebAuthnChallenge creates a challenge and remembers which ceremony it belongs to
+func (s *Service) issueWebAuthnChallenge(ctx context.Context, pending *WebAuthnChallenge) (string, error) {
+	challenge, err := GenerateWebAuthnChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.challenges.Save(ctx, HashToken(challenge), pending, s.config.Auth.WebAuthnChallengeLifetime); err != nil {
+		return "", fmt.Errorf("failed to store WebAuthn challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge looks up and invalidates the challenge a response answers
+func (s *Service) consumeWebAuthnChallenge(ctx context.Context, clientDataJSON, purpose string) (string, *WebAuthnChallenge, error) {
+	challenge, err := ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pending, found, err := s.challenges.Consume(ctx, HashToken(challenge))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to consume WebAuthn challenge: %w", err)
+	}
+	if !found || pending.Purpose != purpose {
+		return "", nil, fmt.Errorf("%w: unknown or expired challenge", ErrInvalidPasskey)
+	}
+
+	return challenge, pending, nil
+}
+
+func passkeyDescriptors(passkeys []*Passkey) []PasskeyCredentialDescriptor {
+	descriptors := make([]PasskeyCredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		descriptors = append(descriptors, PasskeyCredentialDescriptor{
+			Type:       "public-key",
+			ID:         webauthnEncoding.EncodeToString(passkey.CredentialID),
+			Transports: passkey.Transports,
+		})
+	}
+	return descriptors
+}
+
+func toPasskeyResponse(passkey *Passkey) *PasskeyResponse {
+	return &PasskeyResponse{
+		ID:         passkey.ID,
+		Name:       passkey.Name,
+		Transports: passkey.Transports,
+		LastUsedAt: passkey.LastUsedAt,
+		CreatedAt:  passkey.CreatedAt,
+	}
+}
+
+// -------------------------
+// Roles & Permissions
+// -------------------------
+
+// ListRoles returns every role with its permissions
+func (s *Service) ListRoles(ctx context.Context) ([]*RoleResponse, error) {
+	roles, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, toRoleResponse(role))
+	}
+	return response, nil
+}
+
+// ListPermissions returns every permission that can be granted to a role
+func (s *Service) ListPermissions(ctx context.Context) ([]*PermissionResponse, error) {
+	permissions, err := s.repo.ListPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*PermissionResponse, 0, len(permissions))
+	for _, p := range permissions {
+		response = append(response, &PermissionResponse{Name: p.Name, Description: p.Description})
+	}
+	return response, nil
+}
+
+// CreateRole creates a custom role with the given permissions
+func (s *Service) CreateRole(ctx context.Context, req *CreateRoleRequest) (*RoleResponse, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidRoleName
+	}
+	if err := s.checkPermissionsExist(ctx, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.GetRoleByName(ctx, req.Name); err == nil {
+		return nil, ErrRoleAlreadyExists
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	roleID, err := s.repo.CreateRole(ctx, req.Name, req.Description, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.repo.GetRoleByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Role %s created", role.Name)
+	return toRoleResponse(role), nil
+}
+
+// SetRolePermissions replaces the permissions of a role.
+// Cached permission sets of its users are dropped; permissions embedded in
+// already issued access tokens stay stale until those tokens expire.
+func (s *Service) SetRolePermissions(ctx context.Context, roleID string, permissions []string) (*RoleResponse, error) {
+	if _, err := s.repo.GetRoleByID(ctx, roleID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	if err := s.checkPermissionsExist(ctx, permissions); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetRolePermissions(ctx, roleID, permissions); err != nil {
+		return nil, err
+	}
+
+	userIDs, err := s.repo.GetUserIDsByRoleID(ctx, roleID)
+	if err != nil {
+		logger.Warn("failed to get role users for cache invalidation: %v", err)
+	}
+	for _, id := range userIDs {
+		s.cacheDelUser(ctx, id)
+	}
+
+	role, err := s.repo.GetRoleByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Permissions of role %s set to %v", role.Name, role.Permissions)
+	return toRoleResponse(role), nil
+}
+
+func (s *Service) checkPermissionsExist(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	known, err := s.repo.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(known))
+	for _, p := range known {
+		exists[p.Name] = true
+	}
+
+	for _, name := range names {
+		if !exists[name] {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, name)
+		}
+	}
+	return nil
+}
+
+func toRoleResponse(role *Role) *RoleResponse {
+	return &RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+// -------------------------
+// User Management
+// -------------------------
+
+// GetMe returns the current user's information
+func (s *Service) GetMe(ctx context.Context, userID string) (*UserResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &UserResponse{
+		ID:              user.ID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Role:            user.Role,
+		IsActive:        user.IsActive,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		DeletedAt:       user.DeletedAt,
+	}, nil
+}
+
+// BlockUser blocks a user and invalidates all their sessions
+func (s *Service) BlockUser(ctx context.Context, userID, blockedBy string) error {
+	if err := s.authorizeUserAction(ctx, blockedBy, userID, UserActionBlock, ""); err != nil {
+		return err
+	}
+
+	sessionIDs, err := s.repo.GetActiveSessionIDsByUserID(ctx, userID)
+	if err != nil {
+		logger.Warn("failed to get active session ids for cache invalidation: %v", err)
+	}
+	// Block user
+	if err := s.repo.BlockUser(ctx, userID, blockedBy); err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	// Invalidate all sessions
+	if err := s.repo.InvalidateAllUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to invalidate sessions: %w", err)
+	}
+	for _, sid := range sessionIDs {
+		s.cacheDelSession(ctx, sid)
+	}
+	s.cacheDelUser(ctx, userID)
+
+	if user, err := s.repo.GetUserByID(ctx, userID); err == nil {
+		s.notify(ctx, notification.TemplateAccountBlocked, user.Email, notification.AccountBlockedData{
+			Name: user.FirstName,
+			Time: formatNotificationTime(time.Now()),
+		})
+	}
+
+	s.recordUserAction(ctx, audit.ActionUserBlocked, blockedBy, userID)
+
+	logger.Info("User %s blocked by %s", userID, blockedBy)
+
+	return nil
+}
+
+// UnblockUser unblocks a user
+func (s *Service) UnblockUser(ctx context.Context, userID, unblockedBy string) error {
+	if err := s.authorizeUserAction(ctx, unblockedBy, userID, UserActionUnblock, ""); err != nil {
+		return err
+	}
+
+	if err := s.repo.UnblockUser(ctx, userID, unblockedBy); err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	s.cacheDelUser(ctx, userID)
+
+	s.recordUserAction(ctx, audit.ActionUserUnblocked, unblockedBy, userID)
+
+	logger.Info("User %s unblocked by %s", userID, unblockedBy)
+
+	return nil
+}
+
+// UnlockUser clears login and password reset lockouts of a user
+func (s *Service) UnlockUser(ctx context.Context, userID, unlockedBy string) error {
+	if err := s.authorizeUserAction(ctx, unlockedBy, userID, UserActionUnlock, ""); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	for _, key := range userAttemptKeys(user.Email) {
+		if err := s.attempts.Clear(ctx, key); err != nil {
+			return fmt.Errorf("failed to clear lockout %s: %w", key, err)
+		}
+	}
+
+	s.recordUserAction(ctx, audit.ActionUserUnlocked, unlockedBy, userID)
+
+	logger.Info("User %s unlocked by %s", userID, unlockedBy)
+
+	return nil
+}
+
+// -------------------------
+// Session Management
+// -------------------------
+
+// GetUserSessions returns all active sessions for a user.
+// Activity not written to the database yet is included; idle sessions are left out.
+func (s *Service) GetUserSessions(ctx context.Context, userID, currentSessionID string) ([]*SessionResponse, error) {
+	sessions, err := s.repo.GetUserSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user sessions: %w", err)
+	}
+
+	now := time.Now()
+	var response []*SessionResponse
+	for _, session := range sessions {
+		if s.activity.IsIdle(session.ID, session.LastActivityAt, now) {
+			continue
+		}
+		response = append(response, &SessionResponse{
 			ID:             session.ID,
 			DeviceName:     formatDeviceName(session.DeviceInfo, session.UserAgent),
 			DeviceInfo:     session.DeviceInfo,
 			IPAddress:      session.IPAddress,
-			LastActivityAt: session.LastActivityAt,
+			LastActivityAt: s.activity.LastActivity(session.ID, session.LastActivityAt),
 			ExpiresAt:      session.ExpiresAt,
 			CreatedAt:      session.CreatedAt,
 			IsCurrent:      session.ID == currentSessionID,
@@ -477,11 +2555,185 @@ func (s *Service) DeleteSession(ctx context.Context, sessionID, userID string) e
 	}
 	s.cacheDelSession(ctx, sessionID)
 
+	s.recordAudit(ctx, &audit.Event{
+		ActorID:    userID,
+		Action:     audit.ActionSessionRevoked,
+		TargetType: audit.TargetSession,
+		TargetID:   sessionID,
+		Metadata:   map[string]any{"reason": "deleted"},
+	})
+
 	logger.Info("Session %s deleted by user %s", sessionID, userID)
 
 	return nil
 }
 
+// -------------------------
+// Impersonation
+// -------------------------
+
+// maxImpersonationLifetime caps IMPERSONATION_LIFETIME; impersonation tokens cannot be refreshed
+const maxImpersonationLifetime = time.Hour
+
+// StartImpersonation lets a support user act as another user for a short time.
+// The impersonation is tied to the actor's session, so logging out ends it too. The owner/admin
+// hierarchy applies, and owners, service accounts and disabled accounts cannot be impersonated.
+func (s *Service) StartImpersonation(ctx context.Context, actorID, actorSessionID, targetID, reason string, r *http.Request) (*ImpersonationResponse, error) {
+	if err := s.authorizeUserAction(ctx, actorID, targetID, UserActionImpersonate, ""); err != nil {
+		return nil, err
+	}
+
+	target, err := s.repo.GetUserByID(ctx, targetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if target.Role == RoleOwner || target.IsServiceAccount || !target.IsActive || target.IsBlocked {
+		return nil, ErrImpersonationForbidden
+	}
+
+	actor, err := s.repo.GetUserByID(ctx, actorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get acting user: %w", err)
+	}
+
+	lifetime := s.config.Auth.ImpersonationLifetime
+	if lifetime <= 0 || lifetime > maxImpersonationLifetime {
+		lifetime = maxImpersonationLifetime
+	}
+
+	imp := &Impersonation{
+		ActorID:        actor.ID,
+		ActorSessionID: actorSessionID,
+		TargetID:       target.ID,
+		Reason:         reason,
+		IPAddress:      httpUtils.ClientIP(r),
+		UserAgent:      r.UserAgent(),
+		ExpiresAt:      time.Now().Add(lifetime),
+	}
+	if err := s.repo.CreateImpersonation(ctx, imp); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.tokenPermissions(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.jwtService.GenerateImpersonationToken(target.ID, target.Email, target.Role, actor.ID, imp.ID, permissions, lifetime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	s.recordImpersonationEvent(ctx, SecurityEventImpersonationStart, imp, r)
+	logger.Warn("User %s started impersonating %s (impersonation: %s, reason: %q)", actor.Email, target.Email, imp.ID, reason)
+
+	return &ImpersonationResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(lifetime.Seconds()),
+		Impersonation: &ImpersonationInfo{
+			ID:                imp.ID,
+			ImpersonatorID:    actor.ID,
+			ImpersonatorEmail: actor.Email,
+			Reason:            imp.Reason,
+			ExpiresAt:         imp.ExpiresAt,
+		},
+		User: &UserResponse{
+			ID:              target.ID,
+			FirstName:       target.FirstName,
+			LastName:        target.LastName,
+			Email:           target.Email,
+			Role:            target.Role,
+			IsActive:        target.IsActive,
+			EmailVerifiedAt: target.EmailVerifiedAt,
+			CreatedAt:       target.CreatedAt,
+			UpdatedAt:       target.UpdatedAt,
+			DeletedAt:       target.DeletedAt,
+		},
+	}, nil
+}
+
+// StopImpersonation ends an impersonation; its token is refused from then on
+func (s *Service) StopImpersonation(ctx context.Context, impersonationID string, r *http.Request) error {
+	imp, err := s.repo.GetActiveImpersonation(ctx, impersonationID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	ended, err := s.repo.EndImpersonation(ctx, impersonationID)
+	if err != nil {
+		return err
+	}
+	if ended {
+		s.recordImpersonationEvent(ctx, SecurityEventImpersonationEnd, imp, r)
+		logger.Info("Impersonation %s of user %s by %s ended", imp.ID, imp.TargetID, imp.ActorID)
+	}
+
+	return nil
+}
+
+// GetImpersonationInfo describes a running impersonation for the /me banner
+func (s *Service) GetImpersonationInfo(ctx context.Context, impersonationID string) (*ImpersonationInfo, error) {
+	imp, err := s.repo.GetActiveImpersonation(ctx, impersonationID)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := s.repo.GetUserByID(ctx, imp.ActorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get acting user: %w", err)
+	}
+
+	return &ImpersonationInfo{
+		ID:                imp.ID,
+		ImpersonatorID:    actor.ID,
+		ImpersonatorEmail: actor.Email,
+		Reason:            imp.Reason,
+		ExpiresAt:         imp.ExpiresAt,
+	}, nil
+}
+
+// recordImpersonationEvent adds the start or end of an impersonation to the impersonated user's security events
+func (s *Service) recordImpersonationEvent(ctx context.Context, eventType string, imp *Impersonation, r *http.Request) {
+	event := &SecurityEvent{
+		UserID:    imp.TargetID,
+		SessionID: imp.ActorSessionID,
+		EventType: eventType,
+		IPAddress: httpUtils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Details: map[string]interface{}{
+			"impersonation_id": imp.ID,
+			"impersonator_id":  imp.ActorID,
+			"reason":           imp.Reason,
+			"expires_at":       imp.ExpiresAt,
+		},
+	}
+	if err := s.repo.CreateSecurityEvent(ctx, event); err != nil {
+		logger.Error("failed to record security event: %v", err)
+	}
+
+	action := audit.ActionImpersonationStarted
+	if eventType == SecurityEventImpersonationEnd {
+		action = audit.ActionImpersonationEnded
+	}
+	s.recordAudit(ctx, &audit.Event{
+		ActorID:    imp.ActorID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   imp.TargetID,
+		Metadata: map[string]any{
+			"impersonation_id": imp.ID,
+			"reason":           imp.Reason,
+		},
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+	})
+}
+
 // -------------------------
 // Helper Methods
 // -------------------------
@@ -495,7 +2747,7 @@ func (s *Service) createSession(ctx context.Context, user *UserWithAuth, r *http
 	session := &Session{
 		UserID:         user.ID,
 		DeviceInfo:     deviceInfo,
-		IPAddress:      httpUtils.ExtractIPAddress(r),
+		IPAddress:      httpUtils.ClientIP(r),
 		UserAgent:      r.UserAgent(),
 		IsActive:       true,
 		LastActivityAt: time.Now(),
@@ -518,7 +2770,11 @@ func (s *Service) createSession(ctx context.Context, user *UserWithAuth, r *http
 	}
 
 	// Now generate tokens with actual session ID
-	accessToken, err := s.jwtService.GenerateAccessToken(user.ID, user.Email, user.Role, session.ID)
+	permissions, err := s.tokenPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	accessToken, err := s.jwtService.GenerateAccessToken(user.ID, user.Email, user.Role, session.ID, permissions)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -542,21 +2798,41 @@ func (s *Service) createSession(ctx context.Context, user *UserWithAuth, r *http
 			ttl = until
 		}
 		_ = s.cache.SetSession(ctx, session.ID, &CachedSession{
-			UserID:    user.ID,
-			IsActive:  true,
-			ExpiresAt: session.ExpiresAt,
+			UserID:         user.ID,
+			IsActive:       true,
+			ExpiresAt:      session.ExpiresAt,
+			LastActivityAt: session.LastActivityAt,
 		}, ttl)
-		_ = s.cache.SetUser(ctx, user.ID, &CachedUser{
-			Email:     user.Email,
-			Role:      user.Role,
-			IsActive:  user.IsActive,
-			IsBlocked: user.IsBlocked,
-		}, s.cacheTTL)
+		// Without a resolved permission set the user is left for the middleware to cache
+		if permissions == nil {
+			permissions, _ = s.repo.GetUserPermissions(ctx, user.ID)
+		}
+		if permissions != nil {
+			_ = s.cache.SetUser(ctx, user.ID, &CachedUser{
+				Email:       user.Email,
+				Role:        user.Role,
+				Permissions: permissions,
+				IsActive:    user.IsActive,
+				IsBlocked:   user.IsBlocked,
+			}, s.cacheTTL)
+		}
 	}
 
 	return session, accessToken, refreshToken, nil
 }
 
+// tokenPermissions resolves the permissions embedded in access tokens, or nil when embedding is disabled
+func (s *Service) tokenPermissions(ctx context.Context, userID string) ([]string, error) {
+	if !s.config.Auth.JWTEmbedPermissions {
+		return nil, nil
+	}
+	permissions, err := s.repo.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+	return permissions, nil
+}
+
 func (s *Service) cacheDelSession(ctx context.Context, sessionID string) {
 	if s.cache == nil || sessionID == "" {
 		return
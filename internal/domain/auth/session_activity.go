@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/shared/logger"
+	"sync"
+	"time"
+)
+
+// SessionActivity tracks when sessions were last used and enforces the idle timeout.
+// Requests only touch memory: each session is recorded at most once per interval and recorded
+// activity is written to user_sessions in one batched UPDATE per interval, so authenticated
+// traffic does not cost a DB write per request. last_activity_at lags by at most two intervals.
+type SessionActivity struct {
+	repo        *Repository
+	interval    time.Duration
+	idleTimeout time.Duration
+
+	mu      sync.Mutex
+	seen    map[string]time.Time // last recorded activity, kept for one interval to throttle Touch
+	pending map[string]time.Time // recorded but not written yet
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewSessionActivity starts the background writer; Close stops it.
+// A non-positive SessionActivityInterval defaults to one minute.
+func NewSessionActivity(repo *Repository, cfg *config.AuthConfig) *SessionActivity {
+	interval := cfg.SessionActivityInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	a := &SessionActivity{
+		repo:        repo,
+		interval:    interval,
+		idleTimeout: cfg.SessionIdleTimeout,
+		seen:        make(map[string]time.Time),
+		pending:     make(map[string]time.Time),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go a.run()
+
+	return a
+}
+
+// Touch records that a session was used just now
+func (a *SessionActivity) Touch(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if last, ok := a.seen[sessionID]; ok && now.Sub(last) < a.interval {
+		return
+	}
+	a.seen[sessionID] = now
+	a.pending[sessionID] = now
+}
+
+// LastActivity returns the later of the stored last_activity_at and activity recorded here
+// that may not have been written yet
+func (a *SessionActivity) LastActivity(sessionID string, stored time.Time) time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	last := stored
+	if at, ok := a.seen[sessionID]; ok && at.After(last) {
+		last = at
+	}
+	if at, ok := a.pending[sessionID]; ok && at.After(last) {
+		last = at
+	}
+	return last
+}
+
+// IsIdle reports whether a session has gone unused for longer than the idle timeout.
+// Always false when the idle timeout is disabled.
+func (a *SessionActivity) IsIdle(sessionID string, stored time.Time, now time.Time) bool {
+	if a.idleTimeout <= 0 {
+		return false
+	}
+	return now.Sub(a.LastActivity(sessionID, stored)) > a.idleTimeout
+}
+
+// Flush writes recorded activity. On failure the batch is kept for the next attempt.
+func (a *SessionActivity) Flush(ctx context.Context) error {
+	now := time.Now()
+
+	a.mu.Lock()
+	batch := a.pending
+	a.pending = make(map[string]time.Time)
+	for id, at := range a.seen {
+		if now.Sub(at) >= a.interval {
+			delete(a.seen, id)
+		}
+	}
+	a.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := a.repo.TouchSessions(ctx, batch); err != nil {
+		a.mu.Lock()
+		for id, at := range batch {
+			if newer, ok := a.pending[id]; !ok || newer.Before(at) {
+				a.pending[id] = at
+			}
+		}
+		a.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the background writer and writes what is still pending
+func (a *SessionActivity) Close(ctx context.Context) error {
+	a.stopOnce.Do(func() { close(a.stop) })
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return a.Flush(ctx)
+}
+
+func (a *SessionActivity) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), a.interval)
+			if err := a.Flush(ctx); err != nil {
+				logger.Warn("failed to record session activity: %v", err)
+			}
+			cancel()
+		}
+	}
+}
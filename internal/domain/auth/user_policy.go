@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// User management actions checked against the owner/admin hierarchy
+const (
+	UserActionBlock          = "block"
+	UserActionUnblock        = "unblock"
+	UserActionUnlock         = "unlock"
+	UserActionLogoutSessions = "logout_sessions"
+	UserActionResetMFA       = "reset_mfa"
+	UserActionUpdate         = "update"
+	UserActionDelete         = "delete"
+	UserActionChangeRole     = "change_role"
+	UserActionImpersonate    = "impersonate"
+)
+
+const (
+	RoleOwner = "owner"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrSelfActionForbidden = errors.New("this action cannot be performed on your own account")
+	ErrTargetOutranksActor = errors.New("users with an equal or higher role cannot be managed")
+	ErrRoleNotAssignable   = errors.New("roles equal to or above your own cannot be assigned")
+	ErrRoleExceedsActor    = errors.New("roles granting permissions you do not hold cannot be assigned")
+)
+
+// selfForbiddenActions would let users lock themselves out or escalate/remove their own access
+var selfForbiddenActions = map[string]bool{
+	UserActionBlock:       true,
+	UserActionDelete:      true,
+	UserActionChangeRole:  true,
+	UserActionResetMFA:    true,
+	UserActionImpersonate: true,
+}
+
+// roleRank orders the privileged roles. Every other role (system, customer, custom roles)
+// ranks lowest and carries no authority over other users beyond its permissions.
+func roleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 2
+	case RoleAdmin:
+		return 1
+	}
+	return 0
+}
+
+// PolicySubject is a user as seen by the authorization policy
+type PolicySubject struct {
+	ID          string
+	Role        string
+	Permissions []string
+}
+
+// CheckUserAction is the central owner/admin hierarchy policy. The route permission decides
+// whether the actor may perform an action at all; this decides whether it may target this user:
+//
+//   - nobody may block, delete, reset MFA of, impersonate or change the role of themselves
+//   - privileged users (owner, admin) can only be managed by a strictly higher role,
+//     so admins cannot touch owners or other admins and owners cannot touch other owners
+//   - a role can only be assigned by someone ranking above it; owners may appoint owners
+//   - below owner, a role can only be assigned if the actor holds every permission it grants
+func CheckUserAction(actor, target PolicySubject, action, newRole string, newRolePermissions []string) error {
+	if actor.ID == target.ID {
+		if selfForbiddenActions[action] {
+			return ErrSelfActionForbidden
+		}
+		return nil
+	}
+
+	actorRank := roleRank(actor.Role)
+	if targetRank := roleRank(target.Role); targetRank > 0 && actorRank <= targetRank {
+		return ErrTargetOutranksActor
+	}
+
+	if action == UserActionChangeRole && actor.Role != RoleOwner {
+		if roleRank(newRole) >= actorRank {
+			return ErrRoleNotAssignable
+		}
+		if !isSubset(newRolePermissions, actor.Permissions) {
+			return ErrRoleExceedsActor
+		}
+	}
+
+	return nil
+}
+
+func isSubset(subset, set []string) bool {
+	held := make(map[string]bool, len(set))
+	for _, p := range set {
+		held[p] = true
+	}
+	for _, p := range subset {
+		if !held[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// userPolicyMessage returns the client-facing reason of a CheckUserAction refusal, or "" for other errors
+func userPolicyMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrSelfActionForbidden):
+		return "You cannot perform this action on your own account"
+	case errors.Is(err, ErrTargetOutranksActor):
+		return "You cannot manage a user with an equal or higher role"
+	case errors.Is(err, ErrRoleNotAssignable):
+		return "You cannot assign a role equal to or above your own"
+	case errors.Is(err, ErrRoleExceedsActor):
+		return "You cannot assign a role with permissions you do not have"
+	}
+	return ""
+}
+
+// authorizeUserAction loads both users' roles and applies CheckUserAction.
+// Unknown targets and roles pass so the action itself reports them as it did before.
+func (s *Service) authorizeUserAction(ctx context.Context, actorID, targetID, action, newRole string) error {
+	actor, err := s.repo.GetUserByID(ctx, actorID)
+	if err != nil {
+		return fmt.Errorf("failed to get acting user: %w", err)
+	}
+
+	target, err := s.repo.GetUserByID(ctx, targetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to get target user: %w", err)
+	}
+
+	subject := PolicySubject{ID: actor.ID, Role: actor.Role}
+	var newRolePermissions []string
+	if action == UserActionChangeRole {
+		if subject.Permissions, err = s.repo.GetUserPermissions(ctx, actor.ID); err != nil {
+			return fmt.Errorf("failed to get acting user permissions: %w", err)
+		}
+
+		role, err := s.repo.GetRoleByName(ctx, newRole)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get role: %w", err)
+		}
+		if role != nil {
+			newRolePermissions = role.Permissions
+		}
+	}
+
+	return CheckUserAction(
+		subject,
+		PolicySubject{ID: target.ID, Role: target.Role},
+		action,
+		newRole,
+		newRolePermissions,
+	)
+}
+
+// AuthorizeUserAction lets other domains apply the hierarchy policy.
+// A non-empty reason means the action is denied; err only reports lookup failures.
+func (s *Service) AuthorizeUserAction(ctx context.Context, actorID, targetID, action, newRole string) (string, error) {
+	err := s.authorizeUserAction(ctx, actorID, targetID, action, newRole)
+	if msg := userPolicyMessage(err); msg != "" {
+		return msg, nil
+	}
+	return "", err
+}
+
+// RefreshUserAccess drops the cached role and permissions of a user after they changed elsewhere
+func (s *Service) RefreshUserAccess(ctx context.Context, userID string) {
+	s.cacheDelUser(ctx, userID)
+}
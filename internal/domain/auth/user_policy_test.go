@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckUserAction(t *testing.T) {
+	tests := []struct {
+		actorRole  string
+		self       bool
+		targetRole string
+		action     string
+		newRole    string
+		want       error
+	}{
+		// owner acting on their own account
+		{RoleOwner, true, RoleOwner, UserActionBlock, "", ErrSelfActionForbidden},
+		{RoleOwner, true, RoleOwner, UserActionUnblock, "", nil},
+		{RoleOwner, true, RoleOwner, UserActionUnlock, "", nil},
+		{RoleOwner, true, RoleOwner, UserActionLogoutSessions, "", nil},
+		{RoleOwner, true, RoleOwner, UserActionResetMFA, "", ErrSelfActionForbidden},
+		{RoleOwner, true, RoleOwner, UserActionUpdate, "", nil},
+		{RoleOwner, true, RoleOwner, UserActionDelete, "", ErrSelfActionForbidden},
+		{RoleOwner, true, RoleOwner, UserActionChangeRole, "user", ErrSelfActionForbidden}, // owner demoting themselves
+		{RoleOwner, true, RoleOwner, UserActionImpersonate, "", ErrSelfActionForbidden},
+		// owner acting on another owner
+		{RoleOwner, false, RoleOwner, UserActionBlock, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionUnblock, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionUnlock, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionLogoutSessions, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionResetMFA, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionUpdate, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionDelete, "", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionChangeRole, RoleOwner, ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionChangeRole, RoleAdmin, ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionChangeRole, "user", ErrTargetOutranksActor},
+		{RoleOwner, false, RoleOwner, UserActionImpersonate, "", ErrTargetOutranksActor},
+		// owner acting on another admin
+		{RoleOwner, false, RoleAdmin, UserActionBlock, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionUnblock, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionUnlock, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionLogoutSessions, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionResetMFA, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionUpdate, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionDelete, "", nil},
+		{RoleOwner, false, RoleAdmin, UserActionChangeRole, RoleOwner, nil},
+		{RoleOwner, false, RoleAdmin, UserActionChangeRole, RoleAdmin, nil},
+		{RoleOwner, false, RoleAdmin, UserActionChangeRole, "user", nil},
+		{RoleOwner, false, RoleAdmin, UserActionImpersonate, "", nil},
+		// owner acting on another user
+		{RoleOwner, false, "user", UserActionBlock, "", nil},
+		{RoleOwner, false, "user", UserActionUnblock, "", nil},
+		{RoleOwner, false, "user", UserActionUnlock, "", nil},
+		{RoleOwner, false, "user", UserActionLogoutSessions, "", nil},
+		{RoleOwner, false, "user", UserActionResetMFA, "", nil},
+		{RoleOwner, false, "user", UserActionUpdate, "", nil},
+		{RoleOwner, false, "user", UserActionDelete, "", nil},
+		{RoleOwner, false, "user", UserActionChangeRole, RoleOwner, nil},
+		{RoleOwner, false, "user", UserActionChangeRole, RoleAdmin, nil},
+		{RoleOwner, false, "user", UserActionChangeRole, "user", nil},
+		{RoleOwner, false, "user", UserActionImpersonate, "", nil},
+		// admin acting on their own account
+		{RoleAdmin, true, RoleAdmin, UserActionBlock, "", ErrSelfActionForbidden},
+		{RoleAdmin, true, RoleAdmin, UserActionUnblock, "", nil},
+		{RoleAdmin, true, RoleAdmin, UserActionUnlock, "", nil},
+		{RoleAdmin, true, RoleAdmin, UserActionLogoutSessions, "", nil},
+		{RoleAdmin, true, RoleAdmin, UserActionResetMFA, "", ErrSelfActionForbidden},
+		{RoleAdmin, true, RoleAdmin, UserActionUpdate, "", nil},
+		{RoleAdmin, true, RoleAdmin, UserActionDelete, "", ErrSelfActionForbidden},
+		{RoleAdmin, true, RoleAdmin, UserActionChangeRole, "user", ErrSelfActionForbidden},
+		{RoleAdmin, true, RoleAdmin, UserActionImpersonate, "", ErrSelfActionForbidden},
+		// admin acting on another owner
+		{RoleAdmin, false, RoleOwner, UserActionBlock, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionUnblock, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionUnlock, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionLogoutSessions, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionResetMFA, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionUpdate, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionDelete, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionChangeRole, RoleOwner, ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionChangeRole, RoleAdmin, ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleOwner, UserActionChangeRole, "user", ErrTargetOutranksActor}, // admin demoting an owner
+		{RoleAdmin, false, RoleOwner, UserActionImpersonate, "", ErrTargetOutranksActor},
+		// admin acting on another admin
+		{RoleAdmin, false, RoleAdmin, UserActionBlock, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionUnblock, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionUnlock, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionLogoutSessions, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionResetMFA, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionUpdate, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionDelete, "", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionChangeRole, RoleOwner, ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionChangeRole, RoleAdmin, ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionChangeRole, "user", ErrTargetOutranksActor},
+		{RoleAdmin, false, RoleAdmin, UserActionImpersonate, "", ErrTargetOutranksActor},
+		// admin acting on another user
+		{RoleAdmin, false, "user", UserActionBlock, "", nil},
+		{RoleAdmin, false, "user", UserActionUnblock, "", nil},
+		{RoleAdmin, false, "user", UserActionUnlock, "", nil},
+		{RoleAdmin, false, "user", UserActionLogoutSessions, "", nil},
+		{RoleAdmin, false, "user", UserActionResetMFA, "", nil},
+		{RoleAdmin, false, "user", UserActionUpdate, "", nil},
+		{RoleAdmin, false, "user", UserActionDelete, "", nil},
+		{RoleAdmin, false, "user", UserActionChangeRole, RoleOwner, ErrRoleNotAssignable}, // admin promoting to owner
+		{RoleAdmin, false, "user", UserActionChangeRole, RoleAdmin, ErrRoleNotAssignable},
+		{RoleAdmin, false, "user", UserActionChangeRole, "user", nil},
+		{RoleAdmin, false, "user", UserActionImpersonate, "", nil},
+		// user acting on their own account
+		{"user", true, "user", UserActionBlock, "", ErrSelfActionForbidden},
+		{"user", true, "user", UserActionUnblock, "", nil},
+		{"user", true, "user", UserActionUnlock, "", nil},
+		{"user", true, "user", UserActionLogoutSessions, "", nil},
+		{"user", true, "user", UserActionResetMFA, "", ErrSelfActionForbidden},
+		{"user", true, "user", UserActionUpdate, "", nil},
+		{"user", true, "user", UserActionDelete, "", ErrSelfActionForbidden},
+		{"user", true, "user", UserActionChangeRole, "user", ErrSelfActionForbidden},
+		{"user", true, "user", UserActionImpersonate, "", ErrSelfActionForbidden},
+		// user acting on another owner
+		{"user", false, RoleOwner, UserActionBlock, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionUnblock, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionUnlock, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionLogoutSessions, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionResetMFA, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionUpdate, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionDelete, "", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionChangeRole, RoleOwner, ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionChangeRole, RoleAdmin, ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionChangeRole, "user", ErrTargetOutranksActor},
+		{"user", false, RoleOwner, UserActionImpersonate, "", ErrTargetOutranksActor},
+		// user acting on another admin
+		{"user", false, RoleAdmin, UserActionBlock, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionUnblock, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionUnlock, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionLogoutSessions, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionResetMFA, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionUpdate, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionDelete, "", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionChangeRole, RoleOwner, ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionChangeRole, RoleAdmin, ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionChangeRole, "user", ErrTargetOutranksActor},
+		{"user", false, RoleAdmin, UserActionImpersonate, "", ErrTargetOutranksActor},
+		// user acting on another user
+		{"user", false, "user", UserActionBlock, "", nil},
+		{"user", false, "user", UserActionUnblock, "", nil},
+		{"user", false, "user", UserActionUnlock, "", nil},
+		{"user", false, "user", UserActionLogoutSessions, "", nil},
+		{"user", false, "user", UserActionResetMFA, "", nil},
+		{"user", false, "user", UserActionUpdate, "", nil},
+		{"user", false, "user", UserActionDelete, "", nil},
+		{"user", false, "user", UserActionChangeRole, RoleOwner, ErrRoleNotAssignable},
+		{"user", false, "user", UserActionChangeRole, RoleAdmin, ErrRoleNotAssignable},
+		{"user", false, "user", UserActionChangeRole, "user", ErrRoleNotAssignable},
+		{"user", false, "user", UserActionImpersonate, "", nil},
+	}
+
+	for _, tt := range tests {
+		name := tt.actorRole + " on other " + tt.targetRole
+		if tt.self {
+			name = tt.actorRole + " on self"
+		}
+		name += "/" + tt.action
+		if tt.newRole != "" {
+			name += " to " + tt.newRole
+		}
+
+		t.Run(name, func(t *testing.T) {
+			actor := PolicySubject{ID: "actor", Role: tt.actorRole}
+			target := PolicySubject{ID: "target", Role: tt.targetRole}
+			if tt.self {
+				target.ID = actor.ID
+			}
+
+			if err := CheckUserAction(actor, target, tt.action, tt.newRole, nil); !errors.Is(err, tt.want) {
+				t.Errorf("CheckUserAction() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUserActionRolePermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		actorRole  string
+		actorPerms []string
+		rolePerms  []string
+		want       error
+	}{
+		{"role within actor permissions", RoleAdmin, []string{"users:read", "users:write"}, []string{"users:read"}, nil},
+		{"role with equal permissions", RoleAdmin, []string{"users:read"}, []string{"users:read"}, nil},
+		{"role without permissions", RoleAdmin, []string{"users:read"}, nil, nil},
+		{"role granting a permission the actor lacks", RoleAdmin, []string{"users:read"}, []string{"users:read", "roles:write"}, ErrRoleExceedsActor},
+		{"actor without permissions", RoleAdmin, nil, []string{"users:read"}, ErrRoleExceedsActor},
+		{"owner is not limited by own permissions", RoleOwner, []string{"users:read"}, []string{"roles:write"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor := PolicySubject{ID: "actor", Role: tt.actorRole, Permissions: tt.actorPerms}
+			target := PolicySubject{ID: "target", Role: "user"}
+
+			if err := CheckUserAction(actor, target, UserActionChangeRole, "custom", tt.rolePerms); !errors.Is(err, tt.want) {
+				t.Errorf("CheckUserAction() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// WebAuthn (passkeys), implementing just enough of the W3C Level 2 spec for attestation "none":
+// registration stores the credential public key, logins verify assertion signatures against it.
+
+var ErrInvalidPasskey = errors.New("invalid passkey response")
+
+const (
+	webauthnChallengeBytes = 32
+
+	webauthnTypeCreate = "webauthn.create"
+	webauthnTypeGet    = "webauthn.get"
+
+	// Authenticator data flags
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40
+	authDataExtensions   = 0x80
+
+	// COSE algorithms (RFC 8152 / RFC 8812)
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+
+	// COSE key types
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+)
+
+// webauthnEncoding is how browsers serialise binary fields (PublicKeyCredential.toJSON)
+var webauthnEncoding = base64.RawURLEncoding
+
+// supportedCOSEAlgorithms are offered to authenticators in order of preference
+var supportedCOSEAlgorithms = []int64{coseAlgES256, coseAlgEdDSA, coseAlgRS256}
+
+// -------------------------
+// Ceremony options
+// -------------------------
+
+// PasskeyCreationOptions is passed to navigator.credentials.create() (after base64url decoding)
+type PasskeyCreationOptions struct {
+	Challenge              string                        `json:"challenge"`
+	RP                     PasskeyRelyingParty           `json:"rp"`
+	User                   PasskeyUser                   `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"` // milliseconds
+	ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                        `json:"attestation"`
+}
+
+// PasskeyRequestOptions is passed to navigator.credentials.get() (after base64url decoding).
+// AllowCredentials is empty for discoverable logins; the authenticator picks the account.
+type PasskeyRequestOptions struct {
+	Challenge        string                        `json:"challenge"`
+	Timeout          int64                         `json:"timeout"` // milliseconds
+	RPID             string                        `json:"rpId"`
+	AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                        `json:"userVerification"`
+}
+
+type PasskeyRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PasskeyUser struct {
+	ID          string `json:"id"` // base64url user handle
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type PasskeyCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type PasskeyCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"` // base64url credential ID
+	Transports []string `json:"transports,omitempty"`
+}
+
+type PasskeyAuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// -------------------------
+// Ceremony responses
+// -------------------------
+
+// PasskeyAttestation is the JSON form of the PublicKeyCredential returned by create()
+type PasskeyAttestation struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// PasskeyAssertion is the JSON form of the PublicKeyCredential returned by get()
+type PasskeyAssertion struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// -------------------------
+// Relying party
+// -------------------------
+
+// WebAuthnRelyingParty checks ceremony responses against the configured RP ID and origins
+type WebAuthnRelyingParty struct {
+	ID      string
+	Name    string
+	origins map[string]bool
+}
+
+func NewWebAuthnRelyingParty(id, name string, origins []string) *WebAuthnRelyingParty {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	return &WebAuthnRelyingParty{ID: id, Name: name, origins: allowed}
+}
+
+// RegisteredPasskey is the verified outcome of a registration ceremony
+type RegisteredPasskey struct {
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key as sent by the authenticator
+	SignCount    uint32
+	Transports   []string
+}
+
+// VerifiedAssertion is the verified outcome of an authentication ceremony
+type VerifiedAssertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// GenerateWebAuthnChallenge returns a random base64url challenge
+func GenerateWebAuthnChallenge() (string, error) {
+	bytes := make([]byte, webauthnChallengeBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate WebAuthn challenge: %w", err)
+	}
+	return webauthnEncoding.EncodeToString(bytes), nil
+}
+
+// ClientDataChallenge extracts the challenge from a response so the caller can look up the
+// ceremony it answers. Nothing is verified yet.
+func ClientDataChallenge(clientDataJSON string) (string, error) {
+	raw, err := decodeWebAuthnField(clientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	var clientData struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil || clientData.Challenge == "" {
+		return "", fmt.Errorf("%w: malformed client data", ErrInvalidPasskey)
+	}
+	return clientData.Challenge, nil
+}
+
+// VerifyRegistration checks a create() response for the given challenge and extracts the
+// new credential. Attestation statements are not verified; only "none" is requested.
+func (rp *WebAuthnRelyingParty) VerifyRegistration(resp *PasskeyAttestation, challenge string, requireUV bool) (*RegisteredPasskey, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidPasskey)
+	}
+
+	clientDataJSON, err := decodeWebAuthnField(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyClientData(clientDataJSON, webauthnTypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := decodeWebAuthnField(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidPasskey)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authenticator data", ErrInvalidPasskey)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrInvalidPasskey)
+	}
+	if resp.RawID != "" {
+		if rawID, err := decodeWebAuthnField(resp.RawID); err != nil || !bytes.Equal(rawID, authData.credentialID) {
+			return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidPasskey)
+		}
+	}
+
+	// Refuse keys we could never verify a login with
+	if _, _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &RegisteredPasskey{
+		CredentialID: authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		Transports:   resp.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion checks a get() response for the given challenge against a stored public key
+func (rp *WebAuthnRelyingParty) VerifyAssertion(resp *PasskeyAssertion, challenge string, publicKey []byte, requireUV bool) (*VerifiedAssertion, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidPasskey)
+	}
+
+	clientDataJSON, err := decodeWebAuthnField(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyClientData(clientDataJSON, webauthnTypeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decodeWebAuthnField(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeWebAuthnField(resp.Response.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// The authenticator signs authenticatorData || SHA-256(clientDataJSON)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+
+	key, alg, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyCOSESignature(key, alg, signed, signature); err != nil {
+		return nil, err
+	}
+
+	return &VerifiedAssertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&authDataUserVerified != 0,
+	}, nil
+}
+
+// verifyClientData checks the ceremony type, challenge and origin the browser reported
+func (rp *WebAuthnRelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("%w: malformed client data", ErrInvalidPasskey)
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony type %q", ErrInvalidPasskey, clientData.Type)
+	}
+	if clientData.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidPasskey)
+	}
+	if !rp.origins[clientData.Origin] {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidPasskey, clientData.Origin)
+	}
+	if clientData.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremonies are not allowed", ErrInvalidPasskey)
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte // only with attested credential data (registration)
+	publicKey    []byte
+}
+
+// verifyAuthenticatorData parses authenticator data and checks the RP ID hash and flags
+func (rp *WebAuthnRelyingParty) verifyAuthenticatorData(data []byte, requireUV bool) (*authenticatorData, error) {
+	// rpIdHash (32) | flags (1) | signCount (4) | [attested credential data] | [extensions]
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidPasskey)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: RP ID mismatch", ErrInvalidPasskey)
+	}
+
+	authData := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&authDataUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidPasskey)
+	}
+	if requireUV && authData.flags&authDataUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user not verified", ErrInvalidPasskey)
+	}
+
+	rest := data[37:]
+	if authData.flags&authDataAttested != 0 {
+		// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey (COSE_Key)
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidPasskey)
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("%w: invalid credential ID length", ErrInvalidPasskey)
+		}
+		authData.credentialID = append([]byte(nil), rest[:idLength]...)
+		rest = rest[idLength:]
+
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+		}
+		authData.publicKey = append([]byte(nil), rest[:len(rest)-len(afterKey)]...)
+		rest = afterKey
+	}
+	if authData.flags&authDataExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+		}
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrInvalidPasskey)
+	}
+
+	return authData, nil
+}
+
+// parseCOSEKey decodes a COSE_Key into a Go public key and its signature algorithm
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidPasskey, err)
+	}
+	key, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: malformed public key", ErrInvalidPasskey)
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == coseAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 { // P-256
+			return nil, 0, fmt.Errorf("%w: invalid EC2 key", ErrInvalidPasskey)
+		}
+		// Reject points off the curve; NewPublicKey validates the uncompressed encoding
+		point := append(append([]byte{0x04}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, 0, fmt.Errorf("%w: invalid EC2 key", ErrInvalidPasskey)
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, alg, nil
+
+	case kty == coseKtyOKP && alg == coseAlgEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize { // Ed25519
+			return nil, 0, fmt.Errorf("%w: invalid OKP key", ErrInvalidPasskey)
+		}
+		return ed25519.PublicKey(x), alg, nil
+
+	case kty == coseKtyRSA && alg == coseAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 { // at least 2048 bits
+			return nil, 0, fmt.Errorf("%w: invalid RSA key", ErrInvalidPasskey)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, alg, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrInvalidPasskey, kty, alg)
+}
+
+func verifyCOSESignature(key crypto.PublicKey, alg int64, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+
+	var valid bool
+	switch alg {
+	case coseAlgES256:
+		valid = ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature)
+	case coseAlgEdDSA:
+		valid = ed25519.Verify(key.(ed25519.PublicKey), signed, signature)
+	case coseAlgRS256:
+		valid = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	if !valid {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidPasskey)
+	}
+	return nil
+}
+
+// decodeWebAuthnField decodes a base64url field, tolerating padding some clients add
+func decodeWebAuthnField(value string) ([]byte, error) {
+	decoded, err := webauthnEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("%w: malformed base64url field", ErrInvalidPasskey)
+	}
+	return decoded, nil
+}
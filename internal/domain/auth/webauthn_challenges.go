@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// WebAuthnChallengeStore keeps issued WebAuthn challenges until they are answered or expire.
+// Challenges are single-use: Consume removes them. Keys are HashToken(challenge).
+// Redis backs it when caching is enabled; otherwise the webauthn_challenges table is used.
+type WebAuthnChallengeStore interface {
+	Save(ctx context.Context, challengeHash string, challenge *WebAuthnChallenge, ttl time.Duration) error
+	// Consume deletes and returns an unexpired challenge; found is false if there is none
+	Consume(ctx context.Context, challengeHash string) (challenge *WebAuthnChallenge, found bool, err error)
+}
+
+// WebAuthnChallenge records which ceremony a challenge was issued for.
+// UserID is empty for discoverable logins, where the authenticator picks the account.
+type WebAuthnChallenge struct {
+	Purpose      string `json:"purpose"`
+	UserID       string `json:"user_id,omitempty"`
+	StaySignedIn bool   `json:"stay_signed_in,omitempty"`
+}
+
+const (
+	webauthnPurposeRegister = "register"
+	webauthnPurposeLogin    = "login"
+	webauthnPurposeMFA      = "mfa"
+)
+
+// -------------------------
+// Database-backed store
+// -------------------------
+
+type dbWebAuthnChallengeStore struct {
+	repo *Repository
+}
+
+// NewDBWebAuthnChallengeStore creates a WebAuthnChallengeStore backed by the webauthn_challenges table
+func NewDBWebAuthnChallengeStore(repo *Repository) WebAuthnChallengeStore {
+	return &dbWebAuthnChallengeStore{repo: repo}
+}
+
+func (s *dbWebAuthnChallengeStore) Save(ctx context.Context, challengeHash string, challenge *WebAuthnChallenge, ttl time.Duration) error {
+	return s.repo.CreateWebAuthnChallenge(ctx, challengeHash, challenge, ttl)
+}
+
+func (s *dbWebAuthnChallengeStore) Consume(ctx context.Context, challengeHash string) (*WebAuthnChallenge, bool, error) {
+	return s.repo.ConsumeWebAuthnChallenge(ctx, challengeHash)
+}
@@ -2,19 +2,29 @@ package product
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"rest_api_poc/internal/infra/db/query"
 	"rest_api_poc/internal/shared/appError"
 	"rest_api_poc/internal/shared/httpUtils"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// maxSearchLength bounds the search text; longer input only makes the query slower
+const maxSearchLength = 200
+
 type Handler struct {
-	service Service
+	service        Service
+	requireIfMatch bool
 }
 
-func NewHandler(s Service) *Handler {
-	return &Handler{service: s}
+// NewHandler creates a product handler.
+// With requireIfMatch set, updates and deletes without an If-Match header are rejected with 428.
+func NewHandler(s Service, requireIfMatch bool) *Handler {
+	return &Handler{service: s, requireIfMatch: requireIfMatch}
 }
 
 func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) error {
@@ -25,7 +35,7 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("Invalid request body", err)
 	}
 
-	if err := h.service.CreateProduct(ctx, &p); err != nil {
+	if err := h.service.CreateProduct(ctx, httpUtils.RequestUserID(r), &p); err != nil {
 		return appError.Internal(err)
 	}
 
@@ -50,24 +60,71 @@ func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if httpUtils.NotModified(w, r, product.Version) {
+		return nil
+	}
 	httpUtils.WriteJson(w, http.StatusOK, product)
 	return nil
 }
 
-// ListProducts retrieves all products
+// ListProducts retrieves one page of products
+// Query: sort (name, price, created_at; "-" prefix for descending), cursor, limit,
+// min_price, max_price, name (prefix), created_after (RFC 3339), include_total
 func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context() // Extract context from request
 
-	products, err := h.service.ListProducts(ctx)
+	filter, err := parseListFilter(r)
 	if err != nil {
+		return err
+	}
+
+	page, err := h.service.ListProducts(ctx, filter)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidCursor) {
+			return appError.Validation("Invalid cursor", err)
+		}
 		return appError.Internal(err)
 	}
 
-	httpUtils.WriteJson(w, http.StatusOK, products)
+	httpUtils.WriteJson(w, http.StatusOK, page)
+	return nil
+}
+
+// SearchProducts finds products by name
+// Query: q (required), plus the ListProducts filters, cursor and limit; results are always ordered by rank
+func (h *Handler) SearchProducts(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context() // Extract context from request
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		return appError.Validation("q parameter is required", nil)
+	}
+	if len(q) > maxSearchLength {
+		return appError.Validation("q parameter is too long", nil)
+	}
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.service.SearchProducts(ctx, q, filter)
+	if err != nil {
+		if errors.Is(err, ErrEmptySearch) {
+			return appError.Validation("q must contain letters or digits", err)
+		}
+		if errors.Is(err, query.ErrInvalidCursor) {
+			return appError.Validation("Invalid cursor", err)
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.WriteJson(w, http.StatusOK, page)
 	return nil
 }
 
 // UpdateProduct updates an existing product
+// If-Match with the product's ETag makes the update conditional (412 when the product changed meanwhile)
 func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context() // Extract context from request
 
@@ -77,6 +134,11 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("id parameter is required", nil)
 	}
 
+	ifMatch, err := httpUtils.IfMatch(r, h.requireIfMatch)
+	if err != nil {
+		return err
+	}
+
 	var p Product
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
 		return appError.Validation("Invalid request body", err)
@@ -85,18 +147,23 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) error {
 	// Ensure ID from URL matches the product ID
 	p.ID = id
 
-	if err := h.service.UpdateProduct(ctx, &p); err != nil {
+	if err := h.service.UpdateProduct(ctx, httpUtils.RequestUserID(r), &p, ifMatch); err != nil {
 		if err == ErrProductNotFound {
 			return appError.NotFound("Product not found", err)
 		}
+		if err == ErrVersionMismatch {
+			return appError.PreconditionFailed("Product has been modified", err)
+		}
 		return appError.Internal(err)
 	}
 
+	w.Header().Set("ETag", httpUtils.ETag(p.Version))
 	httpUtils.WriteJson(w, http.StatusOK, p)
 	return nil
 }
 
-// DeleteProduct deletes a product by ID
+// DeleteProduct moves a product to the trash
+// If-Match with the product's ETag makes the delete conditional (412 when the product changed meanwhile)
 func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context() // Extract context from request
 
@@ -106,13 +173,142 @@ func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("id parameter is required", nil)
 	}
 
-	if err := h.service.DeleteProduct(ctx, id); err != nil {
+	ifMatch, err := httpUtils.IfMatch(r, h.requireIfMatch)
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteProduct(ctx, httpUtils.RequestUserID(r), id, ifMatch); err != nil {
 		if err == ErrProductNotFound {
 			return appError.NotFound("Product not found", err)
 		}
+		if err == ErrVersionMismatch {
+			return appError.PreconditionFailed("Product has been modified", err)
+		}
 		return appError.Internal(err)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+// ListDeletedProducts retrieves one page of the trash, most recently deleted first
+// Query: the ListProducts filters, cursor and limit; sort is ignored
+func (h *Handler) ListDeletedProducts(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context() // Extract context from request
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.service.ListDeletedProducts(ctx, filter)
+	if err != nil {
+		if errors.Is(err, query.ErrInvalidCursor) {
+			return appError.Validation("Invalid cursor", err)
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.WriteJson(w, http.StatusOK, page)
+	return nil
+}
+
+// RestoreProduct takes a product out of the trash
+func (h *Handler) RestoreProduct(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context() // Extract context from request
+
+	// Extract ID from URL path
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return appError.Validation("id parameter is required", nil)
+	}
+
+	product, err := h.service.RestoreProduct(ctx, httpUtils.RequestUserID(r), id)
+	if err != nil {
+		if err == ErrProductNotFound {
+			return appError.NotFound("Product not found in trash", err)
+		}
+		return appError.Internal(err)
+	}
+
+	httpUtils.WriteJson(w, http.StatusOK, product)
+	return nil
+}
+
+// PurgeProduct permanently deletes a product from the trash
+func (h *Handler) PurgeProduct(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context() // Extract context from request
+
+	// Extract ID from URL path
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		return appError.Validation("id parameter is required", nil)
+	}
+
+	if err := h.service.PurgeProduct(ctx, id); err != nil {
+		if err == ErrProductNotFound {
+			return appError.NotFound("Product not found in trash", err)
+		}
+		return appError.Internal(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// parseListFilter reads the listing filters, sort and page from the query string
+func parseListFilter(r *http.Request) (*ListFilter, error) {
+	q := r.URL.Query()
+	f := &ListFilter{
+		NamePrefix: q.Get("name"),
+		Cursor:     q.Get("cursor"),
+	}
+
+	sort, err := query.ParseSort(q.Get("sort"), SortFields, DefaultSort)
+	if err != nil {
+		return nil, appError.Validation("sort must be one of name, price, created_at (prefix - for descending)", err)
+	}
+	f.Sort = sort
+
+	for name, dst := range map[string]**float64{"min_price": &f.MinPrice, "max_price": &f.MaxPrice} {
+		raw := q.Get(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			return nil, appError.Validation(name+" must be a non-negative number", err)
+		}
+		*dst = &v
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return nil, appError.Validation("min_price must not exceed max_price", nil)
+	}
+
+	if raw := q.Get("created_after"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, appError.Validation("created_after must be an RFC 3339 timestamp", err)
+		}
+		f.CreatedAfter = &t
+	}
+
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, appError.Validation("limit must be a positive integer", err)
+		}
+		f.Limit = limit
+	}
+
+	if raw := q.Get("include_total"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, appError.Validation("include_total must be true or false", err)
+		}
+		f.IncludeTotal = include
+	}
+
+	return f, nil
+}
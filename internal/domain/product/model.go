@@ -1,15 +1,51 @@
 package product
 
-import "time"
+import (
+	"rest_api_poc/internal/infra/db/query"
+	"rest_api_poc/internal/infra/db/stamp"
+	"time"
+)
 
 type Product struct {
-	ID        string     `json:"id"`
-	Name      string     `json:"name"`
-	Price     float64    `json:"price"`
-	CreatedBy *string    `json:"created_by,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedBy *string    `json:"updated_by,omitempty"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedBy *string    `json:"deleted_by,omitempty"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Price   float64 `json:"price"`
+	Version int64   `json:"version"` // bumped on every change; sent as the ETag
+	stamp.Columns
 }
+
+// SortFields are the orders GET /v1/products accepts in ?sort= (prefix "-" for descending)
+var SortFields = []query.SortField{
+	{Name: "name", Column: "name", Type: "text"},
+	{Name: "price", Column: "price", Type: "numeric"},
+	{Name: "created_at", Column: "created_at", Type: "timestamptz"},
+}
+
+// DefaultSort lists the newest products first
+var DefaultSort = query.Sort{Field: SortFields[2], Desc: true}
+
+// ListFilter narrows and orders a product listing; zero values match everything
+type ListFilter struct {
+	MinPrice     *float64
+	MaxPrice     *float64
+	NamePrefix   string
+	CreatedAfter *time.Time
+	Sort         query.Sort
+	Cursor       string
+	Limit        int
+	IncludeTotal bool
+}
+
+// ProductPage is one page of a product listing
+type ProductPage = query.Page[*Product]
+
+// SearchResult is a product matched by a search.
+// Highlight is the HTML-escaped product name with matched words wrapped in <mark>.
+type SearchResult struct {
+	Product
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+// SearchPage is one page of search results, best match first
+type SearchPage = query.Page[*SearchResult]
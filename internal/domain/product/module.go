@@ -1,11 +1,24 @@
 package product
 
-import "rest_api_poc/internal/infra/db"
+import (
+	"rest_api_poc/internal/domain/audit"
+	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/infra/db"
+)
+
+// Module encapsulates all product dependencies
+type Module struct {
+	Handler *Handler
+	Purger  *TrashPurger // closed by the caller on shutdown
+}
 
 // NewModule creates a new product module with all dependencies
 // It follows dependency injection pattern for production-ready code
-func NewModule(database db.DB) *Handler {
+func NewModule(database db.DB, cfg *config.ProductConfig, requireIfMatch bool, auditor audit.Recorder) *Module {
 	repo := NewRepository(database)
-	svc := NewService(repo)
-	return NewHandler(svc)
+	svc := NewService(repo, auditor)
+	return &Module{
+		Handler: NewHandler(svc, requireIfMatch),
+		Purger:  NewTrashPurger(svc, cfg.TrashRetention, cfg.TrashPurgeInterval),
+	}
 }
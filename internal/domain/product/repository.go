@@ -3,20 +3,37 @@ package product
 import (
 	"context"
 	"errors"
+	"fmt"
 	"rest_api_poc/internal/infra/db"
+	"rest_api_poc/internal/infra/db/query"
+	"rest_api_poc/internal/infra/db/stamp"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 var (
 	// ErrProductNotFound is returned when a product is not found
 	ErrProductNotFound = errors.New("product not found")
+	// ErrEmptySearch is returned when a search query contains no letters or digits
+	ErrEmptySearch = errors.New("search query is empty")
+	// ErrVersionMismatch is returned when a conditional write names a version that is no longer current
+	ErrVersionMismatch = errors.New("product has been modified")
 )
 
 type Repository interface {
 	CreateProduct(ctx context.Context, p *Product) error
 	GetProduct(ctx context.Context, id string) (*Product, error)
-	ListProducts(ctx context.Context) ([]*Product, error)
-	UpdateProduct(ctx context.Context, p *Product) error
-	DeleteProduct(ctx context.Context, id string) error
+	ListProducts(ctx context.Context, f *ListFilter) (*ProductPage, error)
+	SearchProducts(ctx context.Context, tsQuery, raw string, f *ListFilter) (*SearchPage, error)
+	UpdateProduct(ctx context.Context, p *Product, ifMatch []int64) error
+	DeleteProduct(ctx context.Context, id, deletedBy string, ifMatch []int64) (*Product, error)
+	GetDeletedProduct(ctx context.Context, id string) (*Product, error)
+	ListDeletedProducts(ctx context.Context, f *ListFilter) (*ProductPage, error)
+	RestoreProduct(ctx context.Context, id, restoredBy string) (*Product, error)
+	PurgeProduct(ctx context.Context, id string) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error)
 }
 
 type repository struct {
@@ -28,29 +45,64 @@ func NewRepository(database db.DB) Repository {
 	return &repository{db: database}
 }
 
+var productColumns = "id, name, price, version, " + stamp.Select("")
+
+// writtenColumns are read back into a product after a write
+var writtenColumns = "version, " + stamp.Select("")
+
+// CreateProduct inserts a product; the version and audit columns are read back into p
 func (r *repository) CreateProduct(ctx context.Context, p *Product) error {
-	_, err := r.db.Pool().Exec(ctx,
-		"INSERT INTO products (id, name, price) VALUES ($1, $2, $3)",
-		p.ID, p.Name, p.Price,
-	)
-	return err
+	return r.db.Pool().QueryRow(ctx,
+		`INSERT INTO products (id, name, price, created_by, updated_by) VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+writtenColumns,
+		p.ID, p.Name, p.Price, p.CreatedBy, p.UpdatedBy,
+	).Scan(append([]any{&p.Version}, p.Targets()...)...)
 }
 
 func (r *repository) GetProduct(ctx context.Context, id string) (*Product, error) {
 	row := r.db.Pool().QueryRow(ctx,
-		"SELECT id, name, price FROM products WHERE id=$1", id,
+		"SELECT "+productColumns+" FROM products WHERE id=$1 AND deleted_at IS NULL", id,
 	)
-	prod := &Product{}
-	if err := row.Scan(&prod.ID, &prod.Name, &prod.Price); err != nil {
+	return scanProduct(row)
+}
+
+// ListProducts retrieves one page of products matching the filter
+func (r *repository) ListProducts(ctx context.Context, f *ListFilter) (*ProductPage, error) {
+	b := query.New().Where("deleted_at IS NULL")
+	applyListFilter(b, f)
+
+	return r.listPage(ctx, b, f)
+}
+
+// ListDeletedProducts retrieves one page of the trash, most recently deleted first.
+// The listing filters apply; f.Sort is ignored.
+func (r *repository) ListDeletedProducts(ctx context.Context, f *ListFilter) (*ProductPage, error) {
+	b := query.New().Where("deleted_at IS NOT NULL")
+	applyListFilter(b, f)
+
+	trash := *f
+	trash.Sort = trashSort
+	return r.listPage(ctx, b, &trash)
+}
+
+// listPage runs a product listing with the builder's conditions, paginated by f
+func (r *repository) listPage(ctx context.Context, b *query.Builder, f *ListFilter) (*ProductPage, error) {
+	total, err := r.countProducts(ctx, b, f.IncludeTotal)
+	if err != nil {
 		return nil, err
 	}
-	return prod, nil
-}
 
-// ListProducts retrieves all products
-func (r *repository) ListProducts(ctx context.Context) ([]*Product, error) {
+	if f.Cursor != "" {
+		cursor, err := query.DecodeCursor(f.Cursor, f.Sort)
+		if err != nil {
+			return nil, err
+		}
+		b.After(f.Sort, "id", cursor)
+	}
+
 	rows, err := r.db.Pool().Query(ctx,
-		"SELECT id, name, price FROM products ORDER BY id",
+		"SELECT "+productColumns+" FROM products "+b.WhereClause()+" "+query.OrderLimit(f.Sort, "id", f.Limit),
+		b.Args()...,
 	)
 	if err != nil {
 		return nil, err
@@ -59,8 +111,8 @@ func (r *repository) ListProducts(ctx context.Context) ([]*Product, error) {
 
 	var products []*Product
 	for rows.Next() {
-		prod := &Product{}
-		if err := rows.Scan(&prod.ID, &prod.Name, &prod.Price); err != nil {
+		prod, err := scanProduct(rows)
+		if err != nil {
 			return nil, err
 		}
 		products = append(products, prod)
@@ -70,31 +122,167 @@ func (r *repository) ListProducts(ctx context.Context) ([]*Product, error) {
 		return nil, err
 	}
 
-	return products, nil
+	page := query.Paginate(products, f.Limit, f.Sort, func(p *Product) (string, string) {
+		return sortValue(p, f.Sort.Field.Name), p.ID
+	})
+	page.Total = total
+	return page, nil
 }
 
-// UpdateProduct updates an existing product
-func (r *repository) UpdateProduct(ctx context.Context, p *Product) error {
-	result, err := r.db.Pool().Exec(ctx,
-		"UPDATE products SET name=$1, price=$2 WHERE id=$3",
-		p.Name, p.Price, p.ID,
+// SearchProducts retrieves one page of products matching a full-text query, best match first.
+// tsQuery must be a valid to_tsquery expression; raw is the text as typed, used for fuzzy matching.
+func (r *repository) SearchProducts(ctx context.Context, tsQuery, raw string, f *ListFilter) (*SearchPage, error) {
+	// The search terms always take $1 and $2, so the rank and headline can refer to them
+	b := query.New().Where("(search_vector @@ to_tsquery('english', ?) OR name % ?)", tsQuery, raw).Where("deleted_at IS NULL")
+	applyListFilter(b, f)
+
+	total, err := r.countProducts(ctx, b, f.IncludeTotal)
+	if err != nil {
+		return nil, err
+	}
+
+	sort := searchSort
+	if f.Cursor != "" {
+		cursor, err := query.DecodeCursor(f.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		b.After(sort, "id", cursor)
+	}
+
+	rows, err := r.db.Pool().Query(ctx,
+		"SELECT "+productColumns+", "+searchRank+", "+searchHeadline+" FROM products "+b.WhereClause()+" "+query.OrderLimit(sort, "id", f.Limit),
+		b.Args()...,
 	)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to search products: %w", err)
 	}
+	defer rows.Close()
 
-	// Check if any row was actually updated
-	if result.RowsAffected() == 0 {
-		return ErrProductNotFound
+	var results []*SearchResult
+	for rows.Next() {
+		res := &SearchResult{}
+		targets := append([]any{&res.ID, &res.Name, &res.Price, &res.Version}, res.Targets()...)
+		if err := rows.Scan(append(targets, &res.Rank, &res.Highlight)...); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := query.Paginate(results, f.Limit, sort, func(res *SearchResult) (string, string) {
+		return strconv.FormatFloat(res.Rank, 'g', -1, 64), res.ID
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Search ranking combines full-text relevance with trigram similarity, so misspelled
+// names that only match fuzzily still rank below exact word matches. The headline is built
+// from the HTML-escaped name so the only markup it contains is our own <mark> tags.
+const (
+	searchRank     = "(ts_rank(search_vector, to_tsquery('english', $1)) + similarity(name, $2))::float8"
+	searchHeadline = "ts_headline('english', " + escapedName + ", to_tsquery('english', $1), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')"
+	escapedName    = `replace(replace(replace(replace(replace(name, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+)
+
+// trashSort lists the most recently deleted products first
+var trashSort = query.Sort{Field: query.SortField{Name: "deleted_at", Column: "deleted_at", Type: "timestamptz"}, Desc: true}
+
+// searchSort orders search results by rank; clients cannot choose another order
+var searchSort = query.Sort{Field: query.SortField{Name: "rank", Column: searchRank, Type: "float8"}, Desc: true}
+
+// applyListFilter adds the listing filters shared by ListProducts and SearchProducts
+func applyListFilter(b *query.Builder, f *ListFilter) {
+	if f.MinPrice != nil {
+		b.Where("price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		b.Where("price <= ?", *f.MaxPrice)
+	}
+	if f.NamePrefix != "" {
+		b.Where("name ILIKE ?", query.EscapeLike(f.NamePrefix)+"%")
+	}
+	if f.CreatedAfter != nil {
+		b.Where("created_at > ?", *f.CreatedAfter)
+	}
+}
+
+// countProducts counts the rows matching the builder's conditions when requested.
+// It must run before the cursor is applied: the total covers the whole filtered listing.
+func (r *repository) countProducts(ctx context.Context, b *query.Builder, include bool) (*int64, error) {
+	if !include {
+		return nil, nil
+	}
+	var count int64
+	if err := r.db.Pool().QueryRow(ctx, "SELECT COUNT(*) FROM products "+b.WhereClause(), b.Args()...).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count products: %w", err)
+	}
+	return &count, nil
+}
+
+// UpdateProduct updates an existing product; the version and audit columns are read back into p.
+// A non-nil ifMatch only updates the product while its version is one of those listed.
+func (r *repository) UpdateProduct(ctx context.Context, p *Product, ifMatch []int64) error {
+	err := r.db.Pool().QueryRow(ctx,
+		`UPDATE products SET name=$1, price=$2, updated_by=$3
+		 WHERE id=$4 AND deleted_at IS NULL AND ($5::bigint[] IS NULL OR version = ANY($5))
+		 RETURNING `+writtenColumns,
+		p.Name, p.Price, p.UpdatedBy, p.ID, ifMatch,
+	).Scan(append([]any{&p.Version}, p.Targets()...)...)
+	if err != nil {
+		// No row means nothing was updated
+		if errors.Is(err, pgx.ErrNoRows) {
+			return r.notUpdated(ctx, p.ID, ifMatch)
+		}
+		return err
 	}
 
 	return nil
 }
 
-// DeleteProduct deletes a product by ID
-func (r *repository) DeleteProduct(ctx context.Context, id string) error {
+// DeleteProduct moves a product to the trash and returns it as deleted.
+// A non-nil ifMatch only deletes the product while its version is one of those listed.
+func (r *repository) DeleteProduct(ctx context.Context, id, deletedBy string, ifMatch []int64) (*Product, error) {
+	row := r.db.Pool().QueryRow(ctx,
+		`UPDATE products SET deleted_at = NOW(), deleted_by = NULLIF($2, '')::uuid, updated_by = NULLIF($2, '')::uuid
+		 WHERE id=$1 AND deleted_at IS NULL AND ($3::bigint[] IS NULL OR version = ANY($3))
+		 RETURNING `+productColumns,
+		id, deletedBy, ifMatch,
+	)
+	p, err := scanProduct(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.notUpdated(ctx, id, ifMatch)
+	}
+	return p, err
+}
+
+// GetDeletedProduct retrieves a product from the trash
+func (r *repository) GetDeletedProduct(ctx context.Context, id string) (*Product, error) {
+	row := r.db.Pool().QueryRow(ctx,
+		"SELECT "+productColumns+" FROM products WHERE id=$1 AND deleted_at IS NOT NULL", id,
+	)
+	return notFound(scanProduct(row))
+}
+
+// RestoreProduct takes a product out of the trash and returns it
+func (r *repository) RestoreProduct(ctx context.Context, id, restoredBy string) (*Product, error) {
+	row := r.db.Pool().QueryRow(ctx,
+		`UPDATE products SET deleted_at = NULL, deleted_by = NULL, updated_by = NULLIF($2, '')::uuid
+		 WHERE id=$1 AND deleted_at IS NOT NULL
+		 RETURNING `+productColumns,
+		id, restoredBy,
+	)
+	return notFound(scanProduct(row))
+}
+
+// PurgeProduct permanently deletes a product; only products in the trash can be purged
+func (r *repository) PurgeProduct(ctx context.Context, id string) error {
 	result, err := r.db.Pool().Exec(ctx,
-		"DELETE FROM products WHERE id=$1", id,
+		"DELETE FROM products WHERE id=$1 AND deleted_at IS NOT NULL", id,
 	)
 	if err != nil {
 		return err
@@ -107,3 +295,65 @@ func (r *repository) DeleteProduct(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// PurgeDeletedBefore permanently deletes products that went to the trash before cutoff
+func (r *repository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.Pool().Exec(ctx,
+		"DELETE FROM products WHERE deleted_at IS NOT NULL AND deleted_at < $1", cutoff,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted products: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// notUpdated explains why a write matched no row: the product is gone, or a condition failed
+func (r *repository) notUpdated(ctx context.Context, id string, ifMatch []int64) error {
+	if ifMatch == nil {
+		return ErrProductNotFound
+	}
+
+	var exists bool
+	if err := r.db.Pool().QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM products WHERE id=$1 AND deleted_at IS NULL)", id,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return ErrProductNotFound
+}
+
+func scanProduct(row pgx.Row) (*Product, error) {
+	prod := &Product{}
+	if err := row.Scan(append([]any{&prod.ID, &prod.Name, &prod.Price, &prod.Version}, prod.Targets()...)...); err != nil {
+		return nil, err
+	}
+	return prod, nil
+}
+
+// notFound reports a missing row as ErrProductNotFound
+func notFound(p *Product, err error) (*Product, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	return p, err
+}
+
+// sortValue returns the cursor value of a product for one of SortFields
+func sortValue(p *Product, field string) string {
+	switch field {
+	case "name":
+		return p.Name
+	case "price":
+		return strconv.FormatFloat(p.Price, 'f', -1, 64)
+	case "deleted_at":
+		if p.DeletedAt != nil {
+			return p.DeletedAt.Format(time.RFC3339Nano)
+		}
+		return ""
+	default:
+		return p.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
@@ -2,36 +2,62 @@ package product
 
 import (
 	"net/http"
+	"rest_api_poc/internal/domain/auth"
 
 	"github.com/go-chi/chi/v5"
 )
 
 // RoleMiddleware interface to avoid circular dependency
 type RoleMiddleware interface {
-	RequireAdmin(next http.Handler) http.Handler
+	RequirePermission(permissions ...string) func(http.Handler) http.Handler
+}
+
+// RateLimiter interface to avoid circular dependency
+type RateLimiter interface {
+	User() func(http.Handler) http.Handler
 }
 
 // RegisterRoutes registers all product-related routes
 // Following RESTful conventions:
 //
-//	GET    /v1/products      - List all products (authenticated users)
-//	GET    /v1/products/{id} - Get a specific product (authenticated users)
-//	POST   /v1/products      - Create a new product (admin/owner only)
-//	PUT    /v1/products/{id} - Update a product (admin/owner only)
-//	DELETE /v1/products/{id} - Delete a product (admin/owner only)
-func RegisterRoutes(r chi.Router, h *Handler, roleMiddleware RoleMiddleware, wrap func(func(http.ResponseWriter, *http.Request) error) http.HandlerFunc) {
+//	GET    /v1/products        - List products, filtered, sorted and cursor paginated (authenticated users)
+//	GET    /v1/products/search - Search products by name, ranked and highlighted (authenticated users)
+//	GET    /v1/products/{id}   - Get a specific product (authenticated users)
+//	POST   /v1/products        - Create a new product (products:write)
+//	PUT    /v1/products/{id}   - Update a product (products:write)
+//	DELETE /v1/products/{id}   - Move a product to the trash (products:delete)
+//
+// Trash (products:trash):
+//
+//	GET    /v1/products/trash               - List deleted products
+//	POST   /v1/products/trash/{id}/restore  - Restore a deleted product
+//	DELETE /v1/products/trash/{id}          - Permanently delete a product
+func RegisterRoutes(r chi.Router, h *Handler, roleMiddleware RoleMiddleware, rateLimiter RateLimiter, wrap func(func(http.ResponseWriter, *http.Request) error) http.HandlerFunc) {
 	r.Route("/v1/products", func(rr chi.Router) {
+		rr.Use(rateLimiter.User())
+
 		// Public read access (any authenticated user)
-		rr.Get("/", wrap(h.ListProducts))   // GET /v1/products - List all
-		rr.Get("/{id}", wrap(h.GetProduct)) // GET /v1/products/{id} - Get one
+		rr.Get("/", wrap(h.ListProducts))         // GET /v1/products - List (paginated)
+		rr.Get("/search", wrap(h.SearchProducts)) // GET /v1/products/search - Search
+		rr.Get("/{id}", wrap(h.GetProduct))       // GET /v1/products/{id} - Get one
 
-		// Admin/Owner only routes (create, update, delete)
+		// Write routes (create, update)
 		rr.Group(func(rr chi.Router) {
-			rr.Use(roleMiddleware.RequireAdmin)
+			rr.Use(roleMiddleware.RequirePermission(auth.PermissionProductsWrite))
+
+			rr.Post("/", wrap(h.CreateProduct))    // POST /v1/products - Create
+			rr.Put("/{id}", wrap(h.UpdateProduct)) // PUT /v1/products/{id} - Update
+		})
+
+		rr.With(roleMiddleware.RequirePermission(auth.PermissionProductsDelete)).Delete("/{id}", wrap(h.DeleteProduct)) // DELETE /v1/products/{id} - Delete
+
+		// Trash management
+		rr.Route("/trash", func(rr chi.Router) {
+			rr.Use(roleMiddleware.RequirePermission(auth.PermissionProductsTrash))
 
-			rr.Post("/", wrap(h.CreateProduct))       // POST /v1/products - Create
-			rr.Put("/{id}", wrap(h.UpdateProduct))    // PUT /v1/products/{id} - Update
-			rr.Delete("/{id}", wrap(h.DeleteProduct)) // DELETE /v1/products/{id} - Delete
+			rr.Get("/", wrap(h.ListDeletedProducts))         // GET /v1/products/trash - List trash
+			rr.Post("/{id}/restore", wrap(h.RestoreProduct)) // POST /v1/products/trash/{id}/restore - Restore
+			rr.Delete("/{id}", wrap(h.PurgeProduct))         // DELETE /v1/products/trash/{id} - Purge
 		})
 	})
 }
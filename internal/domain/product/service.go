@@ -1,30 +1,53 @@
 package product
 
-import "context"
+import (
+	"context"
+	"errors"
+	"rest_api_poc/internal/domain/audit"
+	"rest_api_poc/internal/infra/db/query"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
 
 // Service defines the business logic interface for products
 // All methods accept context for proper cancellation and timeout handling
 type Service interface {
-	CreateProduct(ctx context.Context, p *Product) error
+	CreateProduct(ctx context.Context, actorID string, p *Product) error
 	GetProduct(ctx context.Context, id string) (*Product, error)
-	ListProducts(ctx context.Context) ([]*Product, error)
-	UpdateProduct(ctx context.Context, p *Product) error
-	DeleteProduct(ctx context.Context, id string) error
+	ListProducts(ctx context.Context, f *ListFilter) (*ProductPage, error)
+	SearchProducts(ctx context.Context, q string, f *ListFilter) (*SearchPage, error)
+	UpdateProduct(ctx context.Context, actorID string, p *Product, ifMatch []int64) error
+	DeleteProduct(ctx context.Context, actorID, id string, ifMatch []int64) error
+	ListDeletedProducts(ctx context.Context, f *ListFilter) (*ProductPage, error)
+	RestoreProduct(ctx context.Context, actorID, id string) (*Product, error)
+	PurgeProduct(ctx context.Context, id string) error
+	PurgeExpired(ctx context.Context, retention time.Duration) (int64, error)
 }
 
 type service struct {
-	repo Repository
+	repo    Repository
+	auditor audit.Recorder
 }
 
-// NewService creates a new product service with repository dependency
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+// NewService creates a new product service with repository dependency.
+// auditor may be nil, in which case changes are not recorded in the audit log.
+func NewService(repo Repository, auditor audit.Recorder) Service {
+	return &service{repo: repo, auditor: auditor}
 }
 
-// CreateProduct creates a new product
+// CreateProduct creates a new product on behalf of actorID
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) CreateProduct(ctx context.Context, p *Product) error {
-	return s.repo.CreateProduct(ctx, p)
+func (s *service) CreateProduct(ctx context.Context, actorID string, p *Product) error {
+	p.Created(actorID)
+	if err := s.repo.CreateProduct(ctx, p); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionProductCreated, p.ID, audit.Diff(nil, p))
+	return nil
 }
 
 // GetProduct retrieves a product by ID
@@ -33,20 +56,162 @@ func (s *service) GetProduct(ctx context.Context, id string) (*Product, error) {
 	return s.repo.GetProduct(ctx, id)
 }
 
-// ListProducts retrieves all products
+// ListProducts retrieves one page of products; the page size is clamped and the sort defaulted
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) ListProducts(ctx context.Context) ([]*Product, error) {
-	return s.repo.ListProducts(ctx)
+func (s *service) ListProducts(ctx context.Context, f *ListFilter) (*ProductPage, error) {
+	f.Limit = query.ClampLimit(f.Limit)
+	if f.Sort.Field.Name == "" {
+		f.Sort = DefaultSort
+	}
+	return s.repo.ListProducts(ctx, f)
 }
 
-// UpdateProduct updates an existing product
+// SearchProducts finds products by name, best match first; the listing filters still apply
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) UpdateProduct(ctx context.Context, p *Product) error {
-	return s.repo.UpdateProduct(ctx, p)
+func (s *service) SearchProducts(ctx context.Context, q string, f *ListFilter) (*SearchPage, error) {
+	tsQuery := prefixTSQuery(q)
+	if tsQuery == "" {
+		return nil, ErrEmptySearch
+	}
+
+	f.Limit = query.ClampLimit(f.Limit)
+	return s.repo.SearchProducts(ctx, tsQuery, strings.TrimSpace(q), f)
+}
+
+// prefixTSQuery turns free text into a to_tsquery expression that requires every word.
+// The last word matches as a prefix, so results follow the user while they type.
+// Only letters and digits are kept; tsquery operators in the input are never interpreted.
+func prefixTSQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
 }
 
-// DeleteProduct deletes a product by ID
+// UpdateProduct updates an existing product on behalf of actorID
+// A non-nil ifMatch lists the versions the caller expects; any other fails with ErrVersionMismatch.
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) DeleteProduct(ctx context.Context, id string) error {
-	return s.repo.DeleteProduct(ctx, id)
+func (s *service) UpdateProduct(ctx context.Context, actorID string, p *Product, ifMatch []int64) error {
+	existing, err := s.getExisting(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+
+	p.Updated(actorID)
+	if err := s.repo.UpdateProduct(ctx, p, ifMatch); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionProductUpdated, p.ID, audit.Diff(existing, p))
+	return nil
+}
+
+// DeleteProduct moves a product to the trash on behalf of actorID
+// A non-nil ifMatch lists the versions the caller expects; any other fails with ErrVersionMismatch.
+// Context flows from handler → service → repository for proper cancellation
+func (s *service) DeleteProduct(ctx context.Context, actorID, id string, ifMatch []int64) error {
+	existing, err := s.getExisting(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeleteProduct(ctx, id, actorID, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionProductDeleted, id, audit.Diff(existing, deleted))
+	return nil
+}
+
+// ListDeletedProducts retrieves one page of the trash, most recently deleted first
+// Context flows from handler → service → repository for proper cancellation
+func (s *service) ListDeletedProducts(ctx context.Context, f *ListFilter) (*ProductPage, error) {
+	f.Limit = query.ClampLimit(f.Limit)
+	return s.repo.ListDeletedProducts(ctx, f)
+}
+
+// RestoreProduct takes a product out of the trash on behalf of actorID
+// Context flows from handler → service → repository for proper cancellation
+func (s *service) RestoreProduct(ctx context.Context, actorID, id string) (*Product, error) {
+	trashed, err := s.repo.GetDeletedProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := s.repo.RestoreProduct(ctx, id, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.ActionProductRestored, id, audit.Diff(trashed, restored))
+	return restored, nil
+}
+
+// PurgeProduct permanently deletes a product from the trash
+// Context flows from handler → service → repository for proper cancellation
+func (s *service) PurgeProduct(ctx context.Context, id string) error {
+	trashed, err := s.repo.GetDeletedProduct(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.PurgeProduct(ctx, id); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionProductPurged, id, audit.Diff(trashed, nil))
+	return nil
+}
+
+// PurgeExpired permanently deletes products that have been in the trash for longer than retention.
+// One audit event summarizes each run that purged anything.
+func (s *service) PurgeExpired(ctx context.Context, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	purged, err := s.repo.PurgeDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	if purged > 0 && s.auditor != nil {
+		s.auditor.Record(ctx, &audit.Event{
+			Action:     audit.ActionProductPurged,
+			TargetType: audit.TargetProduct,
+			Metadata: map[string]any{
+				"count":          purged,
+				"deleted_before": cutoff,
+			},
+		})
+	}
+
+	return purged, nil
+}
+
+// getExisting loads the current state of a product for the audit diff
+func (s *service) getExisting(ctx context.Context, id string) (*Product, error) {
+	existing, err := s.repo.GetProduct(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return existing, nil
+}
+
+// record adds a product change to the audit log; the actor is taken from the request context
+func (s *service) record(ctx context.Context, action, id string, changes map[string]audit.Change) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Record(ctx, &audit.Event{
+		Action:     action,
+		TargetType: audit.TargetProduct,
+		TargetID:   id,
+		Changes:    changes,
+	})
 }
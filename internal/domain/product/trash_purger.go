@@ -0,0 +1,86 @@
+package product
+
+import (
+	"context"
+	"rest_api_poc/internal/shared/logger"
+	"sync"
+	"time"
+)
+
+// TrashPurger permanently deletes products that have been in the trash for longer than the retention period.
+// It runs once at startup and then every interval; with a non-positive retention it does nothing.
+type TrashPurger struct {
+	service   Service
+	retention time.Duration
+	interval  time.Duration
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTrashPurger starts the background purge; Close stops it.
+// A non-positive interval defaults to one hour.
+func NewTrashPurger(service Service, retention, interval time.Duration) *TrashPurger {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	p := &TrashPurger{
+		service:   service,
+		retention: retention,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if retention <= 0 {
+		close(p.done)
+		return p
+	}
+	go p.run()
+
+	return p
+}
+
+// Close stops the background purge, waiting for a running purge to finish
+func (p *TrashPurger) Close(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *TrashPurger) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *TrashPurger) purge() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+
+	purged, err := p.service.PurgeExpired(ctx, p.retention)
+	if err != nil {
+		logger.Warn("failed to purge deleted products: %v", err)
+		return
+	}
+	if purged > 0 {
+		logger.Info("Purged %d products deleted more than %s ago", purged, p.retention)
+	}
+}
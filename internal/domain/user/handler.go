@@ -2,6 +2,7 @@ package user
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"rest_api_poc/internal/shared/appError"
 	"rest_api_poc/internal/shared/httpUtils"
@@ -10,11 +11,14 @@ import (
 )
 
 type Handler struct {
-	service Service
+	service        Service
+	requireIfMatch bool
 }
 
-func NewHandler(s Service) *Handler {
-	return &Handler{service: s}
+// NewHandler creates a user handler.
+// With requireIfMatch set, updates and deletes without an If-Match header are rejected with 428.
+func NewHandler(s Service, requireIfMatch bool) *Handler {
+	return &Handler{service: s, requireIfMatch: requireIfMatch}
 }
 
 func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) error {
@@ -25,7 +29,7 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("Invalid request body", err)
 	}
 
-	if err := h.service.CreateUser(ctx, &u); err != nil {
+	if err := h.service.CreateUser(ctx, httpUtils.RequestUserID(r), &u); err != nil {
 		return appError.Internal(err)
 	}
 
@@ -51,6 +55,9 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if httpUtils.NotModified(w, r, user.Version) {
+		return nil
+	}
 	httpUtils.WriteJson(w, http.StatusOK, user)
 	return nil
 }
@@ -69,6 +76,7 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) error {
 }
 
 // UpdateUser updates an existing user
+// If-Match with the user's ETag makes the update conditional (412 when the user changed meanwhile)
 func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context() // Extract context from request
 
@@ -78,6 +86,11 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("id parameter is required", nil)
 	}
 
+	ifMatch, err := httpUtils.IfMatch(r, h.requireIfMatch)
+	if err != nil {
+		return err
+	}
+
 	var u User
 	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
 		return appError.Validation("Invalid request body", err)
@@ -86,18 +99,26 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) error {
 	// Ensure ID from URL matches the user ID
 	u.ID = id
 
-	if err := h.service.UpdateUser(ctx, &u); err != nil {
+	if err := h.service.UpdateUser(ctx, httpUtils.RequestUserID(r), &u, ifMatch); err != nil {
 		if err == ErrUserNotFound {
 			return appError.NotFound("User not found", err)
 		}
-		return appError.Internal(err)
+		if err == ErrVersionMismatch {
+			return appError.PreconditionFailed("User has been modified", err)
+		}
+		if err == ErrRoleNotFound {
+			return appError.Validation("Role does not exist", err)
+		}
+		return mapForbiddenError(err)
 	}
 
+	w.Header().Set("ETag", httpUtils.ETag(u.Version))
 	httpUtils.WriteJson(w, http.StatusOK, u)
 	return nil
 }
 
 // DeleteUser deletes a user by ID
+// If-Match with the user's ETag makes the delete conditional (412 when the user changed meanwhile)
 func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context() // Extract context from request
 
@@ -107,13 +128,30 @@ func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) error {
 		return appError.Validation("id parameter is required", nil)
 	}
 
-	if err := h.service.DeleteUser(ctx, id); err != nil {
+	ifMatch, err := httpUtils.IfMatch(r, h.requireIfMatch)
+	if err != nil {
+		return err
+	}
+
+	if err := h.service.DeleteUser(ctx, httpUtils.RequestUserID(r), id, ifMatch); err != nil {
 		if err == ErrUserNotFound {
 			return appError.NotFound("User not found", err)
 		}
-		return appError.Internal(err)
+		if err == ErrVersionMismatch {
+			return appError.PreconditionFailed("User has been modified", err)
+		}
+		return mapForbiddenError(err)
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
+
+// mapForbiddenError reports user management policy refusals as 403s
+func mapForbiddenError(err error) error {
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		return appError.Authorization(forbidden.Reason, err)
+	}
+	return appError.Internal(err)
+}
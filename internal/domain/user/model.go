@@ -1,23 +1,23 @@
 package user
 
-import "time"
+import (
+	"rest_api_poc/internal/infra/db/stamp"
+	"time"
+)
 
 // User represents a user in the system
 type User struct {
-	ID        string     `json:"id"`
-	FirstName string     `json:"first_name"`
-	LastName  string     `json:"last_name"`
-	Email     string     `json:"email"`
-	Password  string     `json:"-"` // Never expose password in JSON
-	Role      string     `json:"role"`
-	IsActive  bool       `json:"is_active"`
-	IsBlocked bool       `json:"is_blocked"`
-	BlockedAt *time.Time `json:"blocked_at,omitempty"`
-	BlockedBy *string    `json:"blocked_by,omitempty"`
-	CreatedBy *string    `json:"created_by,omitempty"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedBy *string    `json:"updated_by,omitempty"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedBy *string    `json:"deleted_by,omitempty"`
-	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	ID              string     `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"` // Never expose password in JSON
+	Role            string     `json:"role"`
+	IsActive        bool       `json:"is_active"`
+	IsBlocked       bool       `json:"is_blocked"`
+	BlockedAt       *time.Time `json:"blocked_at,omitempty"`
+	BlockedBy       *string    `json:"blocked_by,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Version         int64      `json:"version"` // bumped on every visible change; sent as the ETag
+	stamp.Columns
 }
@@ -1,11 +1,14 @@
 package user
 
-import "rest_api_poc/internal/infra/db"
+import (
+	"rest_api_poc/internal/domain/audit"
+	"rest_api_poc/internal/infra/db"
+)
 
 // NewModule creates a new user module with all dependencies
 // It follows dependency injection pattern for production-ready code
-func NewModule(database db.DB) *Handler {
+func NewModule(database db.DB, verifier EmailVerifier, access AccessController, auditor audit.Recorder, requireIfMatch bool) *Handler {
 	repo := NewRepository(database)
-	svc := NewService(repo)
-	return NewHandler(svc)
+	svc := NewService(repo, verifier, access, auditor)
+	return NewHandler(svc, requireIfMatch)
 }
@@ -4,19 +4,27 @@ import (
 	"context"
 	"errors"
 	"rest_api_poc/internal/infra/db"
+	"rest_api_poc/internal/infra/db/stamp"
+
+	"github.com/jackc/pgx/v5"
 )
 
 var (
 	// ErrUserNotFound is returned when a user is not found
 	ErrUserNotFound = errors.New("user not found")
+	// ErrRoleNotFound is returned when a user is assigned a role that does not exist
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrVersionMismatch is returned when a conditional write names a version that is no longer current
+	ErrVersionMismatch = errors.New("user has been modified")
 )
 
 type Repository interface {
 	CreateUser(ctx context.Context, u *User) error
 	GetUser(ctx context.Context, id string) (*User, error)
 	ListUsers(ctx context.Context) ([]*User, error)
-	UpdateUser(ctx context.Context, u *User) error
-	DeleteUser(ctx context.Context, id string) error
+	UpdateUser(ctx context.Context, u *User, ifMatch []int64) error
+	DeleteUser(ctx context.Context, id, deletedBy string, ifMatch []int64) error
+	RoleExists(ctx context.Context, name string) (bool, error)
 }
 
 type repository struct {
@@ -28,38 +36,36 @@ func NewRepository(database db.DB) Repository {
 	return &repository{db: database}
 }
 
+// userColumns are read by scanUser; the users table is aliased u and roles ro
+var userColumns = `u.id, u.first_name, u.last_name, u.email, u.is_active, u.is_blocked,
+	u.blocked_at, u.blocked_by, u.email_verified_at, ro.name as role, u.version, ` + stamp.Select("u")
+
+// writtenColumns are read back into a user after a write
+var writtenColumns = "version, " + stamp.Select("")
+
+// CreateUser inserts a user; the version and audit columns are read back into u
 func (r *repository) CreateUser(ctx context.Context, u *User) error {
-	_, err := r.db.Pool().Exec(ctx,
-		"INSERT INTO users (id, first_name, last_name, email) VALUES ($1, $2, $3, $4)",
-		u.ID, u.FirstName, u.LastName, u.Email,
-	)
-	return err
+	return r.db.Pool().QueryRow(ctx,
+		`INSERT INTO users (id, first_name, last_name, email, created_by, updated_by) VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+writtenColumns,
+		u.ID, u.FirstName, u.LastName, u.Email, u.CreatedBy, u.UpdatedBy,
+	).Scan(append([]any{&u.Version}, u.Targets()...)...)
 }
 
 func (r *repository) GetUser(ctx context.Context, id string) (*User, error) {
 	row := r.db.Pool().QueryRow(ctx,
-		`SELECT u.id, u.first_name, u.last_name, u.email, u.is_active, u.is_blocked, 
-		        u.blocked_at, u.blocked_by, u.created_at, u.updated_at, u.deleted_at, ro.name as role
+		`SELECT `+userColumns+`
 		 FROM users u
 		 JOIN roles ro ON u.role_id = ro.id
 		 WHERE u.id=$1 AND u.deleted_at IS NULL`, id,
 	)
-	user := &User{}
-	if err := row.Scan(
-		&user.ID, &user.FirstName, &user.LastName, &user.Email,
-		&user.IsActive, &user.IsBlocked, &user.BlockedAt, &user.BlockedBy,
-		&user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Role,
-	); err != nil {
-		return nil, err
-	}
-	return user, nil
+	return scanUser(row)
 }
 
 // ListUsers retrieves all users
 func (r *repository) ListUsers(ctx context.Context) ([]*User, error) {
 	rows, err := r.db.Pool().Query(ctx,
-		`SELECT u.id, u.first_name, u.last_name, u.email, u.is_active, u.is_blocked, 
-		        u.blocked_at, u.blocked_by, u.created_at, u.updated_at, u.deleted_at, ro.name as role
+		`SELECT `+userColumns+`
 		 FROM users u
 		 JOIN roles ro ON u.role_id = ro.id
 		 WHERE u.deleted_at IS NULL
@@ -72,12 +78,8 @@ func (r *repository) ListUsers(ctx context.Context) ([]*User, error) {
 
 	var users []*User
 	for rows.Next() {
-		user := &User{}
-		if err := rows.Scan(
-			&user.ID, &user.FirstName, &user.LastName, &user.Email,
-			&user.IsActive, &user.IsBlocked, &user.BlockedAt, &user.BlockedBy,
-			&user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Role,
-		); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -90,28 +92,38 @@ func (r *repository) ListUsers(ctx context.Context) ([]*User, error) {
 	return users, nil
 }
 
-// UpdateUser updates an existing user
-func (r *repository) UpdateUser(ctx context.Context, u *User) error {
-	result, err := r.db.Pool().Exec(ctx,
-		"UPDATE users SET first_name=$1, last_name=$2, email=$3 WHERE id=$4",
-		u.FirstName, u.LastName, u.Email, u.ID,
-	)
+// UpdateUser updates an existing user; the version and audit columns are read back into u
+// A changed email address loses its verification (SET expressions see the old row).
+// An empty role keeps the current one.
+// A non-nil ifMatch only updates the user while its version is one of those listed.
+func (r *repository) UpdateUser(ctx context.Context, u *User, ifMatch []int64) error {
+	err := r.db.Pool().QueryRow(ctx,
+		`UPDATE users SET first_name=$1, last_name=$2, email=$3,
+		        email_verified_at = CASE WHEN email = $3 THEN email_verified_at ELSE NULL END,
+		        role_id = COALESCE((SELECT id FROM roles WHERE name = NULLIF($5, '')), role_id),
+		        updated_by=$6
+		 WHERE id=$4 AND deleted_at IS NULL AND ($7::bigint[] IS NULL OR version = ANY($7))
+		 RETURNING `+writtenColumns,
+		u.FirstName, u.LastName, u.Email, u.ID, u.Role, u.UpdatedBy, ifMatch,
+	).Scan(append([]any{&u.Version}, u.Targets()...)...)
 	if err != nil {
+		// No row means nothing was updated
+		if errors.Is(err, pgx.ErrNoRows) {
+			return r.notUpdated(ctx, u.ID, ifMatch)
+		}
 		return err
 	}
 
-	// Check if any row was actually updated
-	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
-	}
-
 	return nil
 }
 
-// DeleteUser deletes a user by ID
-func (r *repository) DeleteUser(ctx context.Context, id string) error {
+// DeleteUser soft deletes a user by ID; the row stays for the audit trail but the user can no longer sign in
+// A non-nil ifMatch only deletes the user while its version is one of those listed.
+func (r *repository) DeleteUser(ctx context.Context, id, deletedBy string, ifMatch []int64) error {
 	result, err := r.db.Pool().Exec(ctx,
-		"DELETE FROM users WHERE id=$1", id,
+		`UPDATE users SET deleted_at = NOW(), deleted_by = NULLIF($2, '')::uuid, updated_by = NULLIF($2, '')::uuid
+		 WHERE id=$1 AND deleted_at IS NULL AND ($3::bigint[] IS NULL OR version = ANY($3))`,
+		id, deletedBy, ifMatch,
 	)
 	if err != nil {
 		return err
@@ -119,8 +131,47 @@ func (r *repository) DeleteUser(ctx context.Context, id string) error {
 
 	// Check if any row was actually deleted
 	if result.RowsAffected() == 0 {
-		return ErrUserNotFound
+		return r.notUpdated(ctx, id, ifMatch)
 	}
 
 	return nil
 }
+
+// notUpdated explains why a write matched no row: the user is gone, or a condition failed
+func (r *repository) notUpdated(ctx context.Context, id string, ifMatch []int64) error {
+	if ifMatch == nil {
+		return ErrUserNotFound
+	}
+
+	var exists bool
+	if err := r.db.Pool().QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id=$1 AND deleted_at IS NULL)", id,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return ErrUserNotFound
+}
+
+// RoleExists reports whether a role with the given name exists
+func (r *repository) RoleExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := r.db.Pool().QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM roles WHERE name=$1)", name,
+	).Scan(&exists)
+	return exists, err
+}
+
+func scanUser(row pgx.Row) (*User, error) {
+	user := &User{}
+	targets := []any{
+		&user.ID, &user.FirstName, &user.LastName, &user.Email,
+		&user.IsActive, &user.IsBlocked, &user.BlockedAt, &user.BlockedBy, &user.EmailVerifiedAt, &user.Role, &user.Version,
+	}
+	if err := row.Scan(append(targets, user.Targets()...)...); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
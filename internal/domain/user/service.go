@@ -1,30 +1,78 @@
 package user
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rest_api_poc/internal/domain/audit"
+	"rest_api_poc/internal/shared/logger"
+
+	"github.com/jackc/pgx/v5"
+)
 
 // Service defines the business logic interface for users
 // All methods accept context for proper cancellation and timeout handling
 type Service interface {
-	CreateUser(ctx context.Context, u *User) error
+	CreateUser(ctx context.Context, actorID string, u *User) error
 	GetUser(ctx context.Context, id string) (*User, error)
 	ListUsers(ctx context.Context) ([]*User, error)
-	UpdateUser(ctx context.Context, u *User) error
-	DeleteUser(ctx context.Context, id string) error
+	UpdateUser(ctx context.Context, actorID string, u *User, ifMatch []int64) error
+	DeleteUser(ctx context.Context, actorID, id string, ifMatch []int64) error
+}
+
+// EmailVerifier interface to avoid circular dependency (implemented by auth.Service)
+type EmailVerifier interface {
+	RequestEmailVerification(ctx context.Context, userID string) error
+}
+
+// AccessController interface to avoid circular dependency (implemented by auth.Service).
+// AuthorizeUserAction applies the owner/admin hierarchy; a non-empty reason means denied.
+type AccessController interface {
+	AuthorizeUserAction(ctx context.Context, actorID, targetID, action, newRole string) (reason string, err error)
+	RefreshUserAccess(ctx context.Context, userID string)
+}
+
+// ForbiddenError is returned when the acting user may not manage the target user
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return "forbidden: " + e.Reason
 }
 
 type service struct {
-	repo Repository
+	repo     Repository
+	verifier EmailVerifier
+	access   AccessController
+	auditor  audit.Recorder
 }
 
-// NewService creates a new user service with repository dependency
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+// NewService creates a new user service with repository dependency.
+// verifier may be nil, in which case email changes are not re-verified by mail.
+// auditor may be nil, in which case changes are not recorded in the audit log.
+func NewService(repo Repository, verifier EmailVerifier, access AccessController, auditor audit.Recorder) Service {
+	return &service{repo: repo, verifier: verifier, access: access, auditor: auditor}
 }
 
-// CreateUser creates a new user
+// CreateUser creates a new user on behalf of actorID
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) CreateUser(ctx context.Context, u *User) error {
-	return s.repo.CreateUser(ctx, u)
+func (s *service) CreateUser(ctx context.Context, actorID string, u *User) error {
+	u.Created(actorID)
+	if err := s.repo.CreateUser(ctx, u); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionUserCreated, u.ID, audit.Diff(nil, u))
+
+	// Accounts created by an admin verify their address like self-registered ones
+	if s.verifier != nil {
+		if err := s.verifier.RequestEmailVerification(ctx, u.ID); err != nil {
+			logger.Error("failed to send verification email for user %s: %v", u.ID, err)
+		}
+	}
+
+	return nil
 }
 
 // GetUser retrieves a user by ID
@@ -39,14 +87,117 @@ func (s *service) ListUsers(ctx context.Context) ([]*User, error) {
 	return s.repo.ListUsers(ctx)
 }
 
-// UpdateUser updates an existing user
+// UpdateUser updates an existing user on behalf of actorID
+// A non-nil ifMatch lists the versions the caller expects; any other fails with ErrVersionMismatch.
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) UpdateUser(ctx context.Context, u *User) error {
-	return s.repo.UpdateUser(ctx, u)
+func (s *service) UpdateUser(ctx context.Context, actorID string, u *User, ifMatch []int64) error {
+	existing, err := s.repo.GetUser(ctx, u.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := s.authorize(ctx, actorID, u.ID, "update", ""); err != nil {
+		return err
+	}
+
+	roleChanged := u.Role != "" && u.Role != existing.Role
+	if roleChanged {
+		exists, err := s.repo.RoleExists(ctx, u.Role)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRoleNotFound
+		}
+		if err := s.authorize(ctx, actorID, u.ID, "change_role", u.Role); err != nil {
+			return err
+		}
+	}
+
+	u.Updated(actorID)
+	if err := s.repo.UpdateUser(ctx, u, ifMatch); err != nil {
+		return err
+	}
+
+	// Diff against the stored row: the update may also clear verification or keep the role
+	after := u
+	if updated, err := s.repo.GetUser(ctx, u.ID); err == nil {
+		after = updated
+	}
+	s.record(ctx, audit.ActionUserUpdated, u.ID, audit.Diff(existing, after))
+
+	// Cached permissions of the old role must not outlive the change
+	if roleChanged && s.access != nil {
+		s.access.RefreshUserAccess(ctx, u.ID)
+	}
+
+	// A new address must be verified again; the update itself already cleared the flag
+	if s.verifier != nil && existing.Email != u.Email {
+		if err := s.verifier.RequestEmailVerification(ctx, u.ID); err != nil {
+			logger.Error("failed to send verification email for user %s: %v", u.ID, err)
+		}
+	}
+
+	return nil
 }
 
-// DeleteUser deletes a user by ID
+// DeleteUser deletes a user by ID on behalf of actorID
+// A non-nil ifMatch lists the versions the caller expects; any other fails with ErrVersionMismatch.
 // Context flows from handler → service → repository for proper cancellation
-func (s *service) DeleteUser(ctx context.Context, id string) error {
-	return s.repo.DeleteUser(ctx, id)
+func (s *service) DeleteUser(ctx context.Context, actorID, id string, ifMatch []int64) error {
+	if err := s.authorize(ctx, actorID, id, "delete", ""); err != nil {
+		return err
+	}
+
+	existing, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if err := s.repo.DeleteUser(ctx, id, actorID, ifMatch); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionUserDeleted, id, audit.Diff(existing, nil))
+
+	// A cached session lookup must not keep a deleted user signed in
+	if s.access != nil {
+		s.access.RefreshUserAccess(ctx, id)
+	}
+	return nil
+}
+
+// authorize applies the user management policy; without an access controller everything is allowed
+func (s *service) authorize(ctx context.Context, actorID, targetID, action, newRole string) error {
+	if s.access == nil {
+		return nil
+	}
+
+	reason, err := s.access.AuthorizeUserAction(ctx, actorID, targetID, action, newRole)
+	if err != nil {
+		return fmt.Errorf("failed to authorize %s: %w", action, err)
+	}
+	if reason != "" {
+		return &ForbiddenError{Reason: reason}
+	}
+	return nil
+}
+
+// record adds a user change to the audit log; the actor is taken from the request context
+func (s *service) record(ctx context.Context, action, id string, changes map[string]audit.Change) {
+	if s.auditor == nil {
+		return
+	}
+	s.auditor.Record(ctx, &audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   id,
+		Changes:    changes,
+	})
 }
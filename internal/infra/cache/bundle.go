@@ -4,12 +4,16 @@ import (
 	"context"
 	"rest_api_poc/internal/domain/auth"
 	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/infra/ratelimit"
 )
 
 // Bundle groups all cache concerns behind a single dependency.
-// Add new sub-caches here over time (e.g. Product, RateLimit, etc).
+// Add new sub-caches here over time (e.g. Product, etc).
 type Bundle struct {
-	Auth auth.AuthCache
+	Auth               auth.AuthCache
+	LoginAttempts      auth.LoginAttemptStore
+	WebAuthnChallenges auth.WebAuthnChallengeStore
+	RateLimit          ratelimit.Store
 
 	closeFn func(ctx context.Context) error
 }
@@ -25,14 +29,20 @@ func NewBundle(cfg *config.CacheConfig) *Bundle {
 	// Default: no caching enabled.
 	if cfg == nil || !cfg.Enable {
 		return &Bundle{
-			Auth:    nil,
-			closeFn: func(context.Context) error { return nil },
+			Auth:               nil,
+			LoginAttempts:      nil,
+			WebAuthnChallenges: nil,
+			RateLimit:          nil,
+			closeFn:            func(context.Context) error { return nil },
 		}
 	}
 
 	rdb, closeFn := NewRedisClient(cfg)
 	return &Bundle{
-		Auth:    NewRedisAuthCache(rdb),
-		closeFn: closeFn,
+		Auth:               NewRedisAuthCache(rdb),
+		LoginAttempts:      NewRedisLoginAttemptStore(rdb),
+		WebAuthnChallenges: NewRedisWebAuthnChallengeStore(rdb),
+		RateLimit:          NewRedisRateLimitStore(rdb),
+		closeFn:            closeFn,
 	}
 }
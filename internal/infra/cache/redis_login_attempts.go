@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"rest_api_poc/internal/domain/auth"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisLoginAttemptStore keeps failed login counters and lockouts in Redis so they are
+// shared across replicas. Keys expire on their own; no cleanup is required.
+type RedisLoginAttemptStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisLoginAttemptStore(rdb *redis.Client) *RedisLoginAttemptStore {
+	return &RedisLoginAttemptStore{rdb: rdb}
+}
+
+func (s *RedisLoginAttemptStore) failuresKey(key string) string { return "auth:attempts:" + key }
+func (s *RedisLoginAttemptStore) lockKey(key string) string     { return "auth:lock:" + key }
+
+func (s *RedisLoginAttemptStore) RegisterFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	pipe := s.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, s.failuresKey(key))
+	// Only the first failure starts the window; later ones must not extend it.
+	pipe.ExpireNX(ctx, s.failuresKey(key), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("register login failure: %w", err)
+	}
+	return int(incr.Val()), nil
+}
+
+func (s *RedisLoginAttemptStore) Get(ctx context.Context, key string) (*auth.LoginAttempts, error) {
+	vals, err := s.rdb.MGet(ctx, s.failuresKey(key), s.lockKey(key)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get login attempts: %w", err)
+	}
+
+	attempts := &auth.LoginAttempts{}
+	if v, ok := vals[0].(string); ok {
+		attempts.Failures, _ = strconv.Atoi(v)
+	}
+	attempts.Locked = vals[1] != nil
+
+	return attempts, nil
+}
+
+func (s *RedisLoginAttemptStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+	return s.rdb.Set(ctx, s.lockKey(key), "1", duration).Err()
+}
+
+func (s *RedisLoginAttemptStore) Clear(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, s.failuresKey(key), s.lockKey(key)).Err()
+}
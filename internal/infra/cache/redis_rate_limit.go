@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"rest_api_poc/internal/infra/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills the bucket by elapsed time, then takes one token if available.
+// Uses the Redis clock so all replicas agree on "now".
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * capacity / window_ms)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window_ms)
+
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript keeps one counter per fixed window and weights the previous one
+// by how much of it still overlaps the rolling window.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local current = math.floor(now / window_ms)
+local cur_key = KEYS[1] .. ':' .. current
+local prev_key = KEYS[1] .. ':' .. (current - 1)
+
+local prev = tonumber(redis.call('GET', prev_key) or '0')
+local cur = tonumber(redis.call('GET', cur_key) or '0')
+local elapsed = now - current * window_ms
+
+local allowed = 0
+if prev * (window_ms - elapsed) / window_ms + cur + 1 <= limit then
+	cur = redis.call('INCR', cur_key)
+	redis.call('PEXPIRE', cur_key, window_ms * 2)
+	allowed = 1
+end
+
+return {allowed, prev, cur, elapsed}
+`)
+
+// RedisRateLimitStore shares rate limit counters across replicas.
+// Keys expire on their own; no cleanup is required.
+type RedisRateLimitStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisRateLimitStore(rdb *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{rdb: rdb}
+}
+
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, limit ratelimit.Limit) (*ratelimit.Result, error) {
+	windowMs := limit.Window.Milliseconds()
+
+	if limit.Algorithm == ratelimit.TokenBucket {
+		vals, err := tokenBucketScript.Run(ctx, s.rdb, []string{"ratelimit:tb:" + key}, limit.Requests, windowMs).Slice()
+		if err != nil {
+			return nil, fmt.Errorf("rate limit token bucket: %w", err)
+		}
+		allowed, _ := vals[0].(int64)
+		tokensStr, _ := vals[1].(string)
+		tokens, err := strconv.ParseFloat(tokensStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit token bucket: invalid token count %q", tokensStr)
+		}
+		return ratelimit.TokenBucketResult(limit, tokens, allowed == 1), nil
+	}
+
+	vals, err := slidingWindowScript.Run(ctx, s.rdb, []string{"ratelimit:sw:" + key}, limit.Requests, windowMs).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("rate limit sliding window: %w", err)
+	}
+	elapsed := time.Duration(vals[3]) * time.Millisecond
+	return ratelimit.SlidingWindowResult(limit, int(vals[1]), int(vals[2]), elapsed, vals[0] == 1), nil
+}
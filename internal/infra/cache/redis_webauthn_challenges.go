@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"rest_api_poc/internal/domain/auth"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisWebAuthnChallengeStore keeps pending passkey ceremonies in Redis so any replica can
+// complete them. Keys expire on their own; GETDEL makes every challenge single-use.
+type RedisWebAuthnChallengeStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisWebAuthnChallengeStore(rdb *redis.Client) *RedisWebAuthnChallengeStore {
+	return &RedisWebAuthnChallengeStore{rdb: rdb}
+}
+
+func (s *RedisWebAuthnChallengeStore) key(challengeHash string) string {
+	return "auth:webauthn:" + challengeHash
+}
+
+func (s *RedisWebAuthnChallengeStore) Save(ctx context.Context, challengeHash string, challenge *auth.WebAuthnChallenge, ttl time.Duration) error {
+	b, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("marshal WebAuthn challenge: %w", err)
+	}
+	return s.rdb.Set(ctx, s.key(challengeHash), b, ttl).Err()
+}
+
+func (s *RedisWebAuthnChallengeStore) Consume(ctx context.Context, challengeHash string) (*auth.WebAuthnChallenge, bool, error) {
+	val, err := s.rdb.GetDel(ctx, s.key(challengeHash)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("consume WebAuthn challenge: %w", err)
+	}
+
+	var challenge auth.WebAuthnChallenge
+	if err := json.Unmarshal([]byte(val), &challenge); err != nil {
+		// A corrupt entry can never be answered; treat as unknown.
+		return nil, false, nil
+	}
+	return &challenge, true, nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/netip"
 	"os"
 	"rest_api_poc/internal/shared/logger"
 	"strconv"
@@ -17,6 +18,12 @@ type WebServerConfig struct {
 	EnableSwagger bool
 	ReadTimeout   time.Duration
 	WriteTimeout  time.Duration
+
+	// RequireIfMatch rejects updates and deletes of versioned resources without an If-Match header (428)
+	RequireIfMatch bool
+
+	// TrustedProxies are the peers whose X-Forwarded-For / X-Real-IP headers are believed
+	TrustedProxies []netip.Prefix
 }
 
 type DBConfig struct {
@@ -33,20 +40,113 @@ type CacheConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret                string
-	JWTIssuer                string
-	Audience                 []string
-	AccessTokenLifetime      time.Duration
-	RefreshTokenLifetime     time.Duration
-	StaySignedInLifetime     time.Duration
-	PasswordResetOTPLifetime time.Duration
+	JWTSecret                 string
+	JWTSigningKeys            []string  // "kid=path" PEM private keys; enables asymmetric signing
+	JWTRetiredKeys            []string  // "kid=path[@retired_at]" verify-only keys kept during rotation
+	JWTSecretRetiredAt        time.Time // when JWT_SIGNING_KEYS replaced JWT_SECRET; zero means process start
+	JWTActiveKeyID            string
+	JWTIssuer                 string
+	JWTEmbedPermissions       bool // add the role's permissions to access tokens for downstream services
+	Audience                  []string
+	AccessTokenLifetime       time.Duration
+	ClientTokenLifetime       time.Duration // access tokens issued by the client credentials grant
+	RefreshTokenLifetime      time.Duration
+	StaySignedInLifetime      time.Duration
+	SessionIdleTimeout        time.Duration // sessions unused for longer are rejected; 0 disables
+	SessionActivityInterval   time.Duration // how often session activity is recorded and written
+	ImpersonationLifetime     time.Duration // impersonation tokens cannot be refreshed; capped at one hour
+	RefreshReuseGracePeriod   time.Duration
+	PasswordResetOTPLifetime  time.Duration
+	MFAIssuer                 string
+	MFAChallengeLifetime      time.Duration
+	LoginMaxFailures          int           // per account, before a temporary lockout
+	LoginIPMaxFailures        int           // per client IP, before a temporary lockout
+	LoginFailureWindow        time.Duration // window in which failures are counted
+	LoginLockoutDuration      time.Duration
+	LoginFailureDelay         time.Duration // base of the progressive delay after repeated failures
+	LoginMaxFailureDelay      time.Duration
+	RequireEmailVerification  bool // refuse logins until the email address is verified
+	EmailVerificationLifetime time.Duration
+	EmailVerificationURL      string // frontend page receiving ?token=...; empty sends the bare token
+	PasswordlessLoginLifetime time.Duration
+	PasswordlessLoginURL      string // frontend page receiving ?token=...; empty sends only the code
+	PasswordlessMaxAttempts   int    // wrong codes before a sign-in code is discarded
+	PasswordHashAlgorithm     string // argon2id or bcrypt; older hashes are upgraded on login
+	BcryptCost                int
+	Argon2Memory              uint32 // KiB
+	Argon2Iterations          uint32
+	Argon2Parallelism         uint8
+	PasswordMinLength         int
+	PasswordMaxBytes          int // bcrypt ignores everything past 72 bytes
+	PasswordRequireUpper      bool
+	PasswordRequireLower      bool
+	PasswordRequireDigit      bool
+	PasswordRequireSymbol     bool
+	PasswordHistorySize       int    // reject the current and last N passwords; 0 disables history
+	BreachedPasswordsDir      string // Pwned Passwords range files (one per SHA-1 prefix); empty disables
+	BreachedPasswordMinCount  int    // breach occurrences required to reject a password
+	OIDCProviders             []OIDCProviderConfig
+	OIDCStateLifetime         time.Duration // time allowed to complete a provider login
+	WebAuthnRPID              string        // domain passkeys are bound to, e.g. example.com
+	WebAuthnRPName            string        // shown by the browser when creating a passkey
+	WebAuthnOrigins           []string      // origins allowed to use passkeys, e.g. https://app.example.com
+	WebAuthnChallengeLifetime time.Duration // time allowed to answer a passkey prompt
+}
+
+// OIDCProviderConfig is an external OpenID Connect provider users can log in with
+type OIDCProviderConfig struct {
+	Name         string // used in URLs, e.g. /v1/auth/oidc/{name}/authorize
+	Issuer       string // discovery document is read from <issuer>/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // callback registered with the provider, usually .../v1/auth/oidc/{name}/callback
+	Scopes       []string
+	AllowSignup  bool // create local accounts for unknown identities with a verified email
+}
+
+type NotificationConfig struct {
+	Driver       string // smtp, file or stdout
+	AppName      string // shown in message bodies
+	From         string
+	FilePath     string // file driver only
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTimeout  time.Duration
+	QueueSize    int
+	Workers      int
+	MaxRetries   int
+	RetryBackoff time.Duration // doubled after every failed attempt
+}
+
+// RateLimitRule allows Requests per Window for a single client key
+type RateLimitRule struct {
+	Requests int
+	Window   time.Duration
+}
+
+type RateLimitConfig struct {
+	Enable    bool
+	Algorithm string        // token_bucket or sliding_window
+	Global    RateLimitRule // per client IP, every route
+	Auth      RateLimitRule // per client IP, public auth endpoints (login, register, reset)
+	User      RateLimitRule // per user/API key, authenticated domain routes
+}
+
+type ProductConfig struct {
+	TrashRetention     time.Duration // deleted products are purged after this long; 0 keeps them forever
+	TrashPurgeInterval time.Duration // how often expired products are purged
 }
 
 type Config struct {
-	WebServer WebServerConfig
-	DB        DBConfig
-	Cache     CacheConfig
-	Auth      AuthConfig
+	WebServer    WebServerConfig
+	DB           DBConfig
+	Cache        CacheConfig
+	Auth         AuthConfig
+	RateLimit    RateLimitConfig
+	Notification NotificationConfig
+	Product      ProductConfig
 }
 
 // -------------------------
@@ -103,6 +203,55 @@ func getEnvAsInt(key string, defaultVal int) int {
 	return val
 }
 
+// getEnvAsList splits a comma-separated variable, dropping empty entries
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvAsPrefixes parses a comma-separated list of IP addresses and CIDR ranges
+func getEnvAsPrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range getEnvAsList(key) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			logger.Fatal("Invalid IP or CIDR %q for env %s", item, key)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// getEnvAsRate parses "<requests>/<window>", e.g. "100/1m"
+func getEnvAsRate(key string, defaultVal RateLimitRule) RateLimitRule {
+	valStr := os.Getenv(key)
+	if valStr == "" {
+		return defaultVal
+	}
+	reqStr, windowStr, ok := strings.Cut(valStr, "/")
+	if !ok {
+		logger.Fatal("Invalid rate for env %s, expected <requests>/<window>", key)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(reqStr))
+	if err != nil || requests <= 0 {
+		logger.Fatal("Invalid request count for env %s: %v", key, err)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowStr))
+	if err != nil || window <= 0 {
+		logger.Fatal("Invalid window for env %s: %v", key, err)
+	}
+	return RateLimitRule{Requests: requests, Window: window}
+}
+
 // -------------------------
 // Subsystem loaders
 // -------------------------
@@ -114,6 +263,9 @@ func loadWebServerConfig() WebServerConfig {
 		EnableSwagger: getEnvAsBool("ENABLE_SWAGGER", true),
 		ReadTimeout:   getEnvAsDuration("READ_TIMEOUT", 5*time.Second),
 		WriteTimeout:  getEnvAsDuration("WRITE_TIMEOUT", 5*time.Second),
+
+		RequireIfMatch: getEnvAsBool("REQUIRE_IF_MATCH", false),
+		TrustedProxies: getEnvAsPrefixes("TRUSTED_PROXIES"),
 	}
 }
 
@@ -141,12 +293,82 @@ func loadCacheConfig() CacheConfig {
 
 func loadAuthConfig() AuthConfig {
 	cfg := AuthConfig{
-		JWTSecret:                mustGetEnv("JWT_SECRET"),
-		JWTIssuer:                getEnv("JWT_ISSUER", "go-rest-api-poc"),
-		AccessTokenLifetime:      getEnvAsDuration("ACCESS_TOKEN_LIFETIME", 15*time.Minute),
-		RefreshTokenLifetime:     getEnvAsDuration("REFRESH_TOKEN_LIFETIME", 168*time.Hour),      // 7 days
-		StaySignedInLifetime:     getEnvAsDuration("STAY_SIGNED_IN_LIFETIME", 720*time.Hour),     // 30 days
-		PasswordResetOTPLifetime: getEnvAsDuration("PASSWORD_RESET_OTP_LIFETIME", 15*time.Minute),
+		JWTSecret:                 mustGetEnv("JWT_SECRET"),
+		JWTIssuer:                 getEnv("JWT_ISSUER", "go-rest-api-poc"),
+		JWTEmbedPermissions:       getEnvAsBool("JWT_EMBED_PERMISSIONS", false),
+		AccessTokenLifetime:       getEnvAsDuration("ACCESS_TOKEN_LIFETIME", 15*time.Minute),
+		ClientTokenLifetime:       getEnvAsDuration("CLIENT_TOKEN_LIFETIME", 10*time.Minute),
+		RefreshTokenLifetime:      getEnvAsDuration("REFRESH_TOKEN_LIFETIME", 168*time.Hour),      // 7 days
+		StaySignedInLifetime:      getEnvAsDuration("STAY_SIGNED_IN_LIFETIME", 720*time.Hour),     // 30 days
+		SessionIdleTimeout:        getEnvAsDuration("SESSION_IDLE_TIMEOUT", 0),
+		SessionActivityInterval:   getEnvAsDuration("SESSION_ACTIVITY_INTERVAL", time.Minute),
+		ImpersonationLifetime:     getEnvAsDuration("IMPERSONATION_LIFETIME", 15*time.Minute),
+		RefreshReuseGracePeriod:   getEnvAsDuration("REFRESH_REUSE_GRACE_PERIOD", 10*time.Second),
+		PasswordResetOTPLifetime:  getEnvAsDuration("PASSWORD_RESET_OTP_LIFETIME", 15*time.Minute),
+		MFAChallengeLifetime:      getEnvAsDuration("MFA_CHALLENGE_LIFETIME", 5*time.Minute),
+		LoginMaxFailures:          getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures:        getEnvAsInt("LOGIN_IP_MAX_FAILURES", 50),
+		LoginFailureWindow:        getEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutDuration:      getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginFailureDelay:         getEnvAsDuration("LOGIN_FAILURE_DELAY", 250*time.Millisecond),
+		LoginMaxFailureDelay:      getEnvAsDuration("LOGIN_MAX_FAILURE_DELAY", 5*time.Second),
+		RequireEmailVerification:  getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+		EmailVerificationLifetime: getEnvAsDuration("EMAIL_VERIFICATION_LIFETIME", 24*time.Hour),
+		EmailVerificationURL:      getEnv("EMAIL_VERIFICATION_URL", ""),
+		PasswordlessLoginLifetime: getEnvAsDuration("PASSWORDLESS_LOGIN_LIFETIME", 15*time.Minute),
+		PasswordlessLoginURL:      getEnv("PASSWORDLESS_LOGIN_URL", ""),
+		PasswordlessMaxAttempts:   getEnvAsInt("PASSWORDLESS_MAX_ATTEMPTS", 5),
+	}
+	cfg.MFAIssuer = getEnv("MFA_ISSUER", cfg.JWTIssuer)
+
+	cfg.PasswordHashAlgorithm = getEnv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	if cfg.PasswordHashAlgorithm != "argon2id" && cfg.PasswordHashAlgorithm != "bcrypt" {
+		logger.Fatal("Invalid PASSWORD_HASH_ALGORITHM %q, expected argon2id or bcrypt", cfg.PasswordHashAlgorithm)
+	}
+	cfg.BcryptCost = getEnvAsInt("BCRYPT_COST", 10)
+	if cfg.BcryptCost < 4 || cfg.BcryptCost > 31 {
+		logger.Fatal("Invalid BCRYPT_COST %d, expected 4-31", cfg.BcryptCost)
+	}
+	argonMemory := getEnvAsInt("ARGON2_MEMORY_KIB", 64*1024)
+	argonIterations := getEnvAsInt("ARGON2_ITERATIONS", 3)
+	argonParallelism := getEnvAsInt("ARGON2_PARALLELISM", 2)
+	if argonMemory < 8*1024 || argonIterations < 1 || argonParallelism < 1 || argonParallelism > 255 {
+		logger.Fatal("Invalid argon2 parameters (memory >= 8192 KiB, iterations >= 1, parallelism 1-255)")
+	}
+	cfg.Argon2Memory = uint32(argonMemory)
+	cfg.Argon2Iterations = uint32(argonIterations)
+	cfg.Argon2Parallelism = uint8(argonParallelism)
+
+	cfg.PasswordMinLength = getEnvAsInt("PASSWORD_MIN_LENGTH", 8)
+	cfg.PasswordMaxBytes = getEnvAsInt("PASSWORD_MAX_BYTES", 72)
+	cfg.PasswordRequireUpper = getEnvAsBool("PASSWORD_REQUIRE_UPPER", true)
+	cfg.PasswordRequireLower = getEnvAsBool("PASSWORD_REQUIRE_LOWER", true)
+	cfg.PasswordRequireDigit = getEnvAsBool("PASSWORD_REQUIRE_DIGIT", true)
+	cfg.PasswordRequireSymbol = getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false)
+	cfg.PasswordHistorySize = getEnvAsInt("PASSWORD_HISTORY_SIZE", 5)
+	cfg.BreachedPasswordsDir = getEnv("BREACHED_PASSWORDS_DIR", "")
+	cfg.BreachedPasswordMinCount = getEnvAsInt("BREACHED_PASSWORD_MIN_COUNT", 1)
+
+	cfg.OIDCProviders = loadOIDCProviders()
+	cfg.OIDCStateLifetime = getEnvAsDuration("OIDC_STATE_LIFETIME", 10*time.Minute)
+
+	cfg.WebAuthnRPID = getEnv("WEBAUTHN_RP_ID", "localhost")
+	cfg.WebAuthnRPName = getEnv("WEBAUTHN_RP_NAME", cfg.MFAIssuer)
+	cfg.WebAuthnOrigins = getEnvAsList("WEBAUTHN_ORIGINS")
+	if len(cfg.WebAuthnOrigins) == 0 {
+		cfg.WebAuthnOrigins = []string{"https://" + cfg.WebAuthnRPID}
+	}
+	cfg.WebAuthnChallengeLifetime = getEnvAsDuration("WEBAUTHN_CHALLENGE_LIFETIME", 5*time.Minute)
+
+	cfg.JWTSigningKeys = getEnvAsList("JWT_SIGNING_KEYS")
+	cfg.JWTRetiredKeys = getEnvAsList("JWT_RETIRED_KEYS")
+	cfg.JWTActiveKeyID = getEnv("JWT_ACTIVE_KEY_ID", "")
+	if retiredAt := getEnv("JWT_SECRET_RETIRED_AT", ""); retiredAt != "" {
+		t, err := time.Parse(time.RFC3339, retiredAt)
+		if err != nil {
+			logger.Fatal("Invalid time for JWT_SECRET_RETIRED_AT, %v", err)
+		}
+		cfg.JWTSecretRetiredAt = t
 	}
 
 	if aud, ok := os.LookupEnv("JWT_AUDIENCE"); ok {
@@ -158,6 +380,80 @@ func loadAuthConfig() AuthConfig {
 	return cfg
 }
 
+// loadOIDCProviders reads OIDC_PROVIDERS (comma-separated names) and the
+// OIDC_<NAME>_* variables of every listed provider
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvAsList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProviderConfig{
+			Name:         strings.ToLower(name),
+			Issuer:       strings.TrimSuffix(mustGetEnv(prefix+"ISSUER"), "/"),
+			ClientID:     mustGetEnv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  mustGetEnv(prefix + "REDIRECT_URL"),
+			Scopes:       getEnvAsList(prefix + "SCOPES"),
+			AllowSignup:  getEnvAsBool(prefix+"ALLOW_SIGNUP", false),
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+func loadNotificationConfig() NotificationConfig {
+	cfg := NotificationConfig{
+		Driver:       getEnv("NOTIFICATION_DRIVER", "stdout"),
+		AppName:      getEnv("NOTIFICATION_APP_NAME", "Axil"),
+		From:         getEnv("NOTIFICATION_FROM", "no-reply@localhost"),
+		QueueSize:    getEnvAsInt("NOTIFICATION_QUEUE_SIZE", 100),
+		Workers:      getEnvAsInt("NOTIFICATION_WORKERS", 2),
+		MaxRetries:   getEnvAsInt("NOTIFICATION_MAX_RETRIES", 3),
+		RetryBackoff: getEnvAsDuration("NOTIFICATION_RETRY_BACKOFF", 2*time.Second),
+	}
+
+	switch cfg.Driver {
+	case "smtp":
+		cfg.SMTPHost = mustGetEnv("SMTP_HOST")
+		cfg.SMTPPort = getEnvAsInt("SMTP_PORT", 587)
+		cfg.SMTPUsername = os.Getenv("SMTP_USERNAME")
+		cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+		cfg.SMTPTimeout = getEnvAsDuration("SMTP_TIMEOUT", 10*time.Second)
+	case "file":
+		cfg.FilePath = getEnv("NOTIFICATION_FILE_PATH", "notifications.log")
+	case "stdout":
+	default:
+		logger.Fatal("Invalid NOTIFICATION_DRIVER %q, expected smtp, file or stdout", cfg.Driver)
+	}
+
+	return cfg
+}
+
+func loadRateLimitConfig() RateLimitConfig {
+	cfg := RateLimitConfig{
+		Enable:    getEnvAsBool("RATE_LIMIT_ENABLE", true),
+		Algorithm: getEnv("RATE_LIMIT_ALGORITHM", "sliding_window"),
+		Global:    getEnvAsRate("RATE_LIMIT_GLOBAL", RateLimitRule{Requests: 600, Window: time.Minute}),
+		Auth:      getEnvAsRate("RATE_LIMIT_AUTH", RateLimitRule{Requests: 20, Window: time.Minute}),
+		User:      getEnvAsRate("RATE_LIMIT_USER", RateLimitRule{Requests: 300, Window: time.Minute}),
+	}
+
+	if cfg.Algorithm != "token_bucket" && cfg.Algorithm != "sliding_window" {
+		logger.Fatal("Invalid RATE_LIMIT_ALGORITHM %q, expected token_bucket or sliding_window", cfg.Algorithm)
+	}
+
+	return cfg
+}
+
+func loadProductConfig() ProductConfig {
+	return ProductConfig{
+		TrashRetention:     getEnvAsDuration("PRODUCT_TRASH_RETENTION", 720*time.Hour), // 30 days
+		TrashPurgeInterval: getEnvAsDuration("PRODUCT_TRASH_PURGE_INTERVAL", time.Hour),
+	}
+}
+
 func LoadConfig() *Config {
 	logger.Info("loading config...")
 
@@ -172,6 +468,9 @@ func LoadConfig() *Config {
 	config.DB = loadDBConfig()
 	config.Cache = loadCacheConfig()
 	config.Auth = loadAuthConfig()
+	config.RateLimit = loadRateLimitConfig()
+	config.Notification = loadNotificationConfig()
+	config.Product = loadProductConfig()
 
 	logger.Info("config is successfully loaded!!!")
 	return config
@@ -0,0 +1,3 @@
+-- Drop MFA tables
+DROP TABLE IF EXISTS mfa_recovery_codes CASCADE;
+DROP TABLE IF EXISTS user_mfa CASCADE;
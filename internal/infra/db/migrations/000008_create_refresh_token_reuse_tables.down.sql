@@ -0,0 +1,3 @@
+-- Drop refresh token reuse detection tables
+DROP TABLE IF EXISTS security_events CASCADE;
+DROP TABLE IF EXISTS user_session_rotated_tokens CASCADE;
@@ -0,0 +1,23 @@
+-- Remember refresh token hashes that were rotated out, so a replay can be detected
+CREATE TABLE IF NOT EXISTS user_session_rotated_tokens (
+    token_hash VARCHAR(255) PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    rotated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create security_events table for suspicious activity (e.g. refresh token reuse)
+CREATE TABLE IF NOT EXISTS security_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID REFERENCES user_sessions(id) ON DELETE SET NULL,
+    event_type VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    details JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_rotated_tokens_session ON user_session_rotated_tokens(session_id);
+CREATE INDEX IF NOT EXISTS idx_security_events_user ON security_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events(event_type, created_at);
@@ -0,0 +1,12 @@
+-- Create login_attempts table for failed attempt counters and lockouts
+-- (used when Redis is disabled; keys look like "account:<email>" or "ip:<address>")
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    window_expires_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create index for cleanup of stale counters
+CREATE INDEX IF NOT EXISTS idx_login_attempts_window ON login_attempts(window_expires_at);
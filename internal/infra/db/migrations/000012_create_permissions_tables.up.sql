@@ -0,0 +1,40 @@
+-- Create permissions table
+CREATE TABLE IF NOT EXISTS permissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create role_permissions join table
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id UUID NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission ON role_permissions(permission_id);
+
+-- Insert default permissions
+INSERT INTO permissions (name, description) VALUES
+    ('products:write', 'Create and update products'),
+    ('products:delete', 'Delete products'),
+    ('users:read', 'List and view users'),
+    ('users:write', 'Create, update and delete users'),
+    ('users:block', 'Block, unblock and unlock users'),
+    ('users:sessions', 'Log out all sessions of a user'),
+    ('users:mfa', 'Reset multi-factor authentication of a user'),
+    ('roles:read', 'List roles and permissions'),
+    ('roles:write', 'Create roles and assign permissions')
+ON CONFLICT (name) DO NOTHING;
+
+-- Grant default permissions, matching the previous role checks
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON
+    r.name = 'owner'
+    OR (r.name = 'admin' AND p.name <> 'roles:write')
+    OR (r.name = 'system' AND p.name IN ('users:block', 'users:sessions', 'users:mfa'))
+ON CONFLICT DO NOTHING;
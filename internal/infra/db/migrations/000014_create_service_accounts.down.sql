@@ -0,0 +1,4 @@
+-- Drop service account support
+DELETE FROM permissions WHERE name = 'service_accounts:manage';
+DROP TABLE IF EXISTS service_account_credentials;
+ALTER TABLE users DROP COLUMN IF EXISTS is_service_account;
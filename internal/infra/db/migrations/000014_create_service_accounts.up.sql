@@ -0,0 +1,30 @@
+-- Service accounts are non-human users that authenticate with client credentials only
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_service_account BOOLEAN NOT NULL DEFAULT false;
+
+-- Create service_account_credentials table (OAuth2 client credentials)
+CREATE TABLE IF NOT EXISTS service_account_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    secret_hash VARCHAR(255) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_service_account_credentials_user_id ON service_account_credentials(user_id);
+
+-- Permission to manage service accounts and their credentials
+INSERT INTO permissions (name, description) VALUES
+    ('service_accounts:manage', 'Create service accounts and manage their client credentials')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON p.name = 'service_accounts:manage'
+WHERE r.name IN ('owner', 'admin')
+ON CONFLICT DO NOTHING;
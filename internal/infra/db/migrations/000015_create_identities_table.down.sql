@@ -0,0 +1,3 @@
+-- Drop external identity tables
+DROP TABLE IF EXISTS oidc_auth_states;
+DROP TABLE IF EXISTS identities;
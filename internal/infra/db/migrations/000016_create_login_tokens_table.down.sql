@@ -0,0 +1,2 @@
+-- Drop login_tokens table
+DROP TABLE IF EXISTS login_tokens;
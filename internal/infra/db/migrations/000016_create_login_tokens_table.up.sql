@@ -0,0 +1,17 @@
+-- Create login_tokens table for passwordless sign-in; same design as password_reset_tokens.
+-- Each token carries a magic link secret (hashed) and a 6-digit code; either signs the user in once.
+-- email pins the address the token was sent to; attempts counts wrong codes.
+CREATE TABLE IF NOT EXISTS login_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(255) NOT NULL UNIQUE,
+    otp VARCHAR(6) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_login_tokens_user ON login_tokens(user_id);
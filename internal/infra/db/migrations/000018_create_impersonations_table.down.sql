@@ -0,0 +1,3 @@
+-- Drop impersonation support
+DELETE FROM permissions WHERE name = 'users:impersonate';
+DROP TABLE IF EXISTS impersonations;
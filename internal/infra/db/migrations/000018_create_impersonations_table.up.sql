@@ -0,0 +1,29 @@
+-- Create impersonations table (support staff acting as another user)
+CREATE TABLE IF NOT EXISTS impersonations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_session_id UUID NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_impersonations_actor ON impersonations(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_impersonations_target ON impersonations(target_id, created_at);
+
+-- Permission to impersonate users
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Act as another user for support purposes')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON p.name = 'users:impersonate'
+WHERE r.name IN ('owner', 'admin')
+ON CONFLICT DO NOTHING;
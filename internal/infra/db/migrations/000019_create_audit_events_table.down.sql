@@ -0,0 +1,3 @@
+-- Drop audit log
+DELETE FROM permissions WHERE name = 'audit:read';
+DROP TABLE IF EXISTS audit_events;
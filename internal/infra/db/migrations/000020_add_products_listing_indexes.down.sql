@@ -0,0 +1,4 @@
+-- Drop product listing indexes
+DROP INDEX IF EXISTS idx_products_price_id;
+DROP INDEX IF EXISTS idx_products_name_id;
+DROP INDEX IF EXISTS idx_products_created_at_id;
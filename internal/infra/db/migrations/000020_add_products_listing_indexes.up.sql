@@ -0,0 +1,5 @@
+-- Composite indexes for keyset pagination of the product listing
+-- Every sort is tie-broken by id, so the index must cover (sort column, id)
+CREATE INDEX IF NOT EXISTS idx_products_created_at_id ON products(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_products_name_id ON products(name, id);
+CREATE INDEX IF NOT EXISTS idx_products_price_id ON products(price, id);
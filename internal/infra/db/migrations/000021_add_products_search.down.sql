@@ -0,0 +1,4 @@
+-- Drop product search (the pg_trgm extension is left installed)
+DROP INDEX IF EXISTS idx_products_name_trgm;
+DROP INDEX IF EXISTS idx_products_search_vector;
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,12 @@
+-- Full-text and fuzzy search for products
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Generated column: Postgres computes it for every existing row while adding it (the backfill)
+-- and keeps it current on every insert and update
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', coalesce(name, ''))) STORED;
+
+-- Create indexes for performance
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
@@ -0,0 +1,3 @@
+-- Drop product trash support
+DROP INDEX IF EXISTS idx_products_trash;
+DELETE FROM permissions WHERE name = 'products:trash';
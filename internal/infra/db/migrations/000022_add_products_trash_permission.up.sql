@@ -0,0 +1,14 @@
+-- Products are soft deleted; managing the trash is an admin task
+INSERT INTO permissions (name, description) VALUES
+    ('products:trash', 'List, restore and permanently delete deleted products')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON p.name = 'products:trash'
+WHERE r.name IN ('owner', 'admin')
+ON CONFLICT DO NOTHING;
+
+-- Trash listing and the scheduled purge look up deleted rows only
+CREATE INDEX IF NOT EXISTS idx_products_trash ON products(deleted_at, id) WHERE deleted_at IS NOT NULL;
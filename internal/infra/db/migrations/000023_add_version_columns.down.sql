@@ -0,0 +1,7 @@
+-- Drop row versions
+DROP TRIGGER IF EXISTS increment_products_version ON products;
+DROP TRIGGER IF EXISTS increment_users_version ON users;
+DROP FUNCTION IF EXISTS increment_version_column();
+
+ALTER TABLE products DROP COLUMN IF EXISTS version;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,18 @@
+-- Row versions for optimistic concurrency; exposed to clients as ETags
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- Every change to a row bumps its version, so an ETag never outlives the representation it describes
+CREATE OR REPLACE FUNCTION increment_version_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.version = OLD.version + 1;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER increment_users_version BEFORE UPDATE ON users
+FOR EACH ROW EXECUTE FUNCTION increment_version_column();
+
+CREATE TRIGGER increment_products_version BEFORE UPDATE ON products
+FOR EACH ROW EXECUTE FUNCTION increment_version_column();
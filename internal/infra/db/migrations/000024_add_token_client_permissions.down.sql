@@ -0,0 +1,2 @@
+-- Drop the token client permissions
+DELETE FROM permissions WHERE name IN ('tokens:introspect', 'tokens:revoke');
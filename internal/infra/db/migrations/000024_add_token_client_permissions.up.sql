@@ -0,0 +1,13 @@
+-- Introspecting and revoking other principals' tokens must be granted to a client credential explicitly
+INSERT INTO permissions (name, description) VALUES
+    ('tokens:introspect', 'Introspect access and refresh tokens with client credentials'),
+    ('tokens:revoke', 'Revoke access and refresh tokens with client credentials')
+ON CONFLICT (name) DO NOTHING;
+
+-- Service accounts default to the system role and cannot hold privileged roles
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON p.name IN ('tokens:introspect', 'tokens:revoke')
+WHERE r.name IN ('owner', 'admin', 'system')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Restore global email uniqueness; fails while a deleted and a live user share an address
+DROP INDEX IF EXISTS idx_users_email;
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email) WHERE deleted_at IS NULL;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
@@ -0,0 +1,8 @@
+-- Bump the version and updated_at of users on every update again
+DROP TRIGGER IF EXISTS increment_users_version ON users;
+CREATE TRIGGER increment_users_version BEFORE UPDATE ON users
+FOR EACH ROW EXECUTE FUNCTION increment_version_column();
+
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
+FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
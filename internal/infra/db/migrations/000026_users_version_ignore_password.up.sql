@@ -0,0 +1,11 @@
+-- Rehashing a password changes nothing a client can see, so it keeps the version (and ETag)
+-- and updated_at. Any other column change still bumps both.
+DROP TRIGGER IF EXISTS increment_users_version ON users;
+CREATE TRIGGER increment_users_version BEFORE UPDATE ON users
+FOR EACH ROW WHEN ((to_jsonb(OLD) - 'password') IS DISTINCT FROM (to_jsonb(NEW) - 'password'))
+EXECUTE FUNCTION increment_version_column();
+
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
+FOR EACH ROW WHEN ((to_jsonb(OLD) - 'password') IS DISTINCT FROM (to_jsonb(NEW) - 'password'))
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,197 @@
+// Package query builds the dynamic parts of list queries: filters, sorting and keyset pagination.
+//
+// Lists are paginated with opaque cursors instead of OFFSET, so a page costs the same no matter
+// how deep the client is and rows inserted concurrently never shift or duplicate results.
+// Every sort is made unique by adding the id column as a tie-breaker.
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor cannot be decoded or belongs to another sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort is returned for a sort the list does not support
+	ErrInvalidSort = errors.New("invalid sort")
+)
+
+// SortField is a column a list may be ordered by
+type SortField struct {
+	Name   string // public name used in ?sort=
+	Column string // SQL expression
+	Type   string // Postgres type cursor values are cast to
+}
+
+// Sort is the requested order of a list
+type Sort struct {
+	Field SortField
+	Desc  bool
+}
+
+// String returns the public form of the sort, e.g. "-price"
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field.Name
+	}
+	return s.Field.Name
+}
+
+// ParseSort resolves "name" (ascending) or "-name" (descending) against the supported fields.
+// An empty value returns def.
+func ParseSort(raw string, fields []SortField, def Sort) (Sort, error) {
+	if raw == "" {
+		return def, nil
+	}
+
+	desc := strings.HasPrefix(raw, "-")
+	name := strings.TrimPrefix(raw, "-")
+	for _, f := range fields {
+		if f.Name == name {
+			return Sort{Field: f, Desc: desc}, nil
+		}
+	}
+	return Sort{}, ErrInvalidSort
+}
+
+// ClampLimit applies the default and maximum page size
+func ClampLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultLimit
+	case limit > MaxLimit:
+		return MaxLimit
+	}
+	return limit
+}
+
+// Cursor points just past the last row of a page
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Encode returns the opaque form handed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor and checks it was issued for the same sort
+func DecodeCursor(raw string, sort Sort) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort.String() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Page is one page of a list
+// NextCursor is empty on the last page; Total is only set when the client asked for it.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// Builder collects WHERE conditions and their positional arguments.
+// Conditions use ? placeholders, which are numbered in the order they are added.
+type Builder struct {
+	conds []string
+	args  []any
+}
+
+// New creates an empty builder
+func New() *Builder {
+	return &Builder{}
+}
+
+// Where adds a condition; each ? in cond consumes one of args
+func (b *Builder) Where(cond string, args ...any) *Builder {
+	var sb strings.Builder
+	next := 0
+	for _, r := range cond {
+		if r == '?' && next < len(args) {
+			b.args = append(b.args, args[next])
+			next++
+			fmt.Fprintf(&sb, "$%d", len(b.args))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	b.conds = append(b.conds, sb.String())
+	return b
+}
+
+// After restricts the rows to those following the cursor in the given order
+func (b *Builder) After(sort Sort, idColumn string, c *Cursor) *Builder {
+	if c == nil {
+		return b
+	}
+	op := ">"
+	if sort.Desc {
+		op = "<"
+	}
+	return b.Where(fmt.Sprintf("(%s, %s) %s (?::%s, ?)", sort.Field.Column, idColumn, op, sort.Field.Type), c.Value, c.ID)
+}
+
+// WhereClause returns the collected conditions, or "" when there are none
+func (b *Builder) WhereClause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// Args returns the positional arguments of the collected conditions
+func (b *Builder) Args() []any {
+	return b.args
+}
+
+// OrderLimit returns the ORDER BY and LIMIT clauses for a page.
+// It asks for one row more than limit so the caller can tell whether another page follows.
+// limit must already be clamped; it is inlined, not passed as an argument.
+func OrderLimit(sort Sort, idColumn string, limit int) string {
+	dir := "ASC"
+	if sort.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %d", sort.Field.Column, dir, idColumn, dir, limit+1)
+}
+
+// EscapeLike escapes LIKE wildcards so user input matches literally
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Paginate trims the extra row fetched by OrderLimit and builds the next cursor from the last row kept
+func Paginate[T any](rows []T, limit int, sort Sort, cursorOf func(T) (value, id string)) *Page[T] {
+	page := &Page[T]{Data: rows}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	if len(rows) > limit {
+		page.Data = rows[:limit]
+		value, id := cursorOf(page.Data[limit-1])
+		page.NextCursor = Cursor{Sort: sort.String(), Value: value, ID: id}.Encode()
+	}
+	return page
+}
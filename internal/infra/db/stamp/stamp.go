@@ -0,0 +1,61 @@
+// Package stamp handles the standard audit columns shared by entity tables:
+// created_by/created_at, updated_by/updated_at and deleted_by/deleted_at.
+//
+// Entities embed Columns. Services stamp the acting user with Created/Updated before writing,
+// and repositories read and return the columns with Select and Targets, so every table
+// reads and writes them the same way. The *_at columns are set by the database
+// (defaults and the update_updated_at_column trigger), never by Go code.
+package stamp
+
+import (
+	"strings"
+	"time"
+)
+
+// Columns is embedded by entities backed by a table with the standard audit columns
+type Columns struct {
+	CreatedBy *string    `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedBy *string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedBy *string    `json:"deleted_by,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+var names = []string{"created_by", "created_at", "updated_by", "updated_at", "deleted_by", "deleted_at"}
+
+// Created records actorID as creator and last editor; an empty actorID (system action) clears both
+func (c *Columns) Created(actorID string) {
+	c.CreatedBy = actor(actorID)
+	c.UpdatedBy = actor(actorID)
+}
+
+// Updated records actorID as the last editor
+func (c *Columns) Updated(actorID string) {
+	c.UpdatedBy = actor(actorID)
+}
+
+// Targets returns scan destinations in the order of Select
+func (c *Columns) Targets() []any {
+	return []any{&c.CreatedBy, &c.CreatedAt, &c.UpdatedBy, &c.UpdatedAt, &c.DeletedBy, &c.DeletedAt}
+}
+
+// Select lists the audit columns, qualified with a table alias when one is given
+func Select(alias string) string {
+	if alias == "" {
+		return strings.Join(names, ", ")
+	}
+
+	cols := make([]string, len(names))
+	for i, name := range names {
+		cols[i] = alias + "." + name
+	}
+	return strings.Join(cols, ", ")
+}
+
+func actor(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
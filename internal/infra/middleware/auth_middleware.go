@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"rest_api_poc/internal/domain/auth"
 	"rest_api_poc/internal/infra/config"
@@ -15,26 +16,33 @@ import (
 type AuthMiddleware struct {
 	jwtService *auth.JWTService
 	repo       *auth.Repository
-	cache      auth.AuthCache
-	cacheTTL   time.Duration
+	verifier   *auth.AccessVerifier
+	activity   *auth.SessionActivity
 }
 
-func NewAuthMiddleware(jwtService *auth.JWTService, repo *auth.Repository, cache auth.AuthCache, cfg *config.Config) *AuthMiddleware {
-	ttl := time.Hour
-	if cfg != nil && cfg.Cache.TTL > 0 {
+// NewAuthMiddleware creates the middleware; activity may be nil, which disables session activity tracking
+func NewAuthMiddleware(jwtService *auth.JWTService, repo *auth.Repository, cache auth.AuthCache, activity *auth.SessionActivity, cfg *config.Config) *AuthMiddleware {
+	var ttl time.Duration
+	if cfg != nil {
 		ttl = cfg.Cache.TTL
 	}
 	return &AuthMiddleware{
 		jwtService: jwtService,
 		repo:       repo,
-		cache:      cache,
-		cacheTTL:   ttl,
+		verifier:   auth.NewAccessVerifier(repo, cache, ttl, activity),
+		activity:   activity,
 	}
 }
 
-// Authenticate validates JWT and attaches user context to request
+// Authenticate validates a JWT or API key and attaches user context to request
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Machine clients send an API key instead of a JWT
+		if apiKey := extractAPIKey(r); apiKey != "" {
+			m.authenticateAPIKey(w, r, next, apiKey)
+			return
+		}
+
 		// Extract token from cookie or Authorization header
 		token := m.extractToken(r)
 		if token == "" {
@@ -53,129 +61,117 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		now := time.Now()
-
-		// Verify session is active
-		var sessionUserID string
-		var sessionExpiresAt time.Time
-		if m.cache != nil {
-			if cs, ok, err := m.cache.GetSession(r.Context(), claims.SessionID); err != nil {
-				logger.Warn("auth cache session get failed: %v", err)
-			} else if ok && cs != nil {
-				if !cs.IsActive || (!cs.ExpiresAt.IsZero() && now.After(cs.ExpiresAt)) {
-					// Best-effort cleanup
-					_ = m.cache.DelSession(r.Context(), claims.SessionID)
-					httpUtils.WriteError(w, r, appError.Authentication("Invalid session", nil))
-					return
-				}
-				sessionUserID = cs.UserID
-				sessionExpiresAt = cs.ExpiresAt
-			}
-		}
-		if sessionUserID == "" {
-			session, err := m.repo.GetSessionByID(r.Context(), claims.SessionID)
-			if err != nil {
-				httpUtils.WriteError(w, r, appError.Authentication("Invalid session", err))
-				return
-			}
-			if !session.IsActive || now.After(session.ExpiresAt) {
-				httpUtils.WriteError(w, r, appError.Authentication("Invalid session", nil))
-				return
-			}
-			sessionUserID = session.UserID
-			sessionExpiresAt = session.ExpiresAt
-
-			// Populate cache (best-effort)
-			if m.cache != nil {
-				ttl := m.cacheTTL
-				if !sessionExpiresAt.IsZero() {
-					if until := time.Until(sessionExpiresAt); until > 0 && until < ttl {
-						ttl = until
-					}
-				}
-				_ = m.cache.SetSession(r.Context(), claims.SessionID, &auth.CachedSession{
-					UserID:    session.UserID,
-					IsActive:  session.IsActive,
-					ExpiresAt: session.ExpiresAt,
-				}, ttl)
-			}
-		}
-
-		// Verify user is not blocked
-		// Session and token must agree on user id.
-		if sessionUserID != "" && sessionUserID != claims.UserID {
-			httpUtils.WriteError(w, r, appError.Authentication("Invalid authentication token", nil))
+		user, err := m.verifier.VerifyAccessToken(r.Context(), claims)
+		if err != nil {
+			httpUtils.WriteError(w, r, verificationError(err))
 			return
 		}
 
-		var userEmail, userRole string
-		var userIsActive, userIsBlocked bool
-		foundUser := false
-		if m.cache != nil {
-			if cu, ok, err := m.cache.GetUser(r.Context(), claims.UserID); err != nil {
-				logger.Warn("auth cache user get failed: %v", err)
-			} else if ok && cu != nil {
-				userEmail = cu.Email
-				userRole = cu.Role
-				userIsActive = cu.IsActive
-				userIsBlocked = cu.IsBlocked
-				foundUser = true
-			}
-		}
-		if !foundUser {
-			user, err := m.repo.GetUserByID(r.Context(), claims.UserID)
-			if err != nil {
-				// Avoid user enumeration; treat as invalid auth.
-				httpUtils.WriteError(w, r, appError.Authentication("Invalid authentication token", err))
-				return
-			}
-			userEmail = user.Email
-			userRole = user.Role
-			userIsActive = user.IsActive
-			userIsBlocked = user.IsBlocked
-			foundUser = true
-
-			// Populate cache (best-effort)
-			if m.cache != nil {
-				_ = m.cache.SetUser(r.Context(), claims.UserID, &auth.CachedUser{
-					Email:     user.Email,
-					Role:      user.Role,
-					IsActive:  user.IsActive,
-					IsBlocked: user.IsBlocked,
-				}, m.cacheTTL)
-			}
-		}
-		if !userIsActive || userIsBlocked {
-			httpUtils.WriteError(w, r, appError.Authorization("User account is blocked or inactive", nil))
-			return
+		// Throttled and written in batches, so this costs no DB write per request
+		if m.activity != nil && claims.SessionID != "" {
+			m.activity.Touch(claims.SessionID)
 		}
 
 		// Attach user context to request
+		// Permissions always come from the database/cache, never from the token, so revocations apply immediately
 		userCtx := &auth.UserContext{
-			ID:        claims.UserID,
-			Email:     userEmail,
-			Role:      userRole,
-			SessionID: claims.SessionID,
+			ID:          claims.UserID,
+			Email:       user.Email,
+			Role:        user.Role,
+			Permissions: user.Permissions,
+			SessionID:   claims.SessionID,
 		}
+		// Service account tokens are limited to the scopes granted to their client
+		if claims.ClientID != "" {
+			userCtx.Permissions = auth.ScopedPermissions(user.Permissions, claims.Scopes)
+			userCtx.ClientID = claims.ClientID
+		}
+		if claims.ImpersonationID != "" {
+			userCtx.ImpersonatorID = claims.ImpersonatorID
+			userCtx.ImpersonationID = claims.ImpersonationID
+		}
+		m.serveAuthenticated(w, r, next, userCtx)
+	})
+}
+
+// authenticateAPIKey authenticates a machine client by its personal API key.
+// The key acts as its owner, limited to the permissions in the key's scopes.
+func (m *AuthMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, rawKey string) {
+	key, err := m.repo.GetActiveAPIKeyByHash(r.Context(), auth.HashToken(rawKey))
+	if err != nil {
+		httpUtils.WriteError(w, r, appError.Authentication("Invalid API key", err))
+		return
+	}
 
-		ctx := context.WithValue(r.Context(), auth.UserContextKey, userCtx)
-		// Also set a shared minimal user context for httpUtils logging/extraction (decoupled from domain packages).
-		ctx = context.WithValue(ctx, httpUtils.UserContextKey, &httpUtils.UserContext{
-			ID:        userCtx.ID,
-			SessionID: userCtx.SessionID,
-		})
-		next.ServeHTTP(w, r.WithContext(ctx))
+	user, err := m.verifier.LoadUser(r.Context(), key.UserID)
+	if err != nil {
+		httpUtils.WriteError(w, r, verificationError(err))
+		return
+	}
+
+	// Best-effort; a missed update only makes last_used_at slightly stale
+	if err := m.repo.TouchAPIKey(r.Context(), key.ID, apiKeyTouchInterval); err != nil {
+		logger.Warn("failed to record API key use: %v", err)
+	}
+
+	m.serveAuthenticated(w, r, next, &auth.UserContext{
+		ID:          key.UserID,
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: auth.ScopedPermissions(user.Permissions, key.Scopes),
+		APIKeyID:    key.ID,
 	})
 }
 
-// extractToken extracts JWT from cookie or Authorization header
-func (m *AuthMiddleware) extractToken(r *http.Request) string {
-	// Try cookie first (preferred for browsers)
-	cookie, err := r.Cookie("access_token")
-	if err == nil && cookie.Value != "" {
-		return cookie.Value
+// apiKeyTouchInterval limits how often last_used_at is written per key
+const apiKeyTouchInterval = time.Minute
+
+// verificationError turns AccessVerifier refusals into client errors
+func verificationError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUserBlocked):
+		return appError.Authorization("User account is blocked or inactive", err)
+	case errors.Is(err, auth.ErrSessionNotFound), errors.Is(err, auth.ErrSessionInactive), errors.Is(err, auth.ErrSessionExpired), errors.Is(err, auth.ErrSessionIdle):
+		return appError.Authentication("Invalid session", err)
+	case auth.IsAccessRevoked(err):
+		// Avoid user enumeration; treat as invalid auth.
+		return appError.Authentication("Invalid authentication token", err)
 	}
+	return appError.Internal(err)
+}
+
+// serveAuthenticated attaches the user context to the request and calls the next handler
+func (m *AuthMiddleware) serveAuthenticated(w http.ResponseWriter, r *http.Request, next http.Handler, userCtx *auth.UserContext) {
+	ctx := context.WithValue(r.Context(), auth.UserContextKey, userCtx)
+	// Also set a shared minimal user context for httpUtils logging/extraction (decoupled from domain packages).
+	ctx = context.WithValue(ctx, httpUtils.UserContextKey, &httpUtils.UserContext{
+		ID:             userCtx.ID,
+		SessionID:      userCtx.SessionID,
+		ImpersonatorID: userCtx.ImpersonatorID,
+	})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireSession rejects requests authenticated with an API key or a client credentials token.
+// Used for account and credential management that must stay behind an interactive login.
+func (m *AuthMiddleware) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userCtx := getUserContext(r)
+		if userCtx == nil {
+			httpUtils.WriteError(w, r, appError.Authentication("Unauthorized", nil))
+			return
+		}
+		if userCtx.SessionID == "" {
+			httpUtils.WriteError(w, r, appError.Authorization("This endpoint requires an interactive login", nil))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
+// extractToken extracts JWT from Authorization header or cookie.
+// An explicit header wins, so a signed-in browser can still send an impersonation token.
+func (m *AuthMiddleware) extractToken(r *http.Request) string {
 	// Try Authorization header (for API clients like Postman)
 	authHeader := r.Header.Get("Authorization")
 	if authHeader != "" {
@@ -186,5 +182,11 @@ func (m *AuthMiddleware) extractToken(r *http.Request) string {
 		}
 	}
 
+	// Fall back to the cookie (preferred for browsers)
+	cookie, err := r.Cookie("access_token")
+	if err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
 	return ""
 }
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"rest_api_poc/internal/domain/auth"
+	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/infra/ratelimit"
+	"rest_api_poc/internal/shared/appError"
+	"rest_api_poc/internal/shared/httpUtils"
+	"rest_api_poc/internal/shared/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyFunc derives the client key a request is counted against
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP counts requests per client IP (host only, forwarding headers only from trusted proxies)
+func KeyByIP(r *http.Request) string {
+	return "ip:" + httpUtils.ClientIP(r)
+}
+
+// KeyByUser counts requests per authenticated user, falling back to API key and then IP
+func KeyByUser(r *http.Request) string {
+	if userCtx := getUserContext(r); userCtx != nil {
+		return "user:" + userCtx.ID
+	}
+	return KeyByAPIKey(r)
+}
+
+// KeyByAPIKey counts requests per API key (hashed, never stored raw), falling back to IP
+func KeyByAPIKey(r *http.Request) string {
+	if key := extractAPIKey(r); key != "" {
+		return "apikey:" + auth.HashToken(key)
+	}
+	return KeyByIP(r)
+}
+
+// extractAPIKey reads the key from X-API-Key or "Authorization: ApiKey <key>"
+func extractAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	if scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+type RateLimiter struct {
+	store     ratelimit.Store
+	cfg       config.RateLimitConfig
+	algorithm ratelimit.Algorithm
+}
+
+// NewRateLimiter creates a rate limiter on the given store.
+// A nil store (cache disabled) falls back to per-process memory.
+func NewRateLimiter(store ratelimit.Store, cfg *config.Config) *RateLimiter {
+	if store == nil {
+		store = ratelimit.NewMemoryStore()
+	}
+	return &RateLimiter{
+		store:     store,
+		cfg:       cfg.RateLimit,
+		algorithm: ratelimit.Algorithm(cfg.RateLimit.Algorithm),
+	}
+}
+
+// Global limits every request per client IP
+func (m *RateLimiter) Global() func(http.Handler) http.Handler {
+	return m.Limit("global", m.cfg.Global, KeyByIP)
+}
+
+// Auth limits public authentication endpoints per client IP
+func (m *RateLimiter) Auth() func(http.Handler) http.Handler {
+	return m.Limit("auth", m.cfg.Auth, KeyByIP)
+}
+
+// User limits authenticated API routes per user (or API key)
+func (m *RateLimiter) User() func(http.Handler) http.Handler {
+	return m.Limit("user", m.cfg.User, KeyByUser)
+}
+
+// Limit creates a middleware enforcing rule per key.
+// scope namespaces the counters so the same client has independent budgets per policy.
+func (m *RateLimiter) Limit(scope string, rule config.RateLimitRule, keyFn KeyFunc) func(http.Handler) http.Handler {
+	limit := ratelimit.Limit{
+		Algorithm: m.algorithm,
+		Requests:  rule.Requests,
+		Window:    rule.Window,
+	}
+	policy := fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		if !m.cfg.Enable || limit.Requests <= 0 || limit.Window <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := scope + ":" + keyFn(r)
+
+			res, err := m.store.Allow(r.Context(), key, limit)
+			if err != nil {
+				// Fail open: a Redis hiccup must not take the whole API down
+				logger.Warn("rate limit check failed for %s: %v", key, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+			if !res.Allowed {
+				retryAfter := ceilSeconds(res.RetryAfter)
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				httpUtils.WriteError(w, r, appError.RateLimited("Too many requests, please try again later", nil))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
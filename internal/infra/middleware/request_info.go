@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"rest_api_poc/internal/shared/httpUtils"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestInfo stores the client IP, user agent and request ID in the request context,
+// so services that only receive a context can still attribute what they record.
+// Forwarding headers only count when the direct peer is one of trustedProxies.
+// Must run after chi's RequestID middleware.
+func RequestInfo(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := &httpUtils.RequestInfo{
+				IPAddress: httpUtils.ResolveClientIP(r, trustedProxies),
+				UserAgent: r.UserAgent(),
+				RequestID: chimw.GetReqID(r.Context()),
+			}
+			ctx := context.WithValue(r.Context(), httpUtils.RequestInfoKey, info)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 )
 
 // RequestLogger logs one line per request with request_id, latency, status, and optional user context.
+// Impersonated requests also name the real actor in impersonator_id.
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -17,20 +18,24 @@ func RequestLogger(next http.Handler) http.Handler {
 
 		next.ServeHTTP(ww, r)
 
-		userID, sessionID := func() (string, string) {
+		userID, sessionID, impersonatorID := func() (string, string, string) {
 			if ctx := r.Context().Value(httpUtils.UserContextKey); ctx != nil {
 				if userCtx, ok := ctx.(*httpUtils.UserContext); ok {
-					return userCtx.ID, userCtx.SessionID
+					impersonatorID := userCtx.ImpersonatorID
+					if impersonatorID == "" {
+						impersonatorID = "none"
+					}
+					return userCtx.ID, userCtx.SessionID, impersonatorID
 				}
 			}
-			return "anonymous", "none"
+			return "anonymous", "none", "none"
 		}()
 
 		reqID := chimw.GetReqID(r.Context())
 		dur := time.Since(start)
 
 		logger.Info(
-			"request completed method=%s path=%s status=%d bytes=%d duration_ms=%d request_id=%s user_id=%s session_id=%s",
+			"request completed method=%s path=%s status=%d bytes=%d duration_ms=%d request_id=%s user_id=%s session_id=%s impersonator_id=%s",
 			r.Method,
 			r.URL.Path,
 			ww.Status(),
@@ -39,6 +44,7 @@ func RequestLogger(next http.Handler) http.Handler {
 			reqID,
 			userID,
 			sessionID,
+			impersonatorID,
 		)
 	})
 }
@@ -43,14 +43,26 @@ func (m *RoleMiddleware) RequireRole(allowedRoles ...string) func(http.Handler)
 	}
 }
 
-// RequireAdmin is a convenience middleware for admin-only routes
-func (m *RoleMiddleware) RequireAdmin(next http.Handler) http.Handler {
-	return m.RequireRole("owner", "admin")(next)
-}
+// RequirePermission creates a middleware that checks if user's role grants every listed permission
+func (m *RoleMiddleware) RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userCtx := getUserContext(r)
+			if userCtx == nil {
+				httpUtils.WriteError(w, r, appError.Authentication("Unauthorized", nil))
+				return
+			}
+
+			for _, permission := range permissions {
+				if !userCtx.HasPermission(permission) {
+					httpUtils.WriteError(w, r, appError.Authorization("Insufficient permissions", nil))
+					return
+				}
+			}
 
-// RequireOwner is a convenience middleware for owner-only routes
-func (m *RoleMiddleware) RequireOwner(next http.Handler) http.Handler {
-	return m.RequireRole("owner")(next)
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 // getUserContext extracts user context from request
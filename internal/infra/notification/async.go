@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/shared/logger"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull       = errors.New("notification queue is full")
+	ErrNotifierStopped = errors.New("notifier is stopped")
+)
+
+// AsyncNotifier queues messages and delivers them from background workers with retries,
+// so a slow or unavailable mail server never blocks a request.
+type AsyncNotifier struct {
+	next       Notifier
+	queue      chan *Message
+	maxRetries int
+	backoff    time.Duration
+
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+	ctx     context.Context
+}
+
+func NewAsyncNotifier(next Notifier, cfg *config.NotificationConfig) *AsyncNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n := &AsyncNotifier{
+		next:       next,
+		queue:      make(chan *Message, cfg.QueueSize),
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.RetryBackoff,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		n.wg.Add(1)
+		go n.worker()
+	}
+
+	return n
+}
+
+// Send enqueues msg and returns immediately.
+// ctx only bounds the enqueue; delivery outlives the request that triggered it.
+func (n *AsyncNotifier) Send(ctx context.Context, msg *Message) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.stopped {
+		return ErrNotifierStopped
+	}
+
+	select {
+	case n.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for queued ones to be delivered.
+// Once ctx is done, pending retries are abandoned.
+func (n *AsyncNotifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.stopped {
+		n.stopped = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		return ctx.Err()
+	}
+}
+
+func (n *AsyncNotifier) worker() {
+	defer n.wg.Done()
+
+	for msg := range n.queue {
+		n.deliver(msg)
+	}
+}
+
+// deliver tries the message up to maxRetries+1 times with exponential backoff
+func (n *AsyncNotifier) deliver(msg *Message) {
+	delay := n.backoff
+
+	for attempt := 0; ; attempt++ {
+		err := n.next.Send(n.ctx, msg)
+		if err == nil {
+			return
+		}
+
+		if attempt >= n.maxRetries || n.ctx.Err() != nil {
+			logger.Error("Failed to deliver notification %q to %s after %d attempts: %v", msg.Subject, msg.To, attempt+1, err)
+			return
+		}
+
+		logger.Warn("Notification delivery to %s failed (attempt %d), retrying in %v: %v", msg.To, attempt+1, delay, err)
+
+		select {
+		case <-n.ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
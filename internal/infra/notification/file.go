@@ -0,0 +1,53 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileNotifier writes messages to a file (or stdout) instead of sending them.
+// Meant for local development: OTPs and links show up without a mail server.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileNotifier appends messages to path; an empty path writes to stdout
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Send(ctx context.Context, msg *Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var w io.Writer = os.Stdout
+	if n.path != "" {
+		f, err := os.OpenFile(n.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open notification file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	separator := strings.Repeat("=", 60)
+	_, err := fmt.Fprintf(w, "%s\nDate:    %s\nTo:      %s\nSubject: %s\n\n%s\n%s\n",
+		separator,
+		time.Now().Format(time.RFC1123Z),
+		msg.To,
+		msg.Subject,
+		strings.TrimSpace(msg.Text),
+		separator,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+
+	return nil
+}
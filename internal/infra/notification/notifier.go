@@ -0,0 +1,40 @@
+package notification
+
+import (
+	"context"
+	"rest_api_poc/internal/infra/config"
+	"rest_api_poc/internal/shared/logger"
+)
+
+// Message is a rendered notification ready for delivery
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Notifier delivers messages to users.
+// Implementations: SMTPNotifier (production), FileNotifier (dev, file or stdout) and
+// AsyncNotifier, which wraps either with a queue and retries.
+type Notifier interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New builds the configured transport wrapped in an AsyncNotifier.
+// The caller owns the returned notifier and must Close it on shutdown to flush the queue.
+func New(cfg *config.NotificationConfig) *AsyncNotifier {
+	var transport Notifier
+
+	switch cfg.Driver {
+	case "smtp":
+		transport = NewSMTPNotifier(cfg)
+	case "file":
+		transport = NewFileNotifier(cfg.FilePath)
+	default:
+		transport = NewFileNotifier("")
+	}
+
+	logger.Info("Notifications enabled (driver: %s)", cfg.Driver)
+	return NewAsyncNotifier(transport, cfg)
+}
@@ -0,0 +1,129 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Template names; each has a <name>.txt.tmpl and <name>.html.tmpl file under templates/
+const (
+	TemplatePasswordReset     = "password_reset"
+	TemplateNewDeviceLogin    = "new_device_login"
+	TemplatePasswordChanged   = "password_changed"
+	TemplateAccountBlocked    = "account_blocked"
+	TemplateEmailVerification = "email_verification"
+	TemplatePasswordlessLogin = "passwordless_login"
+)
+
+var subjects = map[string]string{
+	TemplatePasswordReset:     "Your password reset code",
+	TemplateNewDeviceLogin:    "New sign-in to your account",
+	TemplatePasswordChanged:   "Your password was changed",
+	TemplateAccountBlocked:    "Your account has been blocked",
+	TemplateEmailVerification: "Verify your email address",
+	TemplatePasswordlessLogin: "Your sign-in code",
+}
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+type messageTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates are parsed once at startup; a broken template is a programming error
+var templates = mustParseTemplates()
+
+func mustParseTemplates() map[string]*messageTemplate {
+	layout := htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/layout.html.tmpl"))
+
+	parsed := make(map[string]*messageTemplate, len(subjects))
+	for name := range subjects {
+		html := htmltemplate.Must(htmltemplate.Must(layout.Clone()).ParseFS(templateFS, "templates/"+name+".html.tmpl"))
+		text := texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/"+name+".txt.tmpl"))
+		parsed[name] = &messageTemplate{text: text, html: html}
+	}
+	return parsed
+}
+
+// EmailVerificationData feeds TemplateEmailVerification.
+// Link is empty when no frontend URL is configured; the bare token is shown instead.
+type EmailVerificationData struct {
+	Name      string
+	Token     string
+	Link      string
+	ExpiresIn string
+}
+
+// PasswordlessLoginData feeds TemplatePasswordlessLogin.
+// Link is empty when no frontend URL is configured; only the code is shown then.
+type PasswordlessLoginData struct {
+	Name      string
+	OTP       string
+	Link      string
+	ExpiresIn string
+}
+
+// PasswordResetData feeds TemplatePasswordReset
+type PasswordResetData struct {
+	Name      string
+	OTP       string
+	ExpiresIn string
+}
+
+// NewDeviceLoginData feeds TemplateNewDeviceLogin
+type NewDeviceLoginData struct {
+	Name      string
+	Device    string
+	IPAddress string
+	Time      string
+}
+
+// PasswordChangedData feeds TemplatePasswordChanged
+type PasswordChangedData struct {
+	Name string
+	Time string
+}
+
+// AccountBlockedData feeds TemplateAccountBlocked
+type AccountBlockedData struct {
+	Name string
+	Time string
+}
+
+type templateView struct {
+	AppName string
+	Subject string
+	Data    any
+}
+
+// Render builds the text and HTML bodies of a templated message
+func Render(name, appName, to string, data any) (*Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification template %q", name)
+	}
+
+	view := templateView{AppName: appName, Subject: subjects[name], Data: data}
+
+	var text bytes.Buffer
+	if err := tmpl.text.Execute(&text, view); err != nil {
+		return nil, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+
+	var html bytes.Buffer
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", view); err != nil {
+		return nil, fmt.Errorf("failed to render %s html: %w", name, err)
+	}
+
+	return &Message{
+		To:      to,
+		Subject: subjects[name],
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// MemoryStore keeps rate limit state in process memory.
+// Limits are per replica; use the Redis store to share them across instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucketState
+	windows   map[string]*windowState
+	lastSweep time.Time
+}
+
+type bucketState struct {
+	tokens    float64
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+type windowState struct {
+	start     time.Time
+	prev      int
+	cur       int
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucketState),
+		windows:   make(map[string]*windowState),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if limit.Algorithm == TokenBucket {
+		return s.allowTokenBucket(key, limit, now), nil
+	}
+	return s.allowSlidingWindow(key, limit, now), nil
+}
+
+func (s *MemoryStore) allowTokenBucket(key string, limit Limit, now time.Time) *Result {
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucketState{tokens: float64(limit.Requests), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	// Refill proportionally to the time since the last request
+	rate := float64(limit.Requests) / float64(limit.Window)
+	b.tokens = math.Min(float64(limit.Requests), b.tokens+float64(now.Sub(b.updatedAt))*rate)
+	b.updatedAt = now
+	b.expiresAt = now.Add(limit.Window)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return TokenBucketResult(limit, b.tokens, allowed)
+}
+
+func (s *MemoryStore) allowSlidingWindow(key string, limit Limit, now time.Time) *Result {
+	start := now.Truncate(limit.Window)
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &windowState{start: start}
+		s.windows[key] = w
+	}
+
+	// Roll the fixed windows forward
+	switch {
+	case w.start.Equal(start):
+	case w.start.Add(limit.Window).Equal(start):
+		w.prev, w.cur, w.start = w.cur, 0, start
+	default:
+		w.prev, w.cur, w.start = 0, 0, start
+	}
+	w.expiresAt = start.Add(2 * limit.Window)
+
+	elapsed := now.Sub(start)
+	weight := float64(limit.Window-elapsed) / float64(limit.Window)
+	allowed := float64(w.prev)*weight+float64(w.cur)+1 <= float64(limit.Requests)
+	if allowed {
+		w.cur++
+	}
+
+	return SlidingWindowResult(limit, w.prev, w.cur, elapsed, allowed)
+}
+
+// sweep drops expired entries so idle keys don't accumulate forever
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.After(b.expiresAt) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, w := range s.windows {
+		if now.After(w.expiresAt) {
+			delete(s.windows, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Algorithm selects how requests are counted against a limit
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts up to Requests and refills continuously over Window
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow approximates a rolling window by weighting the previous fixed window
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Limit describes how many requests are allowed per window for a single key
+type Limit struct {
+	Algorithm Algorithm
+	Requests  int
+	Window    time.Duration
+}
+
+// Result is the outcome of a single Allow call, used to build RateLimit-* headers
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store is a rate limit backend. Implementations must be safe for concurrent use.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+}
+
+// TokenBucketResult builds a Result from the bucket state after the request was counted
+func TokenBucketResult(limit Limit, tokens float64, allowed bool) *Result {
+	rate := float64(limit.Requests) / float64(limit.Window) // tokens per nanosecond
+
+	res := &Result{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(limit.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate)
+	}
+	return res
+}
+
+// SlidingWindowResult builds a Result from the previous/current window counts.
+// elapsed is the time spent in the current fixed window.
+func SlidingWindowResult(limit Limit, prev, cur int, elapsed time.Duration, allowed bool) *Result {
+	weight := float64(limit.Window-elapsed) / float64(limit.Window)
+	estimate := float64(prev)*weight + float64(cur)
+
+	res := &Result{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  int(math.Max(0, math.Floor(float64(limit.Requests)-estimate))),
+		ResetAfter: limit.Window - elapsed,
+	}
+
+	if !allowed {
+		if cur+1 > limit.Requests || prev == 0 {
+			// The current window alone is full; wait for the next one
+			res.RetryAfter = limit.Window - elapsed
+		} else {
+			// Wait until enough of the previous window has slid out
+			needed := 1 - float64(limit.Requests-cur-1)/float64(prev)
+			res.RetryAfter = time.Duration(needed*float64(limit.Window)) - elapsed
+		}
+		if res.RetryAfter < 0 {
+			res.RetryAfter = 0
+		}
+	}
+
+	return res
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"net/http"
 	"rest_api_poc/internal/di"
+	"rest_api_poc/internal/domain/audit"
 	"rest_api_poc/internal/domain/auth"
 	"rest_api_poc/internal/domain/health"
 	"rest_api_poc/internal/domain/product"
@@ -24,6 +25,7 @@ func SetupRouter(container *di.Container) http.Handler {
 
 	// Standard middleware for prod readiness
 	r.Use(chimw.RequestID)
+	r.Use(middleware.RequestInfo(container.Config.WebServer.TrustedProxies))
 	r.Use(middleware.RequestLogger)
 
 	// CORS (config-driven). Note: wildcard origins cannot be used with credentials.
@@ -37,8 +39,8 @@ func SetupRouter(container *di.Container) http.Handler {
 	}
 	corsOpts := cors.Options{
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"},
-		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"X-Request-ID", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: !allowAll,
 		MaxAge:           300,
 	}
@@ -49,6 +51,9 @@ func SetupRouter(container *di.Container) http.Handler {
 	}
 	r.Use(cors.Handler(corsOpts))
 
+	// After CORS, so 429 responses carry CORS headers and browsers can read them
+	r.Use(container.RateLimiter.Global())
+
 	// Global wrapper for error-returning handlers. Injected into domain route registration
 	// to avoid package import cycles.
 	wrap := func(h func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
@@ -60,17 +65,20 @@ func SetupRouter(container *di.Container) http.Handler {
 	health.RegisterRoutes(r, container.HealthHandler, wrap)
 
 	// Auth routes (public + protected)
-	auth.RegisterRoutes(r, container.AuthModule.Handler, container.AuthMiddleware, container.RoleMiddleware, wrap)
+	auth.RegisterRoutes(r, container.AuthModule.Handler, container.AuthMiddleware, container.RoleMiddleware, container.RateLimiter, wrap)
 
 	// Protected routes (require authentication)
 	r.Group(func(r chi.Router) {
 		r.Use(container.AuthMiddleware.Authenticate)
 
-		// Product routes (read: all users, write: admin/owner only)
-		product.RegisterRoutes(r, container.ProductHandler, container.RoleMiddleware, wrap)
+		// Product routes (read: all users, write: products:write/products:delete)
+		product.RegisterRoutes(r, container.ProductModule.Handler, container.RoleMiddleware, container.RateLimiter, wrap)
 
 		// User routes
-		user.RegisterRoutes(r, container.UserHandler, container.RoleMiddleware, wrap)
+		user.RegisterRoutes(r, container.UserHandler, container.RoleMiddleware, container.RateLimiter, wrap)
+
+		// Audit log routes (audit:read)
+		audit.RegisterRoutes(r, container.AuditHandler, container.RoleMiddleware, container.RateLimiter, wrap)
 	})
 
 	return r
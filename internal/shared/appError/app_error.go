@@ -10,14 +10,16 @@ import (
 type Code string
 
 const (
-	CodeValidation         Code = "VALIDATION_ERROR"
-	CodeAuthentication     Code = "AUTHENTICATION_ERROR"
-	CodeAuthorization      Code = "AUTHORIZATION_ERROR"
-	CodeNotFound           Code = "NOT_FOUND"
-	CodeConflict           Code = "CONFLICT"
-	CodeRateLimited        Code = "RATE_LIMITED"
-	CodeInternal           Code = "INTERNAL_ERROR"
-	CodeServiceUnavailable Code = "SERVICE_UNAVAILABLE"
+	CodeValidation           Code = "VALIDATION_ERROR"
+	CodeAuthentication       Code = "AUTHENTICATION_ERROR"
+	CodeAuthorization        Code = "AUTHORIZATION_ERROR"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeConflict             Code = "CONFLICT"
+	CodePreconditionFailed   Code = "PRECONDITION_FAILED"
+	CodePreconditionRequired Code = "PRECONDITION_REQUIRED"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodeInternal             Code = "INTERNAL_ERROR"
+	CodeServiceUnavailable   Code = "SERVICE_UNAVAILABLE"
 )
 
 // AppError is the canonical application error type used for HTTP responses and logging.
@@ -30,6 +32,7 @@ type AppError interface {
 	ErrorCode() string
 	PublicMessage() string
 	InternalMessage() string
+	Details() any
 	Unwrap() error
 }
 
@@ -37,6 +40,7 @@ type errImpl struct {
 	code          Code
 	status        int
 	publicMessage string
+	details       any
 	cause         error
 }
 
@@ -51,6 +55,7 @@ func (e *errImpl) Error() string {
 func (e *errImpl) HTTPStatus() int       { return e.status }
 func (e *errImpl) ErrorCode() string     { return string(e.code) }
 func (e *errImpl) PublicMessage() string { return e.publicMessage }
+func (e *errImpl) Details() any          { return e.details }
 func (e *errImpl) Unwrap() error         { return e.cause }
 
 func (e *errImpl) InternalMessage() string {
@@ -89,6 +94,16 @@ func Conflict(msg string, cause error) AppError {
 	return newErr(CodeConflict, http.StatusConflict, msg, cause)
 }
 
+// PreconditionFailed reports a conditional request (If-Match) whose condition no longer holds
+func PreconditionFailed(msg string, cause error) AppError {
+	return newErr(CodePreconditionFailed, http.StatusPreconditionFailed, msg, cause)
+}
+
+// PreconditionRequired reports a write that must be made conditional (If-Match) but was not
+func PreconditionRequired(msg string, cause error) AppError {
+	return newErr(CodePreconditionRequired, http.StatusPreconditionRequired, msg, cause)
+}
+
 func RateLimited(msg string, cause error) AppError {
 	return newErr(CodeRateLimited, http.StatusTooManyRequests, msg, cause)
 }
@@ -105,6 +120,18 @@ func ServiceUnavailable(msg string, cause error) AppError {
 	return newErr(CodeServiceUnavailable, http.StatusServiceUnavailable, msg, cause)
 }
 
+// WithDetails returns a copy of err carrying machine-readable details for the client,
+// e.g. the list of failed validation rules. Details must be safe to expose.
+func WithDetails(err AppError, details any) AppError {
+	return &errImpl{
+		code:          Code(err.ErrorCode()),
+		status:        err.HTTPStatus(),
+		publicMessage: err.PublicMessage(),
+		details:       details,
+		cause:         err.Unwrap(),
+	}
+}
+
 func IsAppError(err error) (AppError, bool) {
 	var ae AppError
 	if errors.As(err, &ae) {
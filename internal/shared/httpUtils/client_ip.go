@@ -0,0 +1,71 @@
+package httpUtils
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP returns the address of the client that sent r, without port.
+// It is resolved once per request by the RequestInfo middleware; without it the direct peer is used.
+func ClientIP(r *http.Request) string {
+	if info := RequestInfoFrom(r.Context()); info != nil && info.IPAddress != "" {
+		return info.IPAddress
+	}
+	return StripPort(r.RemoteAddr)
+}
+
+// ResolveClientIP returns the client address of r, without port.
+// X-Forwarded-For and X-Real-IP are only honoured when the direct peer is a trusted proxy,
+// since anyone else can set them. X-Forwarded-For is read from the right, skipping trusted
+// proxies, so a client cannot get a fake address believed by prepending it.
+func ResolveClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	peer := StripPort(r.RemoteAddr)
+	if !isTrusted(peer, trustedProxies) {
+		return peer
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := StripPort(strings.TrimSpace(hops[i]))
+			if hop == "" {
+				continue
+			}
+			if !isTrusted(hop, trustedProxies) || i == 0 {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return StripPort(realIP)
+	}
+	return peer
+}
+
+// StripPort returns the host part of "host:port" (IPv6 hosts lose their brackets);
+// addresses without a port are returned unchanged
+func StripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func isTrusted(ip string, trustedProxies []netip.Prefix) bool {
+	if len(trustedProxies) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package httpUtils
+
+import (
+	"net/http"
+	"rest_api_poc/internal/shared/appError"
+	"strconv"
+	"strings"
+)
+
+// ETag returns the strong entity tag of a resource at the given row version
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// NotModified sets the ETag header and answers a matching If-None-Match with 304 Not Modified.
+// It returns true when the response has been written and the handler must stop.
+func NotModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	etag := ETag(version)
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range splitETags(header) {
+		// If-None-Match uses the weak comparison
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			WriteStatus(w, http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch returns the row versions listed in the If-Match header.
+// It returns nil when the write is unconditional: the header is absent or "*".
+// With required set, a missing header fails with 428 Precondition Required.
+// A header naming no version of ours (e.g. only weak tags) returns an empty, non-nil list:
+// the write then matches no row, so a missing resource still reports 404 before 412.
+func IfMatch(r *http.Request, required bool) ([]int64, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if required {
+			return nil, appError.PreconditionRequired("If-Match header is required", nil)
+		}
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, tag := range splitETags(header) {
+		if tag == "*" {
+			return nil, nil
+		}
+		// If-Match uses the strong comparison, so weak tags never match
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if v, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	if versions == nil {
+		versions = []int64{}
+	}
+	return versions, nil
+}
+
+func splitETags(header string) []string {
+	parts := strings.Split(header, ",")
+	tags := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			tags = append(tags, p)
+		}
+	}
+	return tags
+}
@@ -1,26 +1,47 @@
 package httpUtils
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"rest_api_poc/internal/shared/appError"
 	"rest_api_poc/internal/shared/logger"
 	"runtime/debug"
-	"strings"
 )
 
 type ContextKey string
 
 const (
 	UserContextKey ContextKey = "user"
+	RequestInfoKey ContextKey = "request_info"
 )
 
+// RequestInfo describes where a request came from, for code that only receives a context (e.g. audit logging)
+type RequestInfo struct {
+	IPAddress string
+	UserAgent string
+	RequestID string
+}
+
+// RequestInfoFrom returns the request info stored by the RequestInfo middleware, or nil
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(RequestInfoKey).(*RequestInfo)
+	return info
+}
+
+// UserContextFrom returns the authenticated caller stored by the auth middleware, or nil
+func UserContextFrom(ctx context.Context) *UserContext {
+	userCtx, _ := ctx.Value(UserContextKey).(*UserContext)
+	return userCtx
+}
+
 // UserContext is a shared minimal identity used for logging/observability.
 // It is intentionally duplicated from domain context to keep httpUtils decoupled.
 type UserContext struct {
-	ID        string
-	SessionID string
+	ID             string
+	SessionID      string
+	ImpersonatorID string // the real actor when a support user impersonates ID
 }
 
 // Wrap adapts an error-returning handler into a standard net/http handler.
@@ -42,18 +63,23 @@ func Wrap(h func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 }
 
 // WriteError is the centralized error serializer + logger hook.
-// Response shape is always: { "code": "...", "message": "..." }.
+// Response shape is always: { "code": "...", "message": "..." }, plus "details" when the error carries any.
 func WriteError(w http.ResponseWriter, r *http.Request, err error) {
 	ae := appError.From(err)
 
 	userID, sessionID := extractUserContext(r)
-	ip := ExtractIPAddress(r)
+	ip := ClientIP(r)
 	logError(ae, r, userID, sessionID, ip)
 
-	WriteJson(w, ae.HTTPStatus(), map[string]string{
+	body := map[string]any{
 		"code":    ae.ErrorCode(),
 		"message": ae.PublicMessage(),
-	})
+	}
+	if details := ae.Details(); details != nil {
+		body["details"] = details
+	}
+
+	WriteJson(w, ae.HTTPStatus(), body)
 }
 
 // LogOnly logs an error with the same structured fields as WriteError, but does not write a response.
@@ -64,7 +90,7 @@ func LogOnly(r *http.Request, err error) {
 	}
 	ae := appError.From(err)
 	userID, sessionID := extractUserContext(r)
-	ip := ExtractIPAddress(r)
+	ip := ClientIP(r)
 	logError(ae, r, userID, sessionID, ip)
 }
 
@@ -72,7 +98,8 @@ func logError(ae appError.AppError, r *http.Request, userID, sessionID, ipAddres
 	logMsg := "Error: %s | Method: %s | Path: %s | User: %s | Session: %s | IP: %s | Internal: %s"
 
 	switch ae.ErrorCode() {
-	case "VALIDATION_ERROR", "AUTHENTICATION_ERROR", "AUTHORIZATION_ERROR", "NOT_FOUND", "CONFLICT":
+	case "VALIDATION_ERROR", "AUTHENTICATION_ERROR", "AUTHORIZATION_ERROR", "NOT_FOUND", "CONFLICT",
+		"PRECONDITION_FAILED", "PRECONDITION_REQUIRED":
 		// Expected business errors - warn level
 		logger.Warn(logMsg, ae.ErrorCode(), r.Method, r.URL.Path, userID, sessionID, ipAddress, ae.InternalMessage())
 	default:
@@ -81,30 +108,27 @@ func logError(ae appError.AppError, r *http.Request, userID, sessionID, ipAddres
 	}
 }
 
+// RequestUserID returns the authenticated user's ID, or "" for anonymous requests
+func RequestUserID(r *http.Request) string {
+	if userCtx, ok := r.Context().Value(UserContextKey).(*UserContext); ok {
+		return userCtx.ID
+	}
+	return ""
+}
+
 func extractUserContext(r *http.Request) (userID, sessionID string) {
 	// Try to get from context (set by auth middleware)
 	if ctx := r.Context().Value(UserContextKey); ctx != nil {
 		if userCtx, ok := ctx.(*UserContext); ok {
+			if userCtx.ImpersonatorID != "" {
+				return userCtx.ID + " (impersonated by " + userCtx.ImpersonatorID + ")", "none"
+			}
 			return userCtx.ID, userCtx.SessionID
 		}
 	}
 	return "anonymous", "none"
 }
 
-// ExtractIPAddress extracts IP address from request, considering proxy headers.
-// If behind a reverse proxy, ensure it is configured to set X-Forwarded-For / X-Real-IP correctly.
-func ExtractIPAddress(r *http.Request) string {
-	// X-Forwarded-For can contain multiple IPs, take the first.
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		parts := strings.Split(forwarded, ",")
-		return strings.TrimSpace(parts[0])
-	}
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return realIP
-	}
-	return r.RemoteAddr
-}
-
 // WriteJSON writes JSON response
 func WriteJson(w http.ResponseWriter, statusCode int, payload any) {
 	w.Header().Set("Content-Type", "application/json")